@@ -0,0 +1,389 @@
+// Package acc implements a client for the Assetto Corsa Competizione
+// broadcasting protocol.  Unlike the shared memory telemetry, broadcasting
+// reports every car in the session which gives standings, gaps and positions.
+package acc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+const (
+	// DefaultAddress of the broadcasting API, set in the game's
+	// Documents/Assetto Corsa Competizione/Config/broadcasting.json
+	DefaultAddress = "127.0.0.1:9000"
+
+	// DefaultInterval between realtime updates requested from the game
+	DefaultInterval = 250 * time.Millisecond
+
+	// Registration is retried, and an established connection is assumed lost,
+	// after this many intervals without a message.
+	timeoutIntervals = 20
+
+	// The game sends one message per datagram, the largest being an entry list
+	// car with several long driver names.
+	maxMessageSize = 2048
+
+	// Entry list requests for unknown cars are throttled to one per interval
+	entryListThrottle = time.Second
+
+	// Speed is sent in km/h, so convert to MPH
+	kmhslashmph float32 = 0.621371
+)
+
+// ErrClosed is returned by Next once the client is closed
+var ErrClosed = errors.New("acc: client closed")
+
+type state int
+
+const (
+	disconnected state = iota
+	registering
+	registered
+	closed
+)
+
+// Config of a broadcasting client.  Passwords must match broadcasting.json.
+type Config struct {
+	Address         string
+	DisplayName     string
+	Password        string
+	CommandPassword string
+	Interval        time.Duration
+}
+
+// Model is the live model of the session and every car in it.  It fulfills
+// hid.TelemetryPack for the focused car and hid.StandingsPack for the session.
+type Model struct {
+	Session Session
+	Cars    map[uint16]*Car
+
+	// Last BroadcastingEvent received
+	EventType    byte
+	EventMessage string
+
+	standings []hid.Standing
+	order     []*Car
+}
+
+// Client is a broadcasting API client.  Next registers with the game as needed
+// and applies each received message to the Model.
+type Client struct {
+	Model
+
+	// ConnectionID assigned by the game on registration
+	ConnectionID int32
+	ReadOnly     bool
+
+	config    Config
+	timeout   time.Duration
+	conn      *net.UDPConn
+	buf       []byte
+	out       writer
+	lastEntry time.Time
+
+	mu    sync.Mutex
+	state state
+}
+
+// NewClient returns a client for the broadcasting API at config.Address.  The
+// registration isn't sent until the first call to Next.
+func NewClient(config Config) (*Client, error) {
+	if config.Address == "" {
+		config.Address = DefaultAddress
+	}
+	if config.Interval == 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.DisplayName == "" {
+		config.DisplayName = "opensimdash"
+	}
+	raddr, err := net.ResolveUDPAddr("udp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Model:   Model{Cars: make(map[uint16]*Car)},
+		config:  config,
+		timeout: timeoutIntervals * config.Interval,
+		conn:    conn,
+		buf:     make([]byte, maxMessageSize),
+		out:     make(writer, 0, 64),
+	}, nil
+}
+
+func (c *Client) getState() state {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *Client) setState(s state) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state != closed {
+		c.state = s
+	}
+}
+
+func (c *Client) register() error {
+	c.out = c.out[:0].
+		u8(registerCommandApplication).
+		u8(protocolVersion).
+		str(c.config.DisplayName).
+		str(c.config.Password).
+		i32(int32(c.config.Interval / time.Millisecond)).
+		str(c.config.CommandPassword)
+	_, err := c.conn.Write(c.out)
+	return err
+}
+
+func (c *Client) request(msg byte) error {
+	c.out = c.out[:0].u8(msg).i32(c.ConnectionID)
+	_, err := c.conn.Write(c.out)
+	return err
+}
+
+// Next reads and applies the next message from the game, returning its type.
+// Registration is repeated whenever the game stops sending messages, so Next
+// only returns an error when the client is closed, the game rejects the
+// registration, or the socket fails.
+func (c *Client) Next() (byte, error) {
+	for {
+		switch c.getState() {
+		case closed:
+			return 0, ErrClosed
+		case disconnected:
+			if err := c.register(); err != nil && !retryable(err) {
+				return 0, err
+			}
+			c.setState(registering)
+		}
+
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+		n, err := c.conn.Read(c.buf)
+		if err != nil {
+			if c.getState() == closed {
+				return 0, ErrClosed
+			}
+			if !retryable(err) {
+				return 0, err
+			}
+			// Nobody listening returns immediately, so don't spin
+			if !isTimeout(err) {
+				time.Sleep(c.config.Interval)
+			}
+			c.setState(disconnected)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		t := c.buf[0]
+		if err := c.handle(t, &reader{b: c.buf[1:n]}); err != nil {
+			return t, err
+		}
+		return t, nil
+	}
+}
+
+func (c *Client) handle(t byte, r *reader) error {
+	switch t {
+	case RegistrationResult:
+		c.ConnectionID = r.i32()
+		success := r.u8() != 0
+		c.ReadOnly = r.u8() == 0
+		var msg string
+		r.str(&msg)
+		if r.err != nil {
+			return r.err
+		}
+		if !success {
+			c.setState(disconnected)
+			return fmt.Errorf("acc: registration rejected: %s", msg)
+		}
+		c.setState(registered)
+		if err := c.request(requestEntryList); err != nil {
+			return err
+		}
+		return c.request(requestTrackData)
+	case RealtimeUpdate:
+		c.Session.decodeUpdate(r)
+	case RealtimeCarUpdate:
+		idx := r.u16()
+		car, ok := c.Cars[idx]
+		if !ok {
+			// A car joined the session, so the entry list is out of date
+			if time.Since(c.lastEntry) > entryListThrottle {
+				c.lastEntry = time.Now()
+				return c.request(requestEntryList)
+			}
+			return nil
+		}
+		car.decodeUpdate(r)
+	case EntryList:
+		r.i32() // connection ID
+		n := int(r.u16())
+		cars := make(map[uint16]*Car, n)
+		for i := 0; i < n; i++ {
+			idx := r.u16()
+			if car, ok := c.Cars[idx]; ok {
+				cars[idx] = car
+			} else {
+				cars[idx] = &Car{Index: idx}
+			}
+		}
+		c.Cars = cars
+		c.lastEntry = time.Now()
+	case EntryListCar:
+		idx := r.u16()
+		car, ok := c.Cars[idx]
+		if !ok {
+			car = &Car{Index: idx}
+			c.Cars[idx] = car
+		}
+		car.decodeEntry(r)
+	case TrackData:
+		r.i32() // connection ID
+		c.Session.decodeTrack(r)
+	case BroadcastingEvent:
+		c.EventType = r.u8()
+		r.str(&c.EventMessage)
+	}
+	return r.err
+}
+
+// Close unregisters from the game and closes the connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	prev := c.state
+	c.state = closed
+	c.mu.Unlock()
+
+	// Close may be called while Next is using c.out
+	if prev == registered {
+		c.conn.Write(writer(make([]byte, 0, 5)).u8(unregisterCommandApplication).i32(c.ConnectionID))
+	}
+	return c.conn.Close()
+}
+
+func (m *Model) focused() *Car {
+	return m.Cars[uint16(m.Session.FocusedCarIndex)]
+}
+
+func (m *Model) GetGear() int {
+	if car := m.focused(); car != nil {
+		return car.Gear
+	}
+	return 0
+}
+
+// GetRevLightPercent is always zero since broadcasting doesn't send RPM
+func (m *Model) GetRevLightPercent() int {
+	return 0
+}
+
+func (m *Model) GetSpeed() int {
+	if car := m.focused(); car != nil {
+		return int(float32(car.Kmh) * kmhslashmph)
+	}
+	return 0
+}
+
+func (m *Model) GetPosition() int {
+	if car := m.focused(); car != nil {
+		return int(car.Position)
+	}
+	return 0
+}
+
+// GetStandings orders the cars by position and estimates the gaps between them
+// from their distance around the track.  Gaps are converted to seconds using
+// the leader's reference lap time, or failing that the speed of the car behind.
+func (m *Model) GetStandings() []hid.Standing {
+	m.order = m.order[:0]
+	for _, car := range m.Cars {
+		m.order = append(m.order, car)
+	}
+	sort.Slice(m.order, func(i, j int) bool {
+		a, b := m.order[i], m.order[j]
+		switch {
+		case a.Position == b.Position:
+			return a.Index < b.Index
+		case a.Position == 0: // Cars without a position go last
+			return false
+		case b.Position == 0:
+			return true
+		}
+		return a.Position < b.Position
+	})
+
+	m.standings = m.standings[:0]
+	for i, car := range m.order {
+		s := hid.Standing{
+			Position:    int(car.Position),
+			CarIndex:    int(car.Index),
+			RaceNumber:  int(car.RaceNumber),
+			Driver:      car.DriverName(),
+			Laps:        int(car.Laps),
+			LastLapTime: float32(car.LastLap.LapTime) / 1000,
+			BestLapTime: float32(car.BestSessionLap.LapTime) / 1000,
+			InPit:       car.inPit(),
+		}
+		if i > 0 {
+			s.GapToLeader = m.gap(m.order[0], car)
+			s.GapAhead = m.gap(m.order[i-1], car)
+		}
+		m.standings = append(m.standings, s)
+	}
+	return m.standings
+}
+
+func (m *Model) GetCarCount() int {
+	return len(m.Cars)
+}
+
+// gap in seconds of car behind ahead
+func (m *Model) gap(ahead, car *Car) float32 {
+	laps := float32(ahead.Laps) + ahead.SplinePosition - float32(car.Laps) - car.SplinePosition
+	if laps <= 0 {
+		return 0
+	}
+
+	ref := ahead.BestSessionLap.LapTime
+	if ref == 0 {
+		ref = ahead.LastLap.LapTime
+	}
+	if ref > 0 {
+		return laps * float32(ref) / 1000
+	}
+	if car.Kmh > 0 && m.Session.TrackMeters > 0 {
+		return laps * float32(m.Session.TrackMeters) / (float32(car.Kmh) / 3.6)
+	}
+	return 0
+}
+
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// retryable errors are timeouts, and ICMP port unreachable which is returned
+// by Read on a connected UDP socket when the game isn't running.
+func retryable(err error) bool {
+	if isTimeout(err) {
+		return true
+	}
+	_, ok := err.(*net.OpError)
+	return ok
+}
@@ -0,0 +1,141 @@
+package acc
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func (w writer) u16(v uint16) writer {
+	return append(w, byte(v), byte(v>>8))
+}
+
+func (w writer) f32(v float32) writer {
+	return w.i32(int32(math.Float32bits(v)))
+}
+
+func (w writer) lap(ms int32) writer {
+	return w.i32(ms).u16(0).u16(0).u8(0).u8(0).u8(1).u8(0).u8(0)
+}
+
+func carUpdate(idx, pos, laps uint16, spline float32) []byte {
+	return writer{RealtimeCarUpdate}.
+		u16(idx).u16(0).u8(1).u8(4). // driver, driver count, 2nd gear
+		f32(0).f32(0).f32(0).
+		u8(LocationTrack).u16(100).u16(pos).u16(pos).u16(pos).
+		f32(spline).u16(laps).i32(0).
+		lap(90000).lap(noLapTime).lap(noLapTime)
+}
+
+func entryCar(idx uint16, name string) []byte {
+	return writer{EntryListCar}.
+		u16(idx).u8(0).str("Team").i32(int32(idx) + 10).u8(0).u8(0).u16(0).
+		u8(1).str("First").str("Last").str(name).u8(0).u16(0)
+}
+
+// fakeServer accepts a registration and then sends a scripted session with
+// two cars, where car 2 is leading car 1 by a quarter lap.
+func fakeServer(t *testing.T, conn *net.UDPConn) {
+	b := make([]byte, 256)
+	n, addr, err := conn.ReadFromUDP(b)
+	if err != nil {
+		return
+	}
+	if b[0] != registerCommandApplication || b[1] != protocolVersion {
+		t.Errorf("Unexpected registration %v", b[:n])
+		return
+	}
+	msgs := [][]byte{
+		writer{RegistrationResult}.i32(7).u8(1).u8(1).str(""),
+		writer{EntryList}.i32(7).u16(2).u16(1).u16(2),
+		entryCar(1, "AAA"),
+		entryCar(2, "BBB"),
+		writer{TrackData}.i32(7).str("spa").i32(1).i32(7004),
+		writer{RealtimeUpdate}.
+			u16(0).u16(0).u8(10).u8(5).f32(0).f32(0).i32(1).
+			str("set").str("cam").str("hud").u8(0).
+			f32(0).u8(20).u8(25).u8(0).u8(0).u8(0).lap(noLapTime),
+		carUpdate(1, 2, 3, 0.5),
+		carUpdate(2, 1, 3, 0.75),
+	}
+	for _, m := range msgs {
+		conn.WriteToUDP(m, addr)
+	}
+}
+
+func TestClient(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go fakeServer(t, conn)
+
+	c, err := NewClient(Config{Address: conn.LocalAddr().String(), Interval: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 8; i++ {
+		if _, err := c.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if c.ConnectionID != 7 || c.Session.TrackName != "spa" || c.Session.CurrentHudPage != "hud" {
+		t.Errorf("ConnectionID=%d Track=%q Hud=%q", c.ConnectionID, c.Session.TrackName, c.Session.CurrentHudPage)
+	}
+	if c.GetGear() != 2 || c.GetSpeed() != 62 || c.GetPosition() != 2 {
+		t.Errorf("Gear=%d Speed=%d Position=%d", c.GetGear(), c.GetSpeed(), c.GetPosition())
+	}
+
+	s := c.GetStandings()
+	if len(s) != 2 || c.GetCarCount() != 2 {
+		t.Fatalf("Expected 2 standings, got %d (count %d)", len(s), c.GetCarCount())
+	}
+	if s[0].Driver != "BBB" || s[1].Driver != "AAA" || s[1].RaceNumber != 11 {
+		t.Errorf("Standings = %+v", s)
+	}
+	if s[1].GapToLeader != 22.5 || s[1].GapAhead != 22.5 || s[0].BestLapTime != 90 {
+		t.Errorf("Gap=%f Ahead=%f Best=%f", s[1].GapToLeader, s[1].GapAhead, s[0].BestLapTime)
+	}
+}
+
+func TestInPit(t *testing.T) {
+	for loc, want := range map[byte]bool{
+		LocationNone:     false,
+		LocationTrack:    false,
+		LocationPitlane:  true,
+		LocationPitEntry: true,
+		LocationPitExit:  true,
+	} {
+		if c := (&Car{Location: loc}); c.inPit() != want {
+			t.Errorf("location %d in pit = %t", loc, !want)
+		}
+	}
+}
+
+func TestClientRejected(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		b := make([]byte, 256)
+		if _, addr, err := conn.ReadFromUDP(b); err == nil {
+			conn.WriteToUDP(writer{RegistrationResult}.i32(-1).u8(0).u8(0).str("bad password"), addr)
+		}
+	}()
+
+	c, err := NewClient(Config{Address: conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Next(); err == nil {
+		t.Error("Expected registration error")
+	}
+}
@@ -0,0 +1,316 @@
+package acc
+
+// https://www.assettocorsa.net/forum/index.php?threads/acc-broadcasting-sdk.59962/
+// Message layouts follow the C# reference implementation shipped with the game
+// in "Assetto Corsa Competizione/sdk/broadcasting".
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Broadcasting protocol version supported by this client
+const protocolVersion = 4
+
+// Outbound message types
+const (
+	registerCommandApplication   = 1
+	unregisterCommandApplication = 9
+	requestEntryList             = 10
+	requestTrackData             = 11
+)
+
+// Inbound message types
+const (
+	RegistrationResult = 1
+	RealtimeUpdate     = 2
+	RealtimeCarUpdate  = 3
+	EntryList          = 4
+	TrackData          = 5
+	EntryListCar       = 6
+	BroadcastingEvent  = 7
+)
+
+// CarLocation values of RealtimeCarUpdate
+const (
+	LocationNone     = 0
+	LocationTrack    = 1
+	LocationPitlane  = 2
+	LocationPitEntry = 3
+	LocationPitExit  = 4
+)
+
+// A lap time of math.MaxInt32 means no time has been set
+const noLapTime = math.MaxInt32
+
+var errShortMessage = errors.New("acc: short message")
+
+// reader is a cursor over an inbound message.  Once a read runs past the end of
+// the message every following read returns zero and err is set.
+type reader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil || r.off+n > len(r.b) {
+		r.err = errShortMessage
+		return nil
+	}
+	b := r.b[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *reader) u8() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) i32() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *reader) f32() float32 {
+	if b := r.next(4); b != nil {
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+// bytes of a length prefixed UTF-8 string, without allocating
+func (r *reader) bytes() []byte {
+	return r.next(int(r.u16()))
+}
+
+// str updates s only if the string changed, to avoid allocations for strings
+// which are repeated in every update
+func (r *reader) str(s *string) {
+	if b := r.bytes(); string(b) != *s {
+		*s = string(b)
+	}
+}
+
+// writer builds outbound messages
+type writer []byte
+
+func (w writer) u8(v byte) writer {
+	return append(w, v)
+}
+
+func (w writer) i32(v int32) writer {
+	return append(w, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (w writer) str(s string) writer {
+	w = append(w, byte(len(s)), byte(len(s)>>8))
+	return append(w, s...)
+}
+
+// Lap is the LapInfo structure used in several messages.  Times are in
+// milliseconds and zero when not set.
+type Lap struct {
+	LapTime        int32
+	CarIndex       uint16
+	DriverIndex    uint16
+	Splits         []int32
+	IsInvalid      bool
+	IsValidForBest bool
+	IsOutLap       bool
+	IsInLap        bool
+}
+
+func (l *Lap) decode(r *reader) {
+	l.LapTime = lapTime(r.i32())
+	l.CarIndex = r.u16()
+	l.DriverIndex = r.u16()
+	l.Splits = l.Splits[:0]
+	for n := r.u8(); n > 0; n-- {
+		l.Splits = append(l.Splits, lapTime(r.i32()))
+	}
+	l.IsInvalid = r.u8() != 0
+	l.IsValidForBest = r.u8() != 0
+	l.IsOutLap = r.u8() != 0
+	l.IsInLap = r.u8() != 0
+}
+
+func lapTime(t int32) int32 {
+	if t == noLapTime {
+		return 0
+	}
+	return t
+}
+
+// Driver of an entry list car
+type Driver struct {
+	FirstName   string
+	LastName    string
+	ShortName   string
+	Category    byte
+	Nationality uint16
+}
+
+// Car is the live model of a single car, built from its EntryListCar and
+// RealtimeCarUpdate messages.
+type Car struct {
+	Index              uint16
+	ModelType          byte
+	TeamName           string
+	RaceNumber         int32
+	CupCategory        byte
+	CurrentDriverIndex byte
+	Nationality        uint16
+	Drivers            []Driver
+
+	DriverIndex    uint16
+	Gear           int // -1 reverse, 0 neutral
+	WorldPosX      float32
+	WorldPosY      float32
+	Yaw            float32
+	Location       byte
+	Kmh            uint16
+	Position       uint16
+	CupPosition    uint16
+	TrackPosition  uint16
+	SplinePosition float32
+	Laps           uint16
+	Delta          int32 // Milliseconds
+	BestSessionLap Lap
+	LastLap        Lap
+	CurrentLap     Lap
+}
+
+func (c *Car) decodeEntry(r *reader) {
+	c.ModelType = r.u8()
+	r.str(&c.TeamName)
+	c.RaceNumber = r.i32()
+	c.CupCategory = r.u8()
+	c.CurrentDriverIndex = r.u8()
+	c.Nationality = r.u16()
+	n := int(r.u8())
+	if cap(c.Drivers) < n {
+		c.Drivers = make([]Driver, n)
+	}
+	c.Drivers = c.Drivers[:n]
+	for i := range c.Drivers {
+		d := &c.Drivers[i]
+		r.str(&d.FirstName)
+		r.str(&d.LastName)
+		r.str(&d.ShortName)
+		d.Category = r.u8()
+		d.Nationality = r.u16()
+	}
+}
+
+func (c *Car) decodeUpdate(r *reader) {
+	c.DriverIndex = r.u16()
+	r.u8() // driver count, already known from the entry list
+	c.Gear = int(r.u8()) - 2
+	c.WorldPosX = r.f32()
+	c.WorldPosY = r.f32()
+	c.Yaw = r.f32()
+	c.Location = r.u8()
+	c.Kmh = r.u16()
+	c.Position = r.u16()
+	c.CupPosition = r.u16()
+	c.TrackPosition = r.u16()
+	c.SplinePosition = r.f32()
+	c.Laps = r.u16()
+	c.Delta = r.i32()
+	c.BestSessionLap.decode(r)
+	c.LastLap.decode(r)
+	c.CurrentLap.decode(r)
+}
+
+// inPit is whether the car is in the pit lane, including its entry and exit.
+// LocationNone is a car whose location isn't known, which isn't counted.
+func (c *Car) inPit() bool {
+	switch c.Location {
+	case LocationPitlane, LocationPitEntry, LocationPitExit:
+		return true
+	}
+	return false
+}
+
+// DriverName is the short name of the car's current driver
+func (c *Car) DriverName() string {
+	if int(c.DriverIndex) < len(c.Drivers) {
+		return c.Drivers[c.DriverIndex].ShortName
+	}
+	return ""
+}
+
+// Session is the state from RealtimeUpdate and TrackData messages
+type Session struct {
+	EventIndex      uint16
+	SessionIndex    uint16
+	SessionType     byte
+	Phase           byte
+	SessionTime     float32 // Milliseconds
+	SessionEndTime  float32 // Milliseconds
+	FocusedCarIndex int32
+	ActiveCameraSet string
+	ActiveCamera    string
+	CurrentHudPage  string
+	IsReplayPlaying bool
+	ReplaySession   float32
+	ReplayRemaining float32
+	TimeOfDay       float32
+	AmbientTemp     byte
+	TrackTemp       byte
+	Clouds          byte
+	RainLevel       byte
+	Wetness         byte
+	BestSessionLap  Lap
+
+	TrackName   string
+	TrackID     int32
+	TrackMeters int32
+}
+
+func (s *Session) decodeUpdate(r *reader) {
+	s.EventIndex = r.u16()
+	s.SessionIndex = r.u16()
+	s.SessionType = r.u8()
+	s.Phase = r.u8()
+	s.SessionTime = r.f32()
+	s.SessionEndTime = r.f32()
+	s.FocusedCarIndex = r.i32()
+	r.str(&s.ActiveCameraSet)
+	r.str(&s.ActiveCamera)
+	r.str(&s.CurrentHudPage)
+	s.IsReplayPlaying = r.u8() != 0
+	if s.IsReplayPlaying {
+		s.ReplaySession = r.f32()
+		s.ReplayRemaining = r.f32()
+	}
+	s.TimeOfDay = r.f32()
+	s.AmbientTemp = r.u8()
+	s.TrackTemp = r.u8()
+	s.Clouds = r.u8()
+	s.RainLevel = r.u8()
+	s.Wetness = r.u8()
+	s.BestSessionLap.decode(r)
+}
+
+// decodeTrack ignores the camera sets and HUD pages since they are only needed
+// to control the game, which this client doesn't do.
+func (s *Session) decodeTrack(r *reader) {
+	r.str(&s.TrackName)
+	s.TrackID = r.i32()
+	s.TrackMeters = r.i32()
+}
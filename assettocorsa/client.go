@@ -0,0 +1,239 @@
+// Package assettocorsa implements the Assetto Corsa remote telemetry protocol.
+// Unlike most games Assetto Corsa doesn't broadcast telemetry, instead a client
+// performs a handshake with the game and then subscribes to either RTCarInfo
+// updates or RTLap events.
+package assettocorsa
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Operations sent to the game in a handshake packet
+const (
+	Handshake       = 0
+	SubscribeUpdate = 1
+	SubscribeSpot   = 2
+	Dismiss         = 3
+)
+
+const (
+	// DefaultAddress of the game's remote telemetry server
+	DefaultAddress = "127.0.0.1:9996"
+
+	// DefaultTimeout after which the game is assumed gone and a new handshake
+	// is performed
+	DefaultTimeout = 3 * time.Second
+
+	handshakeSize = 12
+
+	// Identifier and version sent in every handshake packet.  The game doesn't
+	// care about the device identifier so pretend to be the iPhone app.
+	deviceIdentifier = 1
+	protocolVersion  = 1
+)
+
+// Decodable is the same as opensimdash's Decodable; packets which can be
+// decoded from a byte slice without allocations.
+type Decodable interface {
+	Decode(b []byte)
+	Size() int
+}
+
+// ErrClosed is returned by Read and DecodePacket once the client is closed
+var ErrClosed = errors.New("assettocorsa: client closed")
+
+type state int
+
+const (
+	disconnected state = iota
+	subscribed
+	closed
+)
+
+// Client is an Assetto Corsa remote telemetry client.  Read performs the
+// handshake and subscription as needed, and transparently reconnects when the
+// game stops sending data for longer than Timeout (eg. the game restarted).
+type Client struct {
+	// Response to the last successful handshake
+	Handshake HandshakeResponse
+
+	operation int32
+	timeout   time.Duration
+
+	mu    sync.Mutex
+	conn  *net.UDPConn
+	state state
+	out   []byte
+	in    []byte
+}
+
+// NewClient returns a client which will subscribe to SubscribeUpdate or
+// SubscribeSpot on the game listening at address.  If address is empty
+// DefaultAddress is used, and if timeout is zero DefaultTimeout is used.  The
+// handshake isn't performed until the first Read.
+func NewClient(address string, operation int, timeout time.Duration) (*Client, error) {
+	if address == "" {
+		address = DefaultAddress
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		operation: int32(operation),
+		timeout:   timeout,
+		conn:      conn,
+		out:       make([]byte, handshakeSize),
+		in:        make([]byte, HandshakeResponseSize),
+	}, nil
+}
+
+func (c *Client) getState() state {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *Client) setState(s state) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == closed {
+		return false
+	}
+	c.state = s
+	return true
+}
+
+func (c *Client) send(b []byte, operation int32) error {
+	binary.LittleEndian.PutUint32(b[0:4], deviceIdentifier)
+	binary.LittleEndian.PutUint32(b[4:8], protocolVersion)
+	binary.LittleEndian.PutUint32(b[8:12], uint32(operation))
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// connect performs the handshake and subscribes to the configured operation
+func (c *Client) connect() error {
+	if err := c.send(c.out, Handshake); err != nil {
+		return err
+	}
+	// Updates from an earlier subscription may still arrive ahead of the
+	// reply, so skip anything shorter until the deadline
+	c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+	for {
+		n, err := c.conn.Read(c.in)
+		if err != nil {
+			return err
+		}
+		if n >= HandshakeResponseSize {
+			break
+		}
+	}
+	c.Handshake.Decode(c.in)
+	if err := c.send(c.out, c.operation); err != nil {
+		return err
+	}
+	if !c.setState(subscribed) {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Read the next packet sent by the game, performing a new handshake whenever
+// the game stops responding.  Read only returns an error once the client is
+// closed or the socket fails for a reason other than a timeout.
+func (c *Client) Read(b []byte) (int, error) {
+	for {
+		switch c.getState() {
+		case closed:
+			return 0, ErrClosed
+		case disconnected:
+			if err := c.connect(); err != nil {
+				if c.getState() == closed {
+					return 0, ErrClosed
+				}
+				if !retryable(err) {
+					return 0, err
+				}
+				// Nobody listening returns immediately, so don't spin
+				if !isTimeout(err) {
+					time.Sleep(c.timeout)
+				}
+				continue
+			}
+		}
+
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+		n, err := c.conn.Read(b)
+		if err == nil {
+			return n, nil
+		}
+		if c.getState() == closed {
+			return 0, ErrClosed
+		}
+		if !retryable(err) {
+			return 0, err
+		}
+		c.setState(disconnected)
+	}
+}
+
+// DecodePacket reads the next packet using the optional buffer and decodes it.
+// Packets shorter than d.Size() are skipped.  The same buffer rules apply as
+// for Telemetry.DecodePacket.
+func (c *Client) DecodePacket(d Decodable, buf []byte) error {
+	b := buf
+	if b == nil {
+		b = make([]byte, d.Size())
+	}
+	for {
+		n, err := c.Read(b)
+		if err != nil {
+			return err
+		}
+		if n >= d.Size() {
+			d.Decode(b[:n])
+			return nil
+		}
+	}
+}
+
+// Close sends a dismiss to the game and closes the connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	prev := c.state
+	c.state = closed
+	c.mu.Unlock()
+
+	// Close may be called while Read is using c.out
+	if prev == subscribed {
+		c.send(make([]byte, handshakeSize), Dismiss)
+	}
+	return c.conn.Close()
+}
+
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// retryable errors are timeouts, and ICMP port unreachable which is returned
+// by Read on a connected UDP socket when the game isn't running.
+func retryable(err error) bool {
+	if isTimeout(err) {
+		return true
+	}
+	_, ok := err.(*net.OpError)
+	return ok
+}
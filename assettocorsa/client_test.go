@@ -0,0 +1,189 @@
+package assettocorsa
+
+import (
+	"encoding/binary"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer pretends to be Assetto Corsa, replying to handshakes and sending
+// a single RTCarInfo for every subscription.  A stale server also sends an
+// RTCarInfo ahead of every handshake reply.
+type fakeServer struct {
+	conn *net.UDPConn
+
+	mu         sync.Mutex
+	handshakes int
+	dismissed  bool
+	silent     bool
+	stale      bool
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{conn: conn}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) serve() {
+	b := make([]byte, 64)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		if n != handshakeSize {
+			continue
+		}
+
+		s.mu.Lock()
+		silent, stale := s.silent, s.stale
+		switch binary.LittleEndian.Uint32(b[8:12]) {
+		case Handshake:
+			s.handshakes++
+		case Dismiss:
+			s.dismissed = true
+		}
+		s.mu.Unlock()
+		if silent {
+			continue
+		}
+
+		if stale && binary.LittleEndian.Uint32(b[8:12]) == Handshake {
+			s.conn.WriteToUDP(carInfo(), addr)
+		}
+		switch binary.LittleEndian.Uint32(b[8:12]) {
+		case Handshake:
+			resp := make([]byte, HandshakeResponseSize)
+			for i, c := range "ks_mazda_mx5_cup" {
+				resp[2*i] = byte(c)
+			}
+			binary.LittleEndian.PutUint32(resp[200:204], 4242)
+			s.conn.WriteToUDP(resp, addr)
+		case SubscribeUpdate:
+			s.conn.WriteToUDP(carInfo(), addr)
+		}
+	}
+}
+
+func carInfo() []byte {
+	info := make([]byte, CarInfoSize)
+	info[0] = 'a'
+	binary.LittleEndian.PutUint32(info[16:20], math.Float32bits(20))
+	binary.LittleEndian.PutUint32(info[68:72], math.Float32bits(6500))
+	binary.LittleEndian.PutUint32(info[76:80], 4)
+	return info
+}
+
+func (s *fakeServer) set(silent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silent = silent
+}
+
+func (s *fakeServer) stats() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handshakes, s.dismissed
+}
+
+func TestClient(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.conn.Close()
+
+	c, err := NewClient(s.conn.LocalAddr().String(), SubscribeUpdate, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &CarInfo{MaxRPM: 8000}
+	if err := c.DecodePacket(p, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.Handshake.CarName != "ks_mazda_mx5_cup" || c.Handshake.Identifier != 4242 {
+		t.Errorf("Handshake = %+v", c.Handshake)
+	}
+	if p.GetGear() != 3 || p.GetSpeed() != 44 || p.GetRevLightPercent() != 81 {
+		t.Errorf("Gear=%d Speed=%d Rev=%d", p.GetGear(), p.GetSpeed(), p.GetRevLightPercent())
+	}
+
+	// The fake only sends one update per subscription, so the next read times
+	// out and the client has to handshake again
+	if err := c.DecodePacket(p, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.stats(); n != 2 {
+		t.Errorf("Expected 2 handshakes, got %d", n)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := c.DecodePacket(p, nil); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, dismissed := s.stats(); !dismissed {
+		t.Error("Client did not dismiss")
+	}
+}
+
+func TestClientCloseWhileWaiting(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.conn.Close()
+	s.set(true)
+
+	c, err := NewClient(s.conn.LocalAddr().String(), SubscribeUpdate, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- c.DecodePacket(&CarInfo{}, nil)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	c.Close()
+
+	select {
+	case err := <-done:
+		if err != ErrClosed {
+			t.Errorf("Expected ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("DecodePacket did not return after Close")
+	}
+	if n, _ := s.stats(); n < 2 {
+		t.Errorf("Expected repeated handshakes, got %d", n)
+	}
+}
+
+func TestClientStaleUpdate(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.conn.Close()
+	s.mu.Lock()
+	s.stale = true
+	s.mu.Unlock()
+
+	c, err := NewClient(s.conn.LocalAddr().String(), SubscribeUpdate, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The update ahead of the handshake reply is skipped, not an error
+	p := &CarInfo{}
+	if err := c.DecodePacket(p, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.Handshake.Identifier != 4242 || p.GetGear() != 3 {
+		t.Errorf("Handshake = %+v, Gear = %d", c.Handshake, p.GetGear())
+	}
+}
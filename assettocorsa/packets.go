@@ -0,0 +1,256 @@
+package assettocorsa
+
+// https://docs.google.com/document/d/1KfkZiIluXZ6mMhLWfDX1qAGbvhGRC3ZUzjVIt5FQpp4/pub
+
+import (
+	"encoding/binary"
+	"math"
+	"unicode/utf16"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+const (
+	// HandshakeResponseSize is the size of the reply to a handshake
+	HandshakeResponseSize = 408
+
+	// CarInfoSize is the size of an RTCarInfo update
+	CarInfoSize = 328
+
+	// LapSize is the size of an RTLap spot event
+	LapSize = 212
+
+	// Speed is sent in meters per second, so convert to MPH
+	mslashs float32 = 2.23694
+)
+
+// HandshakeResponse is sent by Assetto Corsa in reply to a handshake
+type HandshakeResponse struct {
+	CarName     string
+	DriverName  string
+	Identifier  int32 // Server status, 4242 when the server is working
+	Version     int32
+	TrackName   string
+	TrackConfig string
+}
+
+// Decode a little endian handshake response.  Shorter datagrams are ignored.
+func (h *HandshakeResponse) Decode(b []byte) {
+	if len(b) < HandshakeResponseSize {
+		return
+	}
+	_ = b[HandshakeResponseSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	h.CarName = decodeString(b[0:100])
+	h.DriverName = decodeString(b[100:200])
+	h.Identifier = int32(binary.LittleEndian.Uint32(b[200:204]))
+	h.Version = int32(binary.LittleEndian.Uint32(b[204:208]))
+	h.TrackName = decodeString(b[208:308])
+	h.TrackConfig = decodeString(b[308:408])
+}
+
+func (h *HandshakeResponse) Size() int {
+	return HandshakeResponseSize
+}
+
+// CarInfo is the RTCarInfo update streamed after SubscribeUpdate.
+type CarInfo struct {
+	Identifier            byte
+	PacketSize            int32
+	SpeedKmh              float32
+	SpeedMph              float32
+	SpeedMs               float32
+	IsAbsEnabled          bool
+	IsAbsInAction         bool
+	IsTcInAction          bool
+	IsTcEnabled           bool
+	IsInPit               bool
+	IsEngineLimiterOn     bool
+	AccGVertical          float32
+	AccGHorizontal        float32
+	AccGFrontal           float32
+	LapTime               int32 // Milliseconds
+	LastLap               int32 // Milliseconds
+	BestLap               int32 // Milliseconds
+	LapCount              int32
+	Gas                   float32
+	Brake                 float32
+	Clutch                float32
+	EngineRPM             float32
+	Steer                 float32
+	Gear                  int32 // 0 = reverse, 1 = neutral, 2 = first
+	CGHeight              float32
+	WheelAngularSpeed     [4]float32
+	SlipAngle             [4]float32
+	SlipAngleContactPatch [4]float32
+	SlipRatio             [4]float32
+	TyreSlip              [4]float32
+	NdSlip                [4]float32
+	Load                  [4]float32
+	Dy                    [4]float32
+	Mz                    [4]float32
+	TyreDirtyLevel        [4]float32
+	CamberRAD             [4]float32
+	TyreRadius            [4]float32
+	TyreLoadedRadius      [4]float32
+	SuspensionHeight      [4]float32
+	CarPositionNormalized float32
+	CarSlope              float32
+	CarCoordinates        [3]float32
+
+	// MaxRPM isn't sent by Assetto Corsa.  If it isn't set by the user then
+	// it's learnt from the RPM, see hid.PeakRPM.
+	MaxRPM float32
+
+	peak hid.PeakRPM
+}
+
+func (p *CarInfo) Size() int {
+	return CarInfoSize
+}
+
+// Decode converts a little endian byte array into a CarInfo without any
+// allocations or reflection.  Datagrams shorter than CarInfoSize are ignored.
+func (p *CarInfo) Decode(b []byte) {
+	if len(b) < CarInfoSize {
+		return
+	}
+	_ = b[CarInfoSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	p.Identifier = b[0]
+	p.PacketSize = int32(binary.LittleEndian.Uint32(b[4:8]))
+	p.SpeedKmh = float32At(b, 8)
+	p.SpeedMph = float32At(b, 12)
+	p.SpeedMs = float32At(b, 16)
+	p.IsAbsEnabled = b[20] != 0
+	p.IsAbsInAction = b[21] != 0
+	p.IsTcInAction = b[22] != 0
+	p.IsTcEnabled = b[23] != 0
+	p.IsInPit = b[24] != 0
+	p.IsEngineLimiterOn = b[25] != 0
+	p.AccGVertical = float32At(b, 28)
+	p.AccGHorizontal = float32At(b, 32)
+	p.AccGFrontal = float32At(b, 36)
+	p.LapTime = int32(binary.LittleEndian.Uint32(b[40:44]))
+	p.LastLap = int32(binary.LittleEndian.Uint32(b[44:48]))
+	p.BestLap = int32(binary.LittleEndian.Uint32(b[48:52]))
+	p.LapCount = int32(binary.LittleEndian.Uint32(b[52:56]))
+	p.Gas = float32At(b, 56)
+	p.Brake = float32At(b, 60)
+	p.Clutch = float32At(b, 64)
+	p.EngineRPM = float32At(b, 68)
+	p.Steer = float32At(b, 72)
+	p.Gear = int32(binary.LittleEndian.Uint32(b[76:80]))
+	p.CGHeight = float32At(b, 80)
+	for i := 0; i < 4; i++ {
+		p.WheelAngularSpeed[i] = float32At(b, 84+4*i)
+		p.SlipAngle[i] = float32At(b, 100+4*i)
+		p.SlipAngleContactPatch[i] = float32At(b, 116+4*i)
+		p.SlipRatio[i] = float32At(b, 132+4*i)
+		p.TyreSlip[i] = float32At(b, 148+4*i)
+		p.NdSlip[i] = float32At(b, 164+4*i)
+		p.Load[i] = float32At(b, 180+4*i)
+		p.Dy[i] = float32At(b, 196+4*i)
+		p.Mz[i] = float32At(b, 212+4*i)
+		p.TyreDirtyLevel[i] = float32At(b, 228+4*i)
+		p.CamberRAD[i] = float32At(b, 244+4*i)
+		p.TyreRadius[i] = float32At(b, 260+4*i)
+		p.TyreLoadedRadius[i] = float32At(b, 276+4*i)
+		p.SuspensionHeight[i] = float32At(b, 292+4*i)
+	}
+	p.CarPositionNormalized = float32At(b, 308)
+	p.CarSlope = float32At(b, 312)
+	p.CarCoordinates[0] = float32At(b, 316)
+	p.CarCoordinates[1] = float32At(b, 320)
+	p.CarCoordinates[2] = float32At(b, 324)
+
+	p.peak.Update(p.EngineRPM)
+}
+
+// GetGear returns -1 for reverse and 0 for neutral
+func (p *CarInfo) GetGear() int {
+	return int(p.Gear) - 1
+}
+
+func (p *CarInfo) GetRevLightPercent() int {
+	return p.peak.Percent(p.EngineRPM, p.MaxRPM)
+}
+
+func (p *CarInfo) GetSpeed() int {
+	return int(p.SpeedMs * mslashs)
+}
+
+func (p *CarInfo) GetRPM() int {
+	return int(p.EngineRPM)
+}
+
+// GetMaxRPM is either the user supplied MaxRPM or the learnt maximum, which is
+// zero until it's known
+func (p *CarInfo) GetMaxRPM() int {
+	return int(p.peak.Max(p.MaxRPM))
+}
+
+// GetIdleRPM is always zero since Assetto Corsa doesn't send it
+func (p *CarInfo) GetIdleRPM() int {
+	return 0
+}
+
+func (p *CarInfo) GetLap() int {
+	return int(p.LapCount)
+}
+
+func (p *CarInfo) GetLapTime() float32 {
+	return float32(p.LapTime) / 1000
+}
+
+func (p *CarInfo) GetLastLapTime() float32 {
+	return float32(p.LastLap) / 1000
+}
+
+func (p *CarInfo) GetBestLapTime() float32 {
+	return float32(p.BestLap) / 1000
+}
+
+// Lap is the RTLap event sent whenever a car completes a lap after
+// SubscribeSpot.
+type Lap struct {
+	CarIdentifierNumber int32
+	Lap                 int32
+	DriverName          string
+	CarName             string
+	Time                int32 // Milliseconds
+}
+
+func (l *Lap) Size() int {
+	return LapSize
+}
+
+// Decode a little endian RTLap.  Unlike CarInfo this allocates the names, but
+// lap events are rare.  Shorter datagrams are ignored.
+func (l *Lap) Decode(b []byte) {
+	if len(b) < LapSize {
+		return
+	}
+	_ = b[LapSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	l.CarIdentifierNumber = int32(binary.LittleEndian.Uint32(b[0:4]))
+	l.Lap = int32(binary.LittleEndian.Uint32(b[4:8]))
+	l.DriverName = decodeString(b[8:108])
+	l.CarName = decodeString(b[108:208])
+	l.Time = int32(binary.LittleEndian.Uint32(b[208:212]))
+}
+
+func float32At(b []byte, i int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4]))
+}
+
+// decodeString converts a nul terminated UTF-16 string, which Assetto Corsa
+// uses for every name, into a golang string.
+func decodeString(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		u = append(u, c)
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,27 @@
+package assettocorsa
+
+import (
+	"testing"
+)
+
+func TestShortDatagrams(t *testing.T) {
+	for n := 0; n < HandshakeResponseSize; n++ {
+		b := make([]byte, n)
+		var h HandshakeResponse
+		h.Decode(b)
+		var p CarInfo
+		p.Decode(b)
+		var l Lap
+		l.Decode(b)
+	}
+
+	// A short datagram leaves the last update in place
+	b := make([]byte, CarInfoSize)
+	b[0] = 'a'
+	var p CarInfo
+	p.Decode(b)
+	p.Decode(make([]byte, 100))
+	if p.Identifier != 'a' {
+		t.Errorf("Identifier = %q after a short datagram", p.Identifier)
+	}
+}
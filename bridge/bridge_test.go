@@ -0,0 +1,265 @@
+package bridge
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+type stagePack struct {
+	gear, speed int
+	progress    float32
+}
+
+func (p *stagePack) GetGear() int                  { return p.gear }
+func (p *stagePack) GetRevLightPercent() int       { return 50 }
+func (p *stagePack) GetSpeed() int                 { return p.speed }
+func (p *stagePack) GetStageProgress() float32     { return p.progress }
+func (p *stagePack) GetStageDistance() float32     { return 1000 }
+func (p *stagePack) GetStageLength() float32       { return 4000 }
+func (p *stagePack) GetStageTime() float32         { return 61.5 }
+func (p *stagePack) GetIndicators() hid.Indicators { return hid.IndicatorABS }
+
+func TestFrames(t *testing.T) {
+	src := &stagePack{gear: -1, speed: 80, progress: 0.25}
+	var sent, prev Model
+	sent.Capture(src)
+	full := sent.AppendFrame(nil, nil)
+
+	var p Pack
+	p.Decode(full)
+	if p.Model != sent || !p.Has(CapStage|CapIndicator) || p.Has(CapEngine) {
+		t.Fatalf("decoded %+v, want %+v", p.Model, sent)
+	}
+
+	// Only the packs the source sent are reported, even when bridged again
+	if _, ok := hid.ChannelRPM.Value(&p); ok {
+		t.Error("reported RPM the source didn't send")
+	}
+	if v, ok := hid.ChannelStageProgress.Value(&p); !ok || v != 0.25 {
+		t.Errorf("StageProgress = %f, %t", v, ok)
+	}
+	var again Model
+	if again.Capture(&p); again != sent {
+		t.Errorf("recaptured %+v, want %+v", again, sent)
+	}
+
+	// Only the changed field is sent
+	prev = sent
+	src.speed = 81
+	sent.Capture(src)
+	delta := sent.AppendFrame(nil, &prev)
+	if len(delta) != 4 { // type, mask, speed varint
+		t.Errorf("delta is %d bytes: %x", len(delta), delta)
+	}
+	p.Decode(delta)
+	if p.Model != sent {
+		t.Errorf("decoded %+v, want %+v", p.Model, sent)
+	}
+
+	// Truncated and unknown frames don't panic
+	for i := range full {
+		p.Decode(full[:i])
+	}
+	p.Decode([]byte{99, 1, 2})
+}
+
+func TestBridge(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(s.Addr().String(), nil)
+	defer c.Close()
+
+	src := &stagePack{gear: 3, speed: 100, progress: 0.5}
+	recv := make(chan Pack)
+	go func() {
+		var p Pack
+		buf := make([]byte, p.Size())
+		for {
+			if err := c.DecodePacket(&p, buf); err != nil {
+				close(recv)
+				return
+			}
+			recv <- p
+		}
+	}()
+
+	// Keep sending until the client has connected and received a frame
+	expect := func(want int) {
+		deadline := time.After(5 * time.Second)
+		for {
+			s.SendPack(src)
+			select {
+			case p := <-recv:
+				if p.GetSpeed() == want {
+					return
+				}
+			case <-time.After(20 * time.Millisecond):
+			case <-deadline:
+				t.Fatalf("never received speed %d", want)
+			}
+		}
+	}
+	expect(100)
+
+	// Restart the server on the same address; the client reconnects
+	addr := s.Addr().String()
+	s.Close()
+	var s2 *Server
+	for i := 0; i < 50; i++ {
+		if s2, err = NewServer(addr, nil); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	s = s2
+	src.speed = 120
+	expect(120)
+
+	c.Close()
+	for range recv {
+	}
+}
+
+func TestVersion(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.Write([]byte{'O', 'S', 'D', 'B', VersionMajor + 1, 0})
+		}
+	}()
+	c := NewClient(ln.Addr().String(), nil)
+	defer c.Close()
+	if _, err := c.Read(make([]byte, MaxFrameSize)); err == nil {
+		t.Error("expected version error")
+	} else if _, ok := err.(*VersionError); !ok {
+		t.Errorf("err = %v", err)
+	}
+}
+
+type racePack struct {
+	stagePack
+	standings []hid.Standing
+}
+
+func (p *racePack) GetStageName() string         { return "Monte Carlo – Col de Turini Sprint en Descente" }
+func (p *racePack) GetCarName() string           { return "Lancia Stratos" }
+func (p *racePack) GetPosition() int             { return 2 }
+func (p *racePack) GetStandings() []hid.Standing { return p.standings }
+func (p *racePack) GetCarCount() int             { return len(p.standings) }
+func (p *racePack) GetSplits() []float32         { return []float32{20.5, 41} }
+
+func TestNamesAndStandings(t *testing.T) {
+	src := &racePack{standings: []hid.Standing{
+		{Position: 1, CarIndex: 4, RaceNumber: 7, Driver: "A. Driver", Laps: 3},
+		{Position: 2, CarIndex: 0, RaceNumber: 12, Driver: "B. Driver", Laps: 3, GapToLeader: 1.5, GapAhead: 1.5, InPit: true},
+	}}
+	var m Model
+	m.Capture(src)
+	var p Pack
+	p.Decode(m.AppendFrame(nil, nil))
+	for i := range src.standings {
+		p.Decode(appendStanding(nil, i, &src.standings[i]))
+	}
+
+	if !p.Has(CapName|CapStandings|CapSplits) || p.GetCarName() != "Lancia Stratos" {
+		t.Errorf("decoded %+v", p.Model)
+	}
+	// Names are truncated to fit, without splitting a character
+	if name := p.GetStageName(); len(name) > maxNameLen || name != "Monte Carlo – Col de Turini Sprint en " {
+		t.Errorf("stage name %q", name)
+	}
+	if s := p.GetSplits(); len(s) != 2 || s[1] != 41 {
+		t.Errorf("splits %v", s)
+	}
+	if s := p.GetStandings(); p.GetCarCount() != 2 || len(s) != 2 || s[1] != src.standings[1] {
+		t.Errorf("standings %+v", s)
+	}
+
+	// Rows beyond the car count are dropped
+	src.standings = src.standings[:1]
+	m.Capture(src)
+	p.Decode(m.AppendFrame(nil, nil))
+	if s := p.GetStandings(); len(s) != 1 {
+		t.Errorf("standings %+v", s)
+	}
+
+	// Truncated standings don't panic
+	full := appendStanding(nil, 1, &src.standings[0])
+	for i := 1; i < len(full); i++ {
+		p.Decode(full[:i])
+	}
+}
+
+// Every frame fits in MaxFrameSize, which older receivers read frames into
+func TestFrameSize(t *testing.T) {
+	long := string(make([]byte, 2*maxNameLen))
+	m := Model{Caps: math.MaxUint32, Indicators: math.MaxUint32}
+	for _, f := range m.ints() {
+		if f != nil {
+			*f = math.MinInt32
+		}
+	}
+	m.StageName, m.CarName = truncate(long), truncate(long)
+	if n := len(m.AppendFrame(nil, nil)); n > MaxFrameSize {
+		t.Errorf("telemetry frame is %d bytes", n)
+	}
+	s := hid.Standing{Position: math.MinInt32, CarIndex: math.MinInt32, RaceNumber: math.MinInt32, Laps: math.MinInt32, Driver: long}
+	if n := len(appendStanding(nil, maxStandings, &s)); n > MaxFrameSize {
+		t.Errorf("standing frame is %d bytes", n)
+	}
+}
+
+func TestServerStandings(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	s := &Server{receivers: []*receiver{{conn: conn}}}
+
+	// frames sends p and returns the types of the frames the receiver got
+	frames := func(p hid.TelemetryPack) []byte {
+		t.Helper()
+		done := make(chan struct{})
+		go func() {
+			s.SendPack(p)
+			close(done)
+		}()
+		var types []byte
+		buf := make([]byte, MaxFrameSize)
+		for {
+			peer.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			n, err := readFrame(peer, buf)
+			if err != nil {
+				break
+			}
+			types = append(types, buf[:n][0])
+		}
+		<-done
+		return types
+	}
+
+	src := &racePack{standings: []hid.Standing{{Position: 1, Driver: "A"}, {Position: 2, Driver: "B"}}}
+	if f := frames(src); string(f) != "\x01\x02\x02" {
+		t.Errorf("first frames %x", f)
+	}
+	if f := frames(src); string(f) != "\x01" {
+		t.Errorf("unchanged frames %x", f)
+	}
+	src.standings[1].Laps = 1
+	if f := frames(src); string(f) != "\x01\x02" {
+		t.Errorf("changed frames %x", f)
+	}
+}
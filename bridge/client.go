@@ -0,0 +1,213 @@
+package bridge
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Reconnection backoff doubles from minBackoff up to maxBackoff
+	minBackoff = 250 * time.Millisecond
+	maxBackoff = 5 * time.Second
+
+	dialTimeout = 5 * time.Second
+)
+
+var errFrame = errors.New("bridge: frame too large")
+
+// VersionError is returned when the server speaks a protocol major version the
+// client doesn't understand.
+type VersionError struct {
+	Major, Minor byte
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("bridge: unsupported protocol version %d.%d", e.Major, e.Minor)
+}
+
+// Client receives frames from a Server, reconnecting whenever the connection
+// is lost.  Each Read returns a single frame, so a Client is a telemetry
+// source like any other and a Pack is its Decodable.
+type Client struct {
+	address string
+	logger  *log.Logger
+	done    chan struct{}
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+
+	r       *bufio.Reader
+	backoff time.Duration
+}
+
+// NewClient for the server at address.  The connection is made by the first
+// Read.
+func NewClient(address string, logger *log.Logger) *Client {
+	return &Client{
+		address: address,
+		logger:  logger,
+		done:    make(chan struct{}),
+	}
+}
+
+// Read the next frame, connecting or reconnecting as needed.  Read only
+// returns an error once the Client is closed, or if the server speaks an
+// incompatible protocol version.
+func (c *Client) Read(b []byte) (int, error) {
+	for {
+		if c.r == nil {
+			if err := c.connect(); err != nil {
+				if _, ok := err.(*VersionError); ok || err == ErrClosed {
+					return 0, err
+				}
+				c.logf("Bridge connect %s: %v", c.address, err)
+				if err := c.wait(); err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+		n, err := readFrame(c.r, b)
+		if err == nil {
+			return n, nil
+		}
+		if c.isClosed() {
+			return 0, ErrClosed
+		}
+		c.logf("Bridge disconnected %s: %v", c.address, err)
+		c.disconnect()
+	}
+}
+
+// DecodePacket from the next frame using the optional buffer.  The same
+// buffer rules apply as for Telemetry.DecodePacket.
+func (c *Client) DecodePacket(d Decodable, buf []byte) error {
+	b := buf
+	if b == nil {
+		b = make([]byte, d.Size())
+	}
+	n, err := c.Read(b)
+	if err != nil {
+		return err
+	}
+	d.Decode(b[:n])
+	return nil
+}
+
+// Decodable is the same as opensimdash's Decodable
+type Decodable interface {
+	Decode(b []byte)
+	Size() int
+}
+
+func (c *Client) connect() error {
+	conn, err := net.DialTimeout("tcp", c.address, dialTimeout)
+	if err != nil {
+		return err
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetKeepAlive(true)
+		tcp.SetKeepAlivePeriod(keepAlive)
+	}
+
+	var h [6]byte
+	conn.SetReadDeadline(time.Now().Add(dialTimeout))
+	if _, err := io.ReadFull(conn, h[:]); err != nil {
+		conn.Close()
+		return err
+	}
+	if string(h[:4]) != string(hello[:]) {
+		conn.Close()
+		return errors.New("bridge: not an opensimdash bridge")
+	}
+	if h[4] != VersionMajor {
+		conn.Close()
+		return &VersionError{h[4], h[5]}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		conn.Close()
+		return ErrClosed
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+	c.backoff = 0
+	c.logf("Bridge connected %s (version %d.%d)", c.address, h[4], h[5])
+	return nil
+}
+
+func (c *Client) disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn, c.r = nil, nil
+}
+
+// wait before reconnecting, returning ErrClosed if closed meanwhile
+func (c *Client) wait() error {
+	if c.backoff < minBackoff {
+		c.backoff = minBackoff
+	} else if c.backoff *= 2; c.backoff > maxBackoff {
+		c.backoff = maxBackoff
+	}
+	t := time.NewTimer(c.backoff)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-c.done:
+		return ErrClosed
+	}
+}
+
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// Close the connection and stop reconnecting
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	c.closed = true
+	close(c.done)
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+func (c *Client) logf(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+	}
+}
+
+func readFrame(r io.Reader, b []byte) (int, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[:]))
+	if n > len(b) {
+		return 0, errFrame
+	}
+	return io.ReadFull(r, b[:n])
+}
@@ -0,0 +1,565 @@
+// Package bridge forwards the normalized telemetry model from one opensimdash
+// instance to another, so that one machine can decode a game's telemetry and
+// another can drive HID devices and serve the web dash.
+//
+// The instance decoding the game runs a Server, which receivers connect to with
+// a Client.  On connecting the server sends a hello, "OSDB" followed by the
+// major and minor protocol version, and receivers hang up on a major version
+// they don't understand.  After the hello every frame is a big endian uint16
+// length followed by the payload:
+//
+//	type    byte    frameTelemetry
+//	fields  uvarint bitmask of the fields which follow, in field order
+//	values          ints as zigzag varints, floats as little endian float32,
+//	                strings as a uvarint length and the bytes
+//
+// Only fields which changed since the previous frame on the same connection
+// are sent, so the first frame after connecting always carries every field.
+// Later minor versions only append fields, and receivers stop reading at the
+// first field they don't know.
+//
+// Since version 1.1 the standings follow the telemetry frame, one frame per row
+// which changed, as they're too large for a single frame:
+//
+//	type    byte    frameStanding
+//	row     uvarint index of the row
+//	values          the fields of hid.Standing, in order, with InPit a byte
+//
+// Receivers ignore frames of types they don't know, and frames are never larger
+// than MaxFrameSize.
+package bridge
+
+import (
+	"encoding/binary"
+	"math"
+	"unicode/utf8"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+const (
+	// VersionMajor changes when older receivers can't decode the frames
+	VersionMajor = 1
+
+	// VersionMinor changes when fields are appended
+	VersionMinor = 1
+
+	// MaxFrameSize is larger than any frame
+	MaxFrameSize = 256
+
+	// maxNameLen bytes of names are sent, so that every frame fits
+	maxNameLen = 40
+
+	// maxSplits are sent, which is more than any game times
+	maxSplits = 4
+
+	// maxStandings rows are kept by receivers, which is more than any grid
+	maxStandings = 256
+
+	frameTelemetry = 1
+	frameStanding  = 2
+)
+
+// hello is sent by the server on connecting, followed by the version
+var hello = [4]byte{'O', 'S', 'D', 'B'}
+
+// Capabilities of the source, ie. which optional packs it reports
+const (
+	CapEngine    = hid.CapEngine
+	CapStage     = hid.CapStage
+	CapLap       = hid.CapLap
+	CapPosition  = hid.CapPosition
+	CapFuel      = hid.CapFuel
+	CapTyre      = hid.CapTyre
+	CapIndicator = hid.CapIndicator
+	CapName      = hid.CapName
+	CapStandings = hid.CapStandings
+	CapSplits    = hid.CapSplits
+)
+
+// Field numbers, which are the bits of a frame's field mask
+const (
+	fieldCaps = iota
+	fieldGear
+	fieldRevLight
+	fieldSpeed
+	fieldRPM
+	fieldMaxRPM
+	fieldIdleRPM
+	fieldStageProgress
+	fieldStageDistance
+	fieldStageLength
+	fieldStageTime
+	fieldLap
+	fieldLapTime
+	fieldLastLapTime
+	fieldBestLapTime
+	fieldPosition
+	fieldFuel
+	fieldFuelCapacity
+	fieldTyreTemps                       // Four fields
+	fieldBrakeTemps = fieldTyreTemps + 4 // Four fields
+	fieldIndicators = fieldBrakeTemps + 4
+	fieldStageName  = fieldIndicators + 1
+	fieldCarName    = fieldStageName + 1
+	fieldCarCount   = fieldCarName + 1
+	fieldNumSplits  = fieldCarCount + 1
+	fieldSplits     = fieldNumSplits + 1 // maxSplits fields
+	numFields       = fieldSplits + maxSplits
+)
+
+// Model is a snapshot of every value in the telemetry model.  Values for packs
+// the source doesn't implement are zero.
+type Model struct {
+	Caps          uint32
+	Gear          int32
+	RevLight      int32
+	Speed         int32
+	RPM           int32
+	MaxRPM        int32
+	IdleRPM       int32
+	StageProgress float32
+	StageDistance float32
+	StageLength   float32
+	StageTime     float32
+	Lap           int32
+	LapTime       float32
+	LastLapTime   float32
+	BestLapTime   float32
+	Position      int32
+	Fuel          float32
+	FuelCapacity  float32
+	TyreTemps     [4]float32
+	BrakeTemps    [4]float32
+	Indicators    uint32
+	StageName     string
+	CarName       string
+	CarCount      int32
+	NumSplits     int32
+	Splits        [maxSplits]float32
+}
+
+// Capture a snapshot of p
+func (m *Model) Capture(p hid.TelemetryPack) {
+	*m = Model{
+		Gear:     int32(p.GetGear()),
+		RevLight: int32(p.GetRevLightPercent()),
+		Speed:    int32(p.GetSpeed()),
+	}
+	if e, ok := p.(hid.EnginePack); ok && hid.Reports(p, CapEngine) {
+		m.Caps |= CapEngine
+		m.RPM, m.MaxRPM, m.IdleRPM = int32(e.GetRPM()), int32(e.GetMaxRPM()), int32(e.GetIdleRPM())
+	}
+	if s, ok := p.(hid.StagePack); ok && hid.Reports(p, CapStage) {
+		m.Caps |= CapStage
+		m.StageProgress, m.StageDistance = s.GetStageProgress(), s.GetStageDistance()
+		m.StageLength, m.StageTime = s.GetStageLength(), s.GetStageTime()
+	}
+	if l, ok := p.(hid.LapPack); ok && hid.Reports(p, CapLap) {
+		m.Caps |= CapLap
+		m.Lap, m.LapTime = int32(l.GetLap()), l.GetLapTime()
+		m.LastLapTime, m.BestLapTime = l.GetLastLapTime(), l.GetBestLapTime()
+	}
+	if pos, ok := p.(hid.PositionPack); ok && hid.Reports(p, CapPosition) {
+		m.Caps |= CapPosition
+		m.Position = int32(pos.GetPosition())
+	}
+	if f, ok := p.(hid.FuelPack); ok && hid.Reports(p, CapFuel) {
+		m.Caps |= CapFuel
+		m.Fuel, m.FuelCapacity = f.GetFuel(), f.GetFuelCapacity()
+	}
+	if t, ok := p.(hid.TyrePack); ok && hid.Reports(p, CapTyre) {
+		m.Caps |= CapTyre
+		m.TyreTemps, m.BrakeTemps = t.GetTyreTemps(), t.GetBrakeTemps()
+	}
+	if i, ok := p.(hid.IndicatorPack); ok && hid.Reports(p, CapIndicator) {
+		m.Caps |= CapIndicator
+		m.Indicators = uint32(i.GetIndicators())
+	}
+	if n, ok := p.(hid.NamePack); ok && hid.Reports(p, CapName) {
+		m.Caps |= CapName
+		m.StageName, m.CarName = truncate(n.GetStageName()), truncate(n.GetCarName())
+	}
+	if s, ok := p.(hid.StandingsPack); ok && hid.Reports(p, CapStandings) {
+		m.Caps |= CapStandings
+		m.CarCount = int32(s.GetCarCount())
+	}
+	if s, ok := p.(hid.SplitPack); ok && hid.Reports(p, CapSplits) {
+		m.Caps |= CapSplits
+		splits := s.GetSplits()
+		if len(splits) > maxSplits {
+			splits = splits[:maxSplits]
+		}
+		m.NumSplits = int32(copy(m.Splits[:], splits))
+	}
+}
+
+// truncate a name to maxNameLen bytes, without splitting a character
+func truncate(s string) string {
+	if len(s) <= maxNameLen {
+		return s
+	}
+	n := maxNameLen
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// ints and floats point at the model's fields by field number, so encoding and
+// decoding share a single table.
+func (m *Model) ints() [numFields]*int32 {
+	var f [numFields]*int32
+	f[fieldGear] = &m.Gear
+	f[fieldRevLight] = &m.RevLight
+	f[fieldSpeed] = &m.Speed
+	f[fieldRPM] = &m.RPM
+	f[fieldMaxRPM] = &m.MaxRPM
+	f[fieldIdleRPM] = &m.IdleRPM
+	f[fieldLap] = &m.Lap
+	f[fieldPosition] = &m.Position
+	f[fieldCarCount] = &m.CarCount
+	f[fieldNumSplits] = &m.NumSplits
+	return f
+}
+
+func (m *Model) floats() [numFields]*float32 {
+	var f [numFields]*float32
+	f[fieldStageProgress] = &m.StageProgress
+	f[fieldStageDistance] = &m.StageDistance
+	f[fieldStageLength] = &m.StageLength
+	f[fieldStageTime] = &m.StageTime
+	f[fieldLapTime] = &m.LapTime
+	f[fieldLastLapTime] = &m.LastLapTime
+	f[fieldBestLapTime] = &m.BestLapTime
+	f[fieldFuel] = &m.Fuel
+	f[fieldFuelCapacity] = &m.FuelCapacity
+	for i := 0; i < 4; i++ {
+		f[fieldTyreTemps+i] = &m.TyreTemps[i]
+		f[fieldBrakeTemps+i] = &m.BrakeTemps[i]
+	}
+	for i := range m.Splits {
+		f[fieldSplits+i] = &m.Splits[i]
+	}
+	return f
+}
+
+// uints are the unsigned fields, which are sent as uvarints
+func (m *Model) uints() [numFields]*uint32 {
+	var f [numFields]*uint32
+	f[fieldCaps] = &m.Caps
+	f[fieldIndicators] = &m.Indicators
+	return f
+}
+
+func (m *Model) strings() [numFields]*string {
+	var f [numFields]*string
+	f[fieldStageName] = &m.StageName
+	f[fieldCarName] = &m.CarName
+	return f
+}
+
+// AppendFrame appends a frame with the fields of m which differ from prev, or
+// every field if prev is nil.
+func (m *Model) AppendFrame(b []byte, prev *Model) []byte {
+	var mask uint64
+	mi, mf, mu, ms := m.ints(), m.floats(), m.uints(), m.strings()
+	var pi [numFields]*int32
+	var pf [numFields]*float32
+	var pu [numFields]*uint32
+	var ps [numFields]*string
+	if prev != nil {
+		pi, pf, pu, ps = prev.ints(), prev.floats(), prev.uints(), prev.strings()
+	}
+	for i := 0; i < numFields; i++ {
+		switch {
+		case prev == nil:
+		case mi[i] != nil && *mi[i] == *pi[i]:
+			continue
+		case mf[i] != nil && math.Float32bits(*mf[i]) == math.Float32bits(*pf[i]):
+			continue
+		case mu[i] != nil && *mu[i] == *pu[i]:
+			continue
+		case ms[i] != nil && *ms[i] == *ps[i]:
+			continue
+		}
+		mask |= 1 << uint(i)
+	}
+
+	var tmp [binary.MaxVarintLen64]byte
+	b = append(b, frameTelemetry)
+	b = append(b, tmp[:binary.PutUvarint(tmp[:], mask)]...)
+	for i := 0; i < numFields; i++ {
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		switch {
+		case mi[i] != nil:
+			b = append(b, tmp[:binary.PutVarint(tmp[:], int64(*mi[i]))]...)
+		case mf[i] != nil:
+			binary.LittleEndian.PutUint32(tmp[:], math.Float32bits(*mf[i]))
+			b = append(b, tmp[:4]...)
+		case mu[i] != nil:
+			b = append(b, tmp[:binary.PutUvarint(tmp[:], uint64(*mu[i]))]...)
+		case ms[i] != nil:
+			b = appendString(b, *ms[i])
+		}
+	}
+	return b
+}
+
+func appendString(b []byte, s string) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	b = append(b, tmp[:binary.PutUvarint(tmp[:], uint64(len(s)))]...)
+	return append(b, s...)
+}
+
+// readString of up to maxNameLen bytes from the start of b, returning the rest
+// of b, or false if it's truncated
+func readString(b []byte) (string, []byte, bool) {
+	n, i := binary.Uvarint(b)
+	if i <= 0 || n > maxNameLen || uint64(len(b)-i) < n {
+		return "", nil, false
+	}
+	return string(b[i : i+int(n)]), b[i+int(n):], true
+}
+
+// ApplyFrame updates m with the fields of a frame.  Frames which are truncated
+// or of an unknown type are ignored, though fields before the truncation are
+// still applied.
+func (m *Model) ApplyFrame(b []byte) {
+	if len(b) < 1 || b[0] != frameTelemetry {
+		return
+	}
+	b = b[1:]
+	mask, n := binary.Uvarint(b)
+	if n <= 0 {
+		return
+	}
+	b = b[n:]
+	mi, mf, mu, ms := m.ints(), m.floats(), m.uints(), m.strings()
+	for i := 0; i < numFields; i++ {
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		switch {
+		case mi[i] != nil:
+			v, n := binary.Varint(b)
+			if n <= 0 {
+				return
+			}
+			*mi[i], b = int32(v), b[n:]
+		case mf[i] != nil:
+			if len(b) < 4 {
+				return
+			}
+			*mf[i], b = math.Float32frombits(binary.LittleEndian.Uint32(b)), b[4:]
+		case mu[i] != nil:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return
+			}
+			*mu[i], b = uint32(v), b[n:]
+		case ms[i] != nil:
+			s, rest, ok := readString(b)
+			if !ok {
+				return
+			}
+			*ms[i], b = s, rest
+		}
+	}
+}
+
+// appendStanding appends a frame with row i of the standings
+func appendStanding(b []byte, i int, s *hid.Standing) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	b = append(b, frameStanding)
+	b = append(b, tmp[:binary.PutUvarint(tmp[:], uint64(i))]...)
+	for _, v := range []int{s.Position, s.CarIndex, s.RaceNumber} {
+		b = append(b, tmp[:binary.PutVarint(tmp[:], int64(v))]...)
+	}
+	b = appendString(b, truncate(s.Driver))
+	b = append(b, tmp[:binary.PutVarint(tmp[:], int64(s.Laps))]...)
+	for _, f := range []float32{s.GapToLeader, s.GapAhead, s.LastLapTime, s.BestLapTime} {
+		binary.LittleEndian.PutUint32(tmp[:], math.Float32bits(f))
+		b = append(b, tmp[:4]...)
+	}
+	if s.InPit {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+// applyStanding updates standings with a standing frame, returning them
+// unchanged if it's truncated
+func applyStanding(standings []hid.Standing, b []byte) []hid.Standing {
+	row, n := binary.Uvarint(b[1:])
+	if n <= 0 || row >= maxStandings {
+		return standings
+	}
+	b = b[1+n:]
+
+	var s hid.Standing
+	for _, v := range []*int{&s.Position, &s.CarIndex, &s.RaceNumber} {
+		x, n := binary.Varint(b)
+		if n <= 0 {
+			return standings
+		}
+		*v, b = int(x), b[n:]
+	}
+	driver, b, ok := readString(b)
+	if !ok {
+		return standings
+	}
+	s.Driver = driver
+	laps, n := binary.Varint(b)
+	if n <= 0 || len(b)-n < 4*4+1 {
+		return standings
+	}
+	s.Laps, b = int(laps), b[n:]
+	for _, f := range []*float32{&s.GapToLeader, &s.GapAhead, &s.LastLapTime, &s.BestLapTime} {
+		*f, b = math.Float32frombits(binary.LittleEndian.Uint32(b)), b[4:]
+	}
+	s.InPit = b[0] != 0
+
+	for uint64(len(standings)) <= row {
+		standings = append(standings, hid.Standing{})
+	}
+	standings[row] = s
+	return standings
+}
+
+// Pack is the receiving end's telemetry model.  It decodes frames, so it can be
+// used as the Decodable for a Client just like a game's packet, and implements
+// every optional pack; as a hid.CapsPack, Has tells which ones the source
+// actually sent.
+type Pack struct {
+	Model
+	standings []hid.Standing
+}
+
+// Size of the largest frame
+func (p *Pack) Size() int {
+	return MaxFrameSize
+}
+
+// Decode a frame
+func (p *Pack) Decode(b []byte) {
+	if len(b) > 0 && b[0] == frameStanding {
+		p.standings = applyStanding(p.standings, b)
+		return
+	}
+	p.ApplyFrame(b)
+}
+
+// Has reports whether the source implemented all of the capabilities
+func (p *Pack) Has(caps uint32) bool {
+	return p.Caps&caps == caps
+}
+
+func (p *Pack) GetGear() int {
+	return int(p.Gear)
+}
+
+func (p *Pack) GetRevLightPercent() int {
+	return int(p.RevLight)
+}
+
+func (p *Pack) GetSpeed() int {
+	return int(p.Speed)
+}
+
+func (p *Pack) GetRPM() int {
+	return int(p.RPM)
+}
+
+func (p *Pack) GetMaxRPM() int {
+	return int(p.MaxRPM)
+}
+
+func (p *Pack) GetIdleRPM() int {
+	return int(p.IdleRPM)
+}
+
+func (p *Pack) GetStageProgress() float32 {
+	return p.StageProgress
+}
+
+func (p *Pack) GetStageDistance() float32 {
+	return p.StageDistance
+}
+
+func (p *Pack) GetStageLength() float32 {
+	return p.StageLength
+}
+
+func (p *Pack) GetStageTime() float32 {
+	return p.StageTime
+}
+
+func (p *Pack) GetLap() int {
+	return int(p.Lap)
+}
+
+func (p *Pack) GetLapTime() float32 {
+	return p.LapTime
+}
+
+func (p *Pack) GetLastLapTime() float32 {
+	return p.LastLapTime
+}
+
+func (p *Pack) GetBestLapTime() float32 {
+	return p.BestLapTime
+}
+
+func (p *Pack) GetPosition() int {
+	return int(p.Position)
+}
+
+func (p *Pack) GetFuel() float32 {
+	return p.Fuel
+}
+
+func (p *Pack) GetFuelCapacity() float32 {
+	return p.FuelCapacity
+}
+
+func (p *Pack) GetTyreTemps() [4]float32 {
+	return p.TyreTemps
+}
+
+func (p *Pack) GetBrakeTemps() [4]float32 {
+	return p.BrakeTemps
+}
+
+func (p *Pack) GetIndicators() hid.Indicators {
+	return hid.Indicators(p.Indicators)
+}
+
+func (p *Pack) GetStageName() string {
+	return p.StageName
+}
+
+func (p *Pack) GetCarName() string {
+	return p.CarName
+}
+
+// GetStandings received so far, up to the car count
+func (p *Pack) GetStandings() []hid.Standing {
+	if n := int(p.CarCount); n >= 0 && n < len(p.standings) {
+		return p.standings[:n]
+	}
+	return p.standings
+}
+
+func (p *Pack) GetCarCount() int {
+	return int(p.CarCount)
+}
+
+func (p *Pack) GetSplits() []float32 {
+	if p.NumSplits < 0 || p.NumSplits > maxSplits {
+		return nil
+	}
+	return p.Splits[:p.NumSplits]
+}
@@ -0,0 +1,180 @@
+package bridge
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+const (
+	// DefaultAddress the server listens on when the address is empty
+	DefaultAddress = ":20779"
+
+	// Receivers which can't accept a frame within writeTimeout are dropped, so
+	// that a stalled receiver doesn't hold up the others
+	writeTimeout = 100 * time.Millisecond
+
+	// TCP keepalives notice receivers which vanished without hanging up
+	keepAlive = 10 * time.Second
+)
+
+// ErrClosed is returned once a Server or Client is closed
+var ErrClosed = errors.New("bridge: closed")
+
+// receiver is a connected Client, and the model and standings it was last sent
+type receiver struct {
+	conn      net.Conn
+	prev      Model
+	standings []hid.Standing
+	sent      bool
+}
+
+// Server sends the telemetry model to every connected receiver.  SendPack
+// makes it usable anywhere opensimdash sends packs to devices.
+type Server struct {
+	ln     net.Listener
+	logger *log.Logger
+
+	mu        sync.Mutex
+	receivers []*receiver
+	model     Model
+	standings []hid.Standing
+	buf       []byte
+	closed    bool
+}
+
+// NewServer listens for receivers on address, DefaultAddress if empty
+func NewServer(address string, logger *log.Logger) (*Server, error) {
+	if address == "" {
+		address = DefaultAddress
+	}
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ln: ln, logger: logger, buf: make([]byte, 0, MaxFrameSize+2)}
+	go s.accept()
+	return s, nil
+}
+
+// Addr receivers connect to
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetNoDelay(true)
+			tcp.SetKeepAlive(true)
+			tcp.SetKeepAlivePeriod(keepAlive)
+		}
+
+		var h [6]byte
+		copy(h[:], hello[:])
+		h[4], h[5] = VersionMajor, VersionMinor
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := conn.Write(h[:]); err != nil {
+			conn.Close()
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.receivers = append(s.receivers, &receiver{conn: conn})
+		s.mu.Unlock()
+		s.logf("Bridge receiver connected %v", conn.RemoteAddr())
+	}
+}
+
+// SendPack sends the fields of p which changed, and the rows of its standings
+// which changed, to every receiver.  Receivers which fail to keep up are
+// disconnected, and may reconnect.
+func (s *Server) SendPack(p hid.TelemetryPack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.model.Capture(p)
+	s.standings = s.standings[:0]
+	if sp, ok := p.(hid.StandingsPack); ok && hid.Reports(p, CapStandings) {
+		s.standings = append(s.standings, sp.GetStandings()...)
+		if len(s.standings) > maxStandings {
+			s.standings = s.standings[:maxStandings]
+		}
+	}
+	i := 0
+	for _, r := range s.receivers {
+		var prev *Model
+		if r.sent {
+			prev = &r.prev
+		}
+		b := s.model.AppendFrame(append(s.buf[:0], 0, 0), prev)
+		setLength(b, 0)
+		for j := range s.standings {
+			if r.sent && j < len(r.standings) && r.standings[j] == s.standings[j] {
+				continue
+			}
+			n := len(b)
+			b = appendStanding(append(b, 0, 0), j, &s.standings[j])
+			setLength(b, n)
+		}
+		s.buf = b
+		r.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := r.conn.Write(b); err != nil {
+			s.logf("Bridge receiver disconnected %v: %v", r.conn.RemoteAddr(), err)
+			r.conn.Close()
+			continue
+		}
+		r.prev, r.sent = s.model, true
+		r.standings = append(r.standings[:0], s.standings...)
+		s.receivers[i] = r
+		i++
+	}
+	for j := i; j < len(s.receivers); j++ {
+		s.receivers[j] = nil
+	}
+	s.receivers = s.receivers[:i]
+}
+
+// setLength of the frame at b[n:], which starts with room for it
+func setLength(b []byte, n int) {
+	binary.BigEndian.PutUint16(b[n:], uint16(len(b)-n-2))
+}
+
+// Close the listener and disconnect every receiver
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	s.closed = true
+	for _, r := range s.receivers {
+		r.conn.Close()
+	}
+	s.receivers = nil
+	return s.ln.Close()
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+
+	"github.com/jake-dog/opensimdash/pcap"
+)
+
+var (
+	pcapPort   = flag.Int("pcap-port", 0, "only replay or export datagrams to or from this UDP port")
+	pcapHost   = flag.String("pcap-host", "", "only replay or export datagrams to or from this address")
+	pcapSpeed  = flag.Float64("pcap-speed", 1, "replay speed of a pcap source, or 0 for as fast as possible")
+	pcapExport = flag.String("pcap-export", "", "convert the pcap source to length prefixed datagrams in this file, then exit; capture times aren't kept")
+)
+
+func pcapFilter() pcap.Filter {
+	f := pcap.Filter{Port: *pcapPort}
+	if *pcapHost != "" {
+		f.Host = net.ParseIP(*pcapHost)
+	}
+	return f
+}
+
+// openReplay opens a pcap or pcapng capture as a telemetry source
+func openReplay(path string) (Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rp, err := pcap.NewReplay(f, pcapFilter())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	rp.Speed = *pcapSpeed
+	return rp, nil
+}
+
+// exportCapture converts a pcap or pcapng capture to the framing read by
+// stdin, file and fifo sources, returning the number of datagrams written.
+// The capture times are lost, so only a pcap source replays in real time.
+func exportCapture(path, out string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r, err := pcap.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+	w, err := os.Create(out)
+	if err != nil {
+		return 0, err
+	}
+	n, err := pcap.Export(w, r, pcapFilter())
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
@@ -17,7 +17,7 @@ const (
 	mslashs float32 = 2.23694
 )
 
-// DirtPacket is a bit shy of 264 bytes, so clearly missing some data.
+// DirtPacket is the full 264 byte packet sent when extradata=3.
 type DirtPacket struct {
 	Time           float32
 	LapTime        float32
@@ -81,8 +81,8 @@ type DirtPacket struct {
 	Track_size    float32 // track size meters
 	Last_lap_time float32 // last lap time
 	Max_rpm       float32 // cars max RPM, at which point the rev limiter will kick in
-	//Idle_rpm               float32    // cars idle RPM
-	//Max_gears              float32    // maximum number of gears
+	Idle_rpm      float32 // cars idle RPM
+	Max_gears     float32 // maximum number of gears
 	//SessionType            float32    // 0 = unknown, 1 = practice, 2 = qualifying, 3 = race
 	//DrsAllowed             float32    // 0 = not allowed, 1 = allowed, -1 = invalid / unknown
 	//Track_number           float32    // -1 for unknown, 0-21 for tracks
@@ -105,10 +105,82 @@ func (p *DirtPacket) GetSpeed() int {
 	return int(p.Speed * mslashs)
 }
 
+// GetRPM converts EngineRate, which Dirt Rally reports in tens of RPM
+func (p *DirtPacket) GetRPM() int {
+	return int(p.EngineRate * 10)
+}
+
+func (p *DirtPacket) GetMaxRPM() int {
+	return int(p.Max_rpm * 10)
+}
+
+func (p *DirtPacket) GetIdleRPM() int {
+	return int(p.Idle_rpm * 10)
+}
+
+func (p *DirtPacket) GetStageProgress() float32 {
+	if p.Track_size <= 0 {
+		return 0
+	}
+	return p.LapDistance / p.Track_size
+}
+
+func (p *DirtPacket) GetStageDistance() float32 {
+	return p.LapDistance
+}
+
+func (p *DirtPacket) GetStageLength() float32 {
+	return p.Track_size
+}
+
+func (p *DirtPacket) GetStageTime() float32 {
+	return p.LapTime
+}
+
+func (p *DirtPacket) GetLap() int {
+	return int(p.Lap)
+}
+
+func (p *DirtPacket) GetLapTime() float32 {
+	return p.LapTime
+}
+
+func (p *DirtPacket) GetLastLapTime() float32 {
+	return p.Last_lap_time
+}
+
+// GetBestLapTime is always zero since Dirt Rally doesn't send it
+func (p *DirtPacket) GetBestLapTime() float32 {
+	return 0
+}
+
+func (p *DirtPacket) GetFuel() float32 {
+	return p.Fuel_in_tank
+}
+
+func (p *DirtPacket) GetFuelCapacity() float32 {
+	return p.Fuel_capacity
+}
+
+// GetTyreTemps is always zero since Dirt Rally doesn't send them
+func (p *DirtPacket) GetTyreTemps() [4]float32 {
+	return [4]float32{}
+}
+
+// GetBrakeTemps reorders Brakes_temp, which like every other wheel field is
+// sent rear left, rear right, front left, front right.
+func (p *DirtPacket) GetBrakeTemps() [4]float32 {
+	return [4]float32{p.Brakes_temp[2], p.Brakes_temp[3], p.Brakes_temp[0], p.Brakes_temp[1]}
+}
+
 // Decode converts a little endian byte array into a DirtPacket.  Although this
 // is fairly verbose, it is far far faster than using binary.Read() since it
-// involves no allocations or reflection.
+// involves no allocations or reflection.  Datagrams shorter than DirtPacketSize
+// (extradata less than 3) are ignored.
 func (p *DirtPacket) Decode(b []byte) {
+	if len(b) < DirtPacketSize {
+		return
+	}
 	_ = b[263] // bounds check hint to compiler; see golang.org/issue/14808
 	p.Time = math.Float32frombits(binary.LittleEndian.Uint32(b[:4]))
 	p.LapTime = math.Float32frombits(binary.LittleEndian.Uint32(b[4:8]))
@@ -174,4 +246,6 @@ func (p *DirtPacket) Decode(b []byte) {
 	p.Track_size = math.Float32frombits(binary.LittleEndian.Uint32(b[244:248]))
 	p.Last_lap_time = math.Float32frombits(binary.LittleEndian.Uint32(b[248:252]))
 	p.Max_rpm = math.Float32frombits(binary.LittleEndian.Uint32(b[252:256]))
+	p.Idle_rpm = math.Float32frombits(binary.LittleEndian.Uint32(b[256:260]))
+	p.Max_gears = math.Float32frombits(binary.LittleEndian.Uint32(b[260:264]))
 }
@@ -3,6 +3,7 @@ package codemasters
 import (
 	"bytes"
 	"encoding/binary"
+	"strings"
 	"testing"
 )
 
@@ -39,3 +40,40 @@ func BenchmarkDirtRallySlow(b *testing.B) {
 		buf.Reset()
 	}
 }
+
+func TestIdentify(t *testing.T) {
+	db, err := LoadDatabase(strings.NewReader(`{
+		"Stages": [
+			{"Location": "Test", "Name": "Forward", "Length": 991.1, "Start": [30, 160, -250]},
+			{"Location": "Test", "Name": "Reverse", "Length": 991.1, "Start": [-500, 100, 400]}
+		],
+		"Cars": [
+			{"Name": "Slow", "MaxRPM": 700, "IdleRPM": 209.4, "Gears": 6},
+			{"Name": "Fast", "MaxRPM": 874.4, "IdleRPM": 209.4, "Gears": 6}
+		]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &DirtPacket{}
+	d.Decode(data)
+
+	if s, ok := db.Stage(d); !ok || s.String() != "Test – Forward" {
+		t.Errorf("Stage = %v, %v", s, ok)
+	}
+	if c, ok := db.Car(d); !ok || c.Name != "Fast" {
+		t.Errorf("Car = %v, %v", c, ok)
+	}
+
+	d.Track_size = 5000
+	if s, ok := db.Stage(d); ok {
+		t.Errorf("Unexpected stage %v", s)
+	}
+
+	// Away from the start line the stage can't be told apart
+	d.Track_size = 991.1
+	d.X += 100
+	if s, ok := db.Stage(d); ok {
+		t.Errorf("Stage away from the start = %v", s)
+	}
+}
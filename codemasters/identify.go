@@ -0,0 +1,152 @@
+package codemasters
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+const (
+	// Track_size is reported with float precision, so allow a little slack
+	trackSizeTolerance float32 = 0.5
+
+	// Max_rpm and Idle_rpm are reported in tens of RPM
+	rpmTolerance float32 = 0.5
+
+	// startTolerance is how far in meters the car may be from a stage's start
+	// line, as cars are lined up a little behind it
+	startTolerance float32 = 25
+)
+
+// Stage is the signature of a Dirt Rally stage.  Dirt Rally doesn't send the
+// track name, but the Track_size together with the position of the car at the
+// start line is unique per stage (forward and reverse stages share a length).
+type Stage struct {
+	Location string
+	Name     string
+	Length   float32    // Track_size in meters
+	Start    [3]float32 // X, Y, Z world space position at the start line
+}
+
+func (s Stage) String() string {
+	return s.Location + " – " + s.Name
+}
+
+// Car is the signature of a Dirt Rally car, which is identified by the engine
+// characteristics sent in every packet.
+type Car struct {
+	Name    string
+	MaxRPM  float32 // Max_rpm as reported by the game (RPM / 10)
+	IdleRPM float32 // Idle_rpm as reported by the game (RPM / 10)
+	Gears   int
+}
+
+func (c Car) String() string {
+	return c.Name
+}
+
+// Database maps DirtPacket signatures to stage and car names.  The zero value
+// is an empty database which is safe for concurrent use.
+type Database struct {
+	mu     sync.RWMutex
+	stages []Stage
+	cars   []Car
+}
+
+// DirtDatabase is the default database used by IdentifyStage and IdentifyCar.
+// No signatures are built in, since none have been verified against the game,
+// so it's empty until replaced with one from LoadDatabase.
+var DirtDatabase = &Database{}
+
+// LoadDatabase reads a JSON document of the form {"Stages":[...],"Cars":[...]}
+// and returns a new Database containing its entries.
+func LoadDatabase(r io.Reader) (*Database, error) {
+	var doc struct {
+		Stages []Stage
+		Cars   []Car
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	db := &Database{}
+	db.AddStage(doc.Stages...)
+	db.AddCar(doc.Cars...)
+	return db, nil
+}
+
+// AddStage signatures to the database.
+func (db *Database) AddStage(s ...Stage) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.stages = append(db.stages, s...)
+}
+
+// AddCar signatures to the database.
+func (db *Database) AddCar(c ...Car) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.cars = append(db.cars, c...)
+}
+
+// Stage returns the stage matching the packet's Track_size whose start line is
+// closest to the car, within startTolerance, so the packet must be taken at the
+// start of the stage.
+func (db *Database) Stage(p *DirtPacket) (Stage, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var (
+		found bool
+		best  Stage
+		dist  float32
+	)
+	for _, s := range db.stages {
+		if abs(s.Length-p.Track_size) > trackSizeTolerance {
+			continue
+		}
+		dx, dy, dz := s.Start[0]-p.X, s.Start[1]-p.Y, s.Start[2]-p.Z
+		d := dx*dx + dy*dy + dz*dz
+		if d > startTolerance*startTolerance {
+			continue
+		}
+		if !found || d < dist {
+			found, best, dist = true, s, d
+		}
+	}
+	return best, found
+}
+
+// Car returns the first car matching the packet's Max_rpm, Idle_rpm and
+// Max_gears.
+func (db *Database) Car(p *DirtPacket) (Car, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, c := range db.cars {
+		if abs(c.MaxRPM-p.Max_rpm) <= rpmTolerance &&
+			abs(c.IdleRPM-p.Idle_rpm) <= rpmTolerance &&
+			c.Gears == int(p.Max_gears) {
+			return c, true
+		}
+	}
+	return Car{}, false
+}
+
+// IdentifyStage using the default DirtDatabase.
+func IdentifyStage(p *DirtPacket) (Stage, bool) {
+	return DirtDatabase.Stage(p)
+}
+
+// IdentifyCar using the default DirtDatabase.
+func IdentifyCar(p *DirtPacket) (Car, bool) {
+	return DirtDatabase.Car(p)
+}
+
+func abs(f float32) float32 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,302 @@
+package codemasters
+
+// EA SPORTS WRC doesn't have a fixed packet layout.  Instead the game reads a
+// "packet structure" file (Documents/My Games/WRC/telemetry/udp/*.json) which
+// lists the channels to send, and in which order, from the catalogue of all
+// channels (Documents/My Games/WRC/telemetry/readme/channels.json).
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// WRC channels mapped onto the telemetry model
+const (
+	wrcGear          = "vehicle_gear_index"
+	wrcGearNeutral   = "vehicle_gear_index_neutral"
+	wrcGearReverse   = "vehicle_gear_index_reverse"
+	wrcSpeed         = "vehicle_speed"
+	wrcRPM           = "vehicle_engine_rpm_current"
+	wrcMaxRPM        = "vehicle_engine_rpm_max"
+	wrcIdleRPM       = "vehicle_engine_rpm_idle"
+	wrcShiftStart    = "shiftlights_rpm_start"
+	wrcShiftEnd      = "shiftlights_rpm_end"
+	wrcShiftValid    = "shiftlights_rpm_valid"
+	wrcStageProgress = "stage_progress"
+	wrcStageDistance = "stage_current_distance"
+	wrcStageLength   = "stage_length"
+	wrcStageTime     = "stage_current_time"
+)
+
+// WRCChannel is a single entry of the WRC channel catalogue
+type WRCChannel struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Units       string `json:"units"`
+	Description string `json:"description"`
+}
+
+// WRCPacketStructure is a single packet definition from a WRC structure file
+type WRCPacketStructure struct {
+	ID     string `json:"id"`
+	FourCC string `json:"fourCC"`
+	Header struct {
+		Channels []string `json:"channels"`
+	} `json:"header"`
+	Channels []string `json:"channels"`
+}
+
+type wrcField struct {
+	offset int
+	kind   string
+	slot   int
+}
+
+type wrcLayout struct {
+	fourcc uint32
+	size   int
+	fields []wrcField
+}
+
+// WRCPacket decodes any of the packets described by a WRC structure file.
+// Values are stored by channel and can be retrieved with Value, while the
+// channels opensimdash understands are exposed through the TelemetryPack
+// getters.  Channels not present in the structure read as zero.
+type WRCPacket struct {
+	// FourCC of the last decoded packet, eg. "sesu" for session_update
+	FourCC [4]byte
+
+	slots    map[string]int
+	values   []float64
+	received []bool // Whether each slot has been decoded yet
+	layouts  []wrcLayout
+	size     int
+}
+
+// NewWRCPacket reads the WRC channel catalogue and packet structure file and
+// returns a WRCPacket which can decode the datagrams they describe.
+func NewWRCPacket(channels, structure io.Reader) (*WRCPacket, error) {
+	var catalogue struct {
+		Channels []WRCChannel `json:"channels"`
+	}
+	if err := json.NewDecoder(channels).Decode(&catalogue); err != nil {
+		return nil, fmt.Errorf("wrc channels: %v", err)
+	}
+	var packets struct {
+		Packets []WRCPacketStructure `json:"packets"`
+	}
+	if err := json.NewDecoder(structure).Decode(&packets); err != nil {
+		return nil, fmt.Errorf("wrc structure: %v", err)
+	}
+	return NewWRCPacketFromStructure(catalogue.Channels, packets.Packets)
+}
+
+// NewWRCPacketFromStructure is the same as NewWRCPacket for already parsed
+// channel and packet definitions.
+func NewWRCPacketFromStructure(channels []WRCChannel, packets []WRCPacketStructure) (*WRCPacket, error) {
+	types := make(map[string]string, len(channels))
+	for _, c := range channels {
+		types[c.ID] = c.Type
+	}
+
+	p := &WRCPacket{slots: make(map[string]int)}
+	for _, pkt := range packets {
+		var l wrcLayout
+		if len(pkt.FourCC) == 4 {
+			l.fourcc = binary.LittleEndian.Uint32([]byte(pkt.FourCC))
+		}
+		ids := append(append([]string(nil), pkt.Header.Channels...), pkt.Channels...)
+		for _, id := range ids {
+			kind, ok := types[id]
+			if !ok {
+				return nil, fmt.Errorf("wrc packet %q: unknown channel %q", pkt.ID, id)
+			}
+			size := wrcTypeSize(kind)
+			if size == 0 {
+				return nil, fmt.Errorf("wrc channel %q: unsupported type %q", id, kind)
+			}
+			slot, ok := p.slots[id]
+			if !ok {
+				slot = len(p.slots)
+				p.slots[id] = slot
+			}
+			l.fields = append(l.fields, wrcField{offset: l.size, kind: kind, slot: slot})
+			l.size += size
+		}
+		if l.size > p.size {
+			p.size = l.size
+		}
+		p.layouts = append(p.layouts, l)
+	}
+	p.values = make([]float64, len(p.slots))
+	p.received = make([]bool, len(p.slots))
+	return p, nil
+}
+
+func wrcTypeSize(kind string) int {
+	switch kind {
+	case "boolean", "uint8", "int8":
+		return 1
+	case "uint16", "int16":
+		return 2
+	case "uint32", "int32", "float32", "fourcc":
+		return 4
+	case "uint64", "int64", "float64":
+		return 8
+	}
+	return 0
+}
+
+// Size of the largest packet in the structure
+func (p *WRCPacket) Size() int {
+	return p.size
+}
+
+// Decode a WRC datagram.  The packet layout is chosen by the four character
+// code at the start of the datagram, or if the structure only has a single
+// packet, that packet is always used.  Datagrams which don't match any packet
+// are ignored.
+func (p *WRCPacket) Decode(b []byte) {
+	if len(b) < 4 {
+		return
+	}
+	fourcc := binary.LittleEndian.Uint32(b[:4])
+
+	for i := range p.layouts {
+		l := &p.layouts[i]
+		if (l.fourcc != fourcc && len(p.layouts) > 1) || len(b) < l.size {
+			continue
+		}
+		copy(p.FourCC[:], b[:4])
+		for _, f := range l.fields {
+			p.values[f.slot] = wrcValue(f.kind, b[f.offset:])
+			p.received[f.slot] = true
+		}
+		return
+	}
+}
+
+func wrcValue(kind string, b []byte) float64 {
+	switch kind {
+	case "boolean", "uint8":
+		return float64(b[0])
+	case "int8":
+		return float64(int8(b[0]))
+	case "uint16":
+		return float64(binary.LittleEndian.Uint16(b))
+	case "int16":
+		return float64(int16(binary.LittleEndian.Uint16(b)))
+	case "uint32", "fourcc":
+		return float64(binary.LittleEndian.Uint32(b))
+	case "int32":
+		return float64(int32(binary.LittleEndian.Uint32(b)))
+	case "float32":
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case "uint64":
+		return float64(binary.LittleEndian.Uint64(b))
+	case "int64":
+		return float64(int64(binary.LittleEndian.Uint64(b)))
+	case "float64":
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+// Value of a channel from the most recently decoded packets
+func (p *WRCPacket) Value(id string) (float64, bool) {
+	slot, ok := p.slots[id]
+	if !ok {
+		return 0, false
+	}
+	return p.values[slot], true
+}
+
+func (p *WRCPacket) value(id string) float64 {
+	v, _ := p.Value(id)
+	return v
+}
+
+// decoded is the value of a channel, and false until a packet with it has been
+// decoded
+func (p *WRCPacket) decoded(id string) (float64, bool) {
+	slot, ok := p.slots[id]
+	if !ok || !p.received[slot] {
+		return 0, false
+	}
+	return p.values[slot], true
+}
+
+// GetGear returns 0 for neutral and -1 for reverse.  The neutral and reverse
+// gear indexes are sent in session_start, so until it's received the gear index
+// is returned as is.
+func (p *WRCPacket) GetGear() int {
+	gear := p.value(wrcGear)
+	if reverse, ok := p.decoded(wrcGearReverse); ok && gear == reverse {
+		return -1
+	}
+	if neutral, ok := p.decoded(wrcGearNeutral); ok && gear == neutral {
+		return 0
+	}
+	return int(gear)
+}
+
+// GetRevLightPercent follows the car's own shift lights when the game provides
+// their RPM range: 80% where the first of them lights, which is where devices
+// start lighting their LEDs, and 100% where they're all lit, at the point the
+// driver should shift.  Below the range it scales linearly with RPM.  Cars
+// without shift lights compare RPM against the engine's maximum RPM.
+func (p *WRCPacket) GetRevLightPercent() int {
+	rpm := p.value(wrcRPM)
+	if p.value(wrcShiftValid) == 0 {
+		max := p.value(wrcMaxRPM)
+		if max <= 0 {
+			return 0
+		}
+		return int(100 * rpm / max)
+	}
+	start, end := p.value(wrcShiftStart), p.value(wrcShiftEnd)
+	switch {
+	case end <= 0:
+		return 0
+	case start <= 0 || start >= end: // The structure may leave the start out
+		return int(100 * rpm / end)
+	case rpm < start:
+		return int(80 * rpm / start)
+	}
+	return int(80 + 20*(rpm-start)/(end-start))
+}
+
+func (p *WRCPacket) GetSpeed() int {
+	return int(p.value(wrcSpeed) * float64(mslashs))
+}
+
+func (p *WRCPacket) GetRPM() int {
+	return int(p.value(wrcRPM))
+}
+
+func (p *WRCPacket) GetMaxRPM() int {
+	return int(p.value(wrcMaxRPM))
+}
+
+func (p *WRCPacket) GetIdleRPM() int {
+	return int(p.value(wrcIdleRPM))
+}
+
+func (p *WRCPacket) GetStageProgress() float32 {
+	return float32(p.value(wrcStageProgress))
+}
+
+func (p *WRCPacket) GetStageDistance() float32 {
+	return float32(p.value(wrcStageDistance))
+}
+
+func (p *WRCPacket) GetStageLength() float32 {
+	return float32(p.value(wrcStageLength))
+}
+
+func (p *WRCPacket) GetStageTime() float32 {
+	return float32(p.value(wrcStageTime))
+}
@@ -0,0 +1,123 @@
+package codemasters
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+const wrcChannels = `{"versions": {"schema": 1, "data": 3}, "channels": [
+	{"id": "packet_4cc", "type": "fourcc"},
+	{"id": "packet_uid", "type": "uint64"},
+	{"id": "vehicle_gear_index", "type": "uint8"},
+	{"id": "vehicle_gear_index_neutral", "type": "uint8"},
+	{"id": "vehicle_gear_index_reverse", "type": "uint8"},
+	{"id": "vehicle_speed", "type": "float32"},
+	{"id": "vehicle_engine_rpm_current", "type": "float32"},
+	{"id": "shiftlights_rpm_end", "type": "float32"},
+	{"id": "shiftlights_rpm_valid", "type": "boolean"},
+	{"id": "stage_progress", "type": "float64"}]}`
+
+const wrcStructure = `{"id": "wrc", "packets": [
+	{"id": "session_start", "fourCC": "sess",
+	 "header": {"channels": ["packet_4cc", "packet_uid"]},
+	 "channels": ["vehicle_gear_index_neutral", "vehicle_gear_index_reverse"]},
+	{"id": "session_update", "fourCC": "sesu",
+	 "header": {"channels": ["packet_4cc", "packet_uid"]},
+	 "channels": ["vehicle_gear_index", "vehicle_speed", "vehicle_engine_rpm_current",
+	              "shiftlights_rpm_end", "shiftlights_rpm_valid", "stage_progress"]}]}`
+
+func TestWRCPacket(t *testing.T) {
+	p, err := NewWRCPacket(strings.NewReader(wrcChannels), strings.NewReader(wrcStructure))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Size() != 34 {
+		t.Errorf("Size = %d", p.Size())
+	}
+
+	// Neutral isn't mistaken for reverse before session_start
+	update := append([]byte("sesu"), make([]byte, 30)...)
+	p.Decode(update)
+	if g := p.GetGear(); g != 0 {
+		t.Errorf("GetGear before session_start = %d", g)
+	}
+
+	start := append([]byte("sess"), make([]byte, 10)...)
+	start[12], start[13] = 0, 9 // neutral, reverse
+	p.Decode(start)
+
+	update[12] = 3
+	binary.LittleEndian.PutUint32(update[13:], math.Float32bits(10))
+	binary.LittleEndian.PutUint32(update[17:], math.Float32bits(6000))
+	binary.LittleEndian.PutUint32(update[21:], math.Float32bits(7500))
+	update[25] = 1
+	binary.LittleEndian.PutUint64(update[26:], math.Float64bits(0.25))
+	p.Decode(update)
+
+	if string(p.FourCC[:]) != "sesu" {
+		t.Errorf("FourCC = %q", p.FourCC)
+	}
+	if g := p.GetGear(); g != 3 {
+		t.Errorf("GetGear = %d", g)
+	}
+	if s := p.GetSpeed(); s != 22 {
+		t.Errorf("GetSpeed = %d", s)
+	}
+	if r := p.GetRevLightPercent(); r != 80 {
+		t.Errorf("GetRevLightPercent = %d", r)
+	}
+	if s := p.GetStageProgress(); s != 0.25 {
+		t.Errorf("GetStageProgress = %f", s)
+	}
+
+	update[12] = 9
+	p.Decode(update)
+	if g := p.GetGear(); g != -1 {
+		t.Errorf("GetGear reverse = %d", g)
+	}
+}
+
+func TestWRCPacketUnknownChannel(t *testing.T) {
+	_, err := NewWRCPacket(strings.NewReader(wrcChannels), strings.NewReader(
+		`{"packets": [{"id": "x", "channels": ["nope"]}]}`))
+	if err == nil {
+		t.Error("Expected error for unknown channel")
+	}
+}
+
+func TestWRCShiftLights(t *testing.T) {
+	p, err := NewWRCPacket(strings.NewReader(`{"versions": {"schema": 1, "data": 3}, "channels": [
+		{"id": "packet_4cc", "type": "fourcc"},
+		{"id": "packet_uid", "type": "uint64"},
+		{"id": "vehicle_engine_rpm_current", "type": "float32"},
+		{"id": "shiftlights_rpm_start", "type": "float32"},
+		{"id": "shiftlights_rpm_end", "type": "float32"},
+		{"id": "shiftlights_rpm_valid", "type": "boolean"}]}`),
+		strings.NewReader(`{"id": "wrc", "packets": [
+		{"id": "session_update", "fourCC": "sesu",
+		 "header": {"channels": ["packet_4cc", "packet_uid"]},
+		 "channels": ["vehicle_engine_rpm_current", "shiftlights_rpm_start",
+		              "shiftlights_rpm_end", "shiftlights_rpm_valid"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := append([]byte("sesu"), make([]byte, 21)...)
+	binary.LittleEndian.PutUint32(update[16:], math.Float32bits(6000))
+	binary.LittleEndian.PutUint32(update[20:], math.Float32bits(7000))
+	update[24] = 1
+
+	// The shift lights' range is where the rev lights go from 80% to 100%
+	for _, tc := range []struct {
+		rpm  float32
+		want int
+	}{{3000, 40}, {6000, 80}, {6500, 90}, {7000, 100}} {
+		binary.LittleEndian.PutUint32(update[12:], math.Float32bits(tc.rpm))
+		p.Decode(update)
+		if r := p.GetRevLightPercent(); r != tc.want {
+			t.Errorf("%.0f RPM: GetRevLightPercent = %d, want %d", tc.rpm, r, tc.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+var (
+	hidBackend  = flag.String("hid-backend", "auto", "HID backend: auto, or one of "+strings.Join(hid.Backends(), ", "))
+	hidDevices  = flag.String("devices", "", "load HID device definitions from this JSON file instead of using the built-in definitions")
+	hidChannels = flag.String("hid-channels", "", "telemetry shown by each HID device which can show more than one, as SERIAL=CHANNEL pairs separated by commas")
+)
+
+// registerDevices registers the HID devices defined in the file at path, or
+// the default definitions if there's no path
+func registerDevices(path string) error {
+	var defs *hid.Definitions
+	var err error
+	if path == "" {
+		defs, err = hid.LoadDefinitions(strings.NewReader(hid.DefaultDefinitions))
+	} else {
+		var f *os.File
+		if f, err = os.Open(path); err != nil {
+			return err
+		}
+		defer f.Close()
+		if defs, err = hid.LoadDefinitions(f); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return defs.Register()
+}
+
+// assignChannels parses SERIAL=CHANNEL pairs, assigning each channel to the
+// HID device with that serial number
+func assignChannels(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			return fmt.Errorf("invalid HID channel %q, want SERIAL=CHANNEL", pair)
+		}
+		serial, c := pair[:i], hid.Channel(pair[i+1:])
+		if !c.Valid() {
+			return fmt.Errorf("unknown HID channel %q", c)
+		}
+		hid.AssignChannel(serial, c)
+	}
+	return nil
+}
+
+// hidStats serves the write statistics of each HID device as JSON
+func hidStats(r hid.HIDRegistrar) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Stats())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/jake-dog/opensimdash/codemasters"
+)
+
+var dirtDatabase = flag.String("dirt-database", "", "JSON file of Dirt Rally stage and car signatures, used to name them on the dash")
+
+// loadDirtDatabase replaces the default codemasters.DirtDatabase with the
+// signatures in the file at path
+func loadDirtDatabase(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := codemasters.LoadDatabase(f)
+	if err != nil {
+		return err
+	}
+	codemasters.DirtDatabase = db
+	return nil
+}
+
+// dirtPack is a DirtPacket which names the stage and car from the signature
+// database.  Names are only looked up again when the signature changes, or
+// for the stage when a new one starts, so a stage is identified from its first
+// packet, at the start line.  Unknown signatures are logged in the format of
+// the database, so that they can be added to it.
+type dirtPack struct {
+	*codemasters.DirtPacket
+
+	stageSize     float32
+	lapTime       float32 // LapTime of the last packet, which restarts with a stage
+	stage         string
+	carSignature  [3]float32
+	car           string
+	stageSearched bool
+	carSearched   bool
+}
+
+func newDirtPack() *dirtPack {
+	return &dirtPack{DirtPacket: &codemasters.DirtPacket{}}
+}
+
+func (p *dirtPack) GetStageName() string {
+	// Forward and reverse stages share a length, so restarting or starting the
+	// other one needs looking up again too
+	restarted := p.LapTime < p.lapTime
+	p.lapTime = p.LapTime
+	if !p.stageSearched || p.Track_size != p.stageSize || restarted {
+		p.stageSize, p.stage, p.stageSearched = p.Track_size, "", true
+		if s, ok := codemasters.IdentifyStage(p.DirtPacket); ok {
+			p.stage = s.String()
+		} else if p.Track_size > 0 {
+			log.Printf("Unknown Dirt Rally stage: {\"Length\": %.1f, \"Start\": [%.1f, %.1f, %.1f]}",
+				p.Track_size, p.X, p.Y, p.Z)
+		}
+	}
+	return p.stage
+}
+
+func (p *dirtPack) GetCarName() string {
+	sig := [3]float32{p.Max_rpm, p.Idle_rpm, p.Max_gears}
+	if !p.carSearched || sig != p.carSignature {
+		p.carSignature, p.car, p.carSearched = sig, "", true
+		if c, ok := codemasters.IdentifyCar(p.DirtPacket); ok {
+			p.car = c.String()
+		} else if p.Max_rpm > 0 {
+			log.Printf("Unknown Dirt Rally car: {\"MaxRPM\": %.1f, \"IdleRPM\": %.1f, \"Gears\": %d}",
+				p.Max_rpm, p.Idle_rpm, int(p.Max_gears))
+		}
+	}
+	return p.car
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jake-dog/opensimdash/codemasters"
+)
+
+func TestDirtNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opensimdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dirt.json")
+	err = ioutil.WriteFile(path, []byte(`{
+		"Stages": [{"Location": "Argentina", "Name": "Las Juntas", "Length": 8000, "Start": [0, 0, 0]}],
+		"Cars": [{"Name": "Lancia Stratos", "MaxRPM": 800, "IdleRPM": 100, "Gears": 5}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(db *codemasters.Database) { codemasters.DirtDatabase = db }(codemasters.DirtDatabase)
+	if err := loadDirtDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newDirtPack()
+	p.Track_size, p.Max_rpm, p.Idle_rpm, p.Max_gears = 8000, 800, 100, 5
+	if s, c := p.GetStageName(), p.GetCarName(); s != "Argentina – Las Juntas" || c != "Lancia Stratos" {
+		t.Errorf("stage %q, car %q", s, c)
+	}
+
+	// The reverse stage, of the same length, is looked up again when it starts
+	p.LapTime = 30
+	p.GetStageName()
+	p.LapTime, p.X = 0, 500
+	if s := p.GetStageName(); s != "" {
+		t.Errorf("reverse stage %q", s)
+	}
+
+	// A new stage and car are looked up again
+	p.Track_size, p.Max_gears = 9000, 6
+	if s, c := p.GetStageName(), p.GetCarName(); s != "" || c != "" {
+		t.Errorf("unknown stage %q, car %q", s, c)
+	}
+}
@@ -0,0 +1,324 @@
+// Package forza decodes the "Data Out" telemetry of Forza Motorsport and Forza
+// Horizon.  The games send either the "Sled" format, or the "Dash" format which
+// extends Sled with dashboard data.  Horizon inserts 12 unknown bytes between
+// the Sled and Dash data, so every format is told apart by datagram length.
+package forza
+
+// https://support.forzamotorsport.net/hc/en-us/articles/21742934024211-Forza-Motorsport-Data-Out-Documentation
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Format of a Data Out datagram, which is also its length
+type Format int
+
+const (
+	// SledSize is the size of the Sled format
+	SledSize = 232
+
+	// DashSize is the size of the Forza Motorsport 7 Dash format
+	DashSize = 311
+
+	// HorizonDashSize is the size of the Forza Horizon 4/5 Dash format
+	HorizonDashSize = 324
+
+	// MotorsportDashSize is the size of the Forza Motorsport (2023) Dash format,
+	// which appends tyre wear and the track to the FM7 Dash format
+	MotorsportDashSize = 331
+
+	// Bytes of unknown data Horizon inserts after the Sled data
+	horizonGap = 12
+
+	// Speed is sent in meters per second, so convert to MPH
+	mslashs float32 = 2.23694
+)
+
+// Formats
+const (
+	FormatNone           Format = 0
+	FormatSled           Format = SledSize
+	FormatDash           Format = DashSize
+	FormatHorizonDash    Format = HorizonDashSize
+	FormatMotorsportDash Format = MotorsportDashSize
+)
+
+// Sled is the motion data at the start of every Data Out datagram.  Wheels are
+// ordered front left, front right, rear left, rear right.
+type Sled struct {
+	IsRaceOn                   bool
+	TimestampMS                uint32
+	EngineMaxRpm               float32
+	EngineIdleRpm              float32
+	CurrentEngineRpm           float32
+	AccelerationX              float32
+	AccelerationY              float32
+	AccelerationZ              float32
+	VelocityX                  float32
+	VelocityY                  float32
+	VelocityZ                  float32
+	AngularVelocityX           float32
+	AngularVelocityY           float32
+	AngularVelocityZ           float32
+	Yaw                        float32
+	Pitch                      float32
+	Roll                       float32
+	NormalizedSuspensionTravel [4]float32
+	TireSlipRatio              [4]float32
+	WheelRotationSpeed         [4]float32
+	WheelOnRumbleStrip         [4]int32
+	WheelInPuddleDepth         [4]float32
+	SurfaceRumble              [4]float32
+	TireSlipAngle              [4]float32
+	TireCombinedSlip           [4]float32
+	SuspensionTravelMeters     [4]float32
+	CarOrdinal                 int32
+	CarClass                   int32
+	CarPerformanceIndex        int32
+	DrivetrainType             int32
+	NumCylinders               int32
+}
+
+func (s *Sled) Size() int {
+	return SledSize
+}
+
+// Decode the Sled data, ignoring datagrams which are too short
+func (s *Sled) Decode(b []byte) {
+	if len(b) < SledSize {
+		return
+	}
+	_ = b[SledSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	s.IsRaceOn = binary.LittleEndian.Uint32(b[0:4]) != 0
+	s.TimestampMS = binary.LittleEndian.Uint32(b[4:8])
+	s.EngineMaxRpm = float32At(b, 8)
+	s.EngineIdleRpm = float32At(b, 12)
+	s.CurrentEngineRpm = float32At(b, 16)
+	s.AccelerationX = float32At(b, 20)
+	s.AccelerationY = float32At(b, 24)
+	s.AccelerationZ = float32At(b, 28)
+	s.VelocityX = float32At(b, 32)
+	s.VelocityY = float32At(b, 36)
+	s.VelocityZ = float32At(b, 40)
+	s.AngularVelocityX = float32At(b, 44)
+	s.AngularVelocityY = float32At(b, 48)
+	s.AngularVelocityZ = float32At(b, 52)
+	s.Yaw = float32At(b, 56)
+	s.Pitch = float32At(b, 60)
+	s.Roll = float32At(b, 64)
+	for i := 0; i < 4; i++ {
+		s.NormalizedSuspensionTravel[i] = float32At(b, 68+4*i)
+		s.TireSlipRatio[i] = float32At(b, 84+4*i)
+		s.WheelRotationSpeed[i] = float32At(b, 100+4*i)
+		s.WheelOnRumbleStrip[i] = int32(binary.LittleEndian.Uint32(b[116+4*i:]))
+		s.WheelInPuddleDepth[i] = float32At(b, 132+4*i)
+		s.SurfaceRumble[i] = float32At(b, 148+4*i)
+		s.TireSlipAngle[i] = float32At(b, 164+4*i)
+		s.TireCombinedSlip[i] = float32At(b, 180+4*i)
+		s.SuspensionTravelMeters[i] = float32At(b, 196+4*i)
+	}
+	s.CarOrdinal = int32(binary.LittleEndian.Uint32(b[212:216]))
+	s.CarClass = int32(binary.LittleEndian.Uint32(b[216:220]))
+	s.CarPerformanceIndex = int32(binary.LittleEndian.Uint32(b[220:224]))
+	s.DrivetrainType = int32(binary.LittleEndian.Uint32(b[224:228]))
+	s.NumCylinders = int32(binary.LittleEndian.Uint32(b[228:232]))
+}
+
+// GetGear is always zero since Sled doesn't include the gear
+func (s *Sled) GetGear() int {
+	return 0
+}
+
+func (s *Sled) GetRevLightPercent() int {
+	if s.EngineMaxRpm <= 0 {
+		return 0
+	}
+	return int((100 * s.CurrentEngineRpm) / s.EngineMaxRpm)
+}
+
+// GetSpeed from the magnitude of the velocity, since Sled doesn't include speed
+func (s *Sled) GetSpeed() int {
+	v := s.VelocityX*s.VelocityX + s.VelocityY*s.VelocityY + s.VelocityZ*s.VelocityZ
+	return int(float32(math.Sqrt(float64(v))) * mslashs)
+}
+
+func (s *Sled) GetRPM() int {
+	return int(s.CurrentEngineRpm)
+}
+
+func (s *Sled) GetMaxRPM() int {
+	return int(s.EngineMaxRpm)
+}
+
+func (s *Sled) GetIdleRPM() int {
+	return int(s.EngineIdleRpm)
+}
+
+// Dash is the Sled data followed by dashboard data.  It decodes every format;
+// when a Sled datagram is received only the embedded Sled is updated.
+type Dash struct {
+	Sled
+
+	// Format of the last decoded datagram
+	Format Format
+
+	PositionX        float32
+	PositionY        float32
+	PositionZ        float32
+	Speed            float32    // Meters per second
+	Power            float32    // Watts
+	Torque           float32    // Newton meters
+	TireTemp         [4]float32 // Fahrenheit
+	Boost            float32
+	Fuel             float32 // 0.0 - 1.0
+	DistanceTraveled float32
+	BestLap          float32
+	LastLap          float32
+	CurrentLap       float32
+	CurrentRaceTime  float32
+	LapNumber        uint16
+	RacePosition     uint8
+	Accel            uint8
+	Brake            uint8
+	Clutch           uint8
+	HandBrake        uint8
+	Gear             uint8 // 0 = reverse
+	Steer            int8
+	DrivingLine      int8
+	AIBrakeDiff      int8
+
+	// Forza Motorsport (2023) only
+	TireWear     [4]float32
+	TrackOrdinal int32
+}
+
+// Size of the largest format
+func (d *Dash) Size() int {
+	return MotorsportDashSize
+}
+
+// Decode any Data Out format, told apart by the datagram length.  Datagrams of
+// any other length are ignored.
+func (d *Dash) Decode(b []byte) {
+	var off int
+	switch len(b) {
+	case SledSize:
+		d.Sled.Decode(b)
+		d.Format = FormatSled
+		return
+	case DashSize, MotorsportDashSize:
+		off = SledSize
+	case HorizonDashSize:
+		off = SledSize + horizonGap
+	default:
+		return
+	}
+	d.Sled.Decode(b)
+	d.Format = Format(len(b))
+
+	b = b[off:]
+	_ = b[DashSize-SledSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	d.PositionX = float32At(b, 0)
+	d.PositionY = float32At(b, 4)
+	d.PositionZ = float32At(b, 8)
+	d.Speed = float32At(b, 12)
+	d.Power = float32At(b, 16)
+	d.Torque = float32At(b, 20)
+	for i := 0; i < 4; i++ {
+		d.TireTemp[i] = float32At(b, 24+4*i)
+	}
+	d.Boost = float32At(b, 40)
+	d.Fuel = float32At(b, 44)
+	d.DistanceTraveled = float32At(b, 48)
+	d.BestLap = float32At(b, 52)
+	d.LastLap = float32At(b, 56)
+	d.CurrentLap = float32At(b, 60)
+	d.CurrentRaceTime = float32At(b, 64)
+	d.LapNumber = binary.LittleEndian.Uint16(b[68:70])
+	d.RacePosition = b[70]
+	d.Accel = b[71]
+	d.Brake = b[72]
+	d.Clutch = b[73]
+	d.HandBrake = b[74]
+	d.Gear = b[75]
+	d.Steer = int8(b[76])
+	d.DrivingLine = int8(b[77])
+	d.AIBrakeDiff = int8(b[78])
+
+	if d.Format == FormatMotorsportDash {
+		for i := 0; i < 4; i++ {
+			d.TireWear[i] = float32At(b, 79+4*i)
+		}
+		d.TrackOrdinal = int32(binary.LittleEndian.Uint32(b[95:99]))
+	}
+}
+
+func (d *Dash) dash() bool {
+	return d.Format != FormatNone && d.Format != FormatSled
+}
+
+// GetGear returns -1 for reverse
+func (d *Dash) GetGear() int {
+	if !d.dash() {
+		return 0
+	}
+	if d.Gear == 0 {
+		return -1
+	}
+	return int(d.Gear)
+}
+
+func (d *Dash) GetSpeed() int {
+	if !d.dash() {
+		return d.Sled.GetSpeed()
+	}
+	return int(d.Speed * mslashs)
+}
+
+// GetFuel as a fraction of the tank
+func (d *Dash) GetFuel() float32 {
+	return d.Fuel
+}
+
+// GetFuelCapacity is always one since Fuel is already a fraction
+func (d *Dash) GetFuelCapacity() float32 {
+	return 1
+}
+
+// GetTyreTemps converts TireTemp to centigrade
+func (d *Dash) GetTyreTemps() (t [4]float32) {
+	for i, f := range d.TireTemp {
+		t[i] = (f - 32) * 5 / 9
+	}
+	return t
+}
+
+// GetBrakeTemps is always zero since Forza doesn't send them
+func (d *Dash) GetBrakeTemps() [4]float32 {
+	return [4]float32{}
+}
+
+func (d *Dash) GetLap() int {
+	return int(d.LapNumber)
+}
+
+func (d *Dash) GetLapTime() float32 {
+	return d.CurrentLap
+}
+
+func (d *Dash) GetLastLapTime() float32 {
+	return d.LastLap
+}
+
+func (d *Dash) GetBestLapTime() float32 {
+	return d.BestLap
+}
+
+func (d *Dash) GetPosition() int {
+	return int(d.RacePosition)
+}
+
+func float32At(b []byte, i int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4]))
+}
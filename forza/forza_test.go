@@ -0,0 +1,62 @@
+package forza
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func put(b []byte, off int, f float32) {
+	binary.LittleEndian.PutUint32(b[off:], math.Float32bits(f))
+}
+
+func dash(size, off int) []byte {
+	b := make([]byte, size)
+	b[0] = 1
+	put(b, 8, 8000)
+	put(b, 12, 800)
+	put(b, 16, 6000)
+	put(b, off+12, 20)          // speed
+	put(b, off+24, 212)         // front left tire
+	b[off+70], b[off+75] = 3, 0 // position, reverse
+	return b
+}
+
+func TestDash(t *testing.T) {
+	for _, tc := range []struct {
+		size, off int
+	}{
+		{DashSize, SledSize},
+		{HorizonDashSize, SledSize + horizonGap},
+		{MotorsportDashSize, SledSize},
+	} {
+		d := &Dash{}
+		d.Decode(dash(tc.size, tc.off))
+		if d.Format != Format(tc.size) {
+			t.Errorf("%d: Format = %d", tc.size, d.Format)
+		}
+		if d.GetRevLightPercent() != 75 || d.GetIdleRPM() != 800 || d.GetSpeed() != 44 {
+			t.Errorf("%d: Rev=%d Idle=%d Speed=%d", tc.size, d.GetRevLightPercent(), d.GetIdleRPM(), d.GetSpeed())
+		}
+		if d.GetGear() != -1 || d.GetPosition() != 3 || d.GetTyreTemps()[0] != 100 {
+			t.Errorf("%d: Gear=%d Position=%d Tyre=%f", tc.size, d.GetGear(), d.GetPosition(), d.GetTyreTemps()[0])
+		}
+	}
+}
+
+func TestSled(t *testing.T) {
+	b := make([]byte, SledSize)
+	put(b, 32, 3)
+	put(b, 40, 4)
+
+	d := &Dash{Gear: 4}
+	d.Decode(b)
+	if d.Format != FormatSled || d.GetSpeed() != 11 || d.GetGear() != 0 {
+		t.Errorf("Format=%d Speed=%d Gear=%d", d.Format, d.GetSpeed(), d.GetGear())
+	}
+
+	d.Decode(b[:100])
+	if d.Format != FormatSled {
+		t.Error("Short datagram was decoded")
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jake-dog/opensimdash/acc"
+	"github.com/jake-dog/opensimdash/assettocorsa"
+	"github.com/jake-dog/opensimdash/codemasters"
+	"github.com/jake-dog/opensimdash/forza"
+	"github.com/jake-dog/opensimdash/gt7"
+	"github.com/jake-dog/opensimdash/kartkraft"
+	"github.com/jake-dog/opensimdash/outgauge"
+	"github.com/jake-dog/opensimdash/pcars2"
+	"github.com/jake-dog/opensimdash/rbr"
+	"github.com/jake-dog/opensimdash/schema"
+)
+
+var (
+	gameName     = flag.String("game", "dirt", "game sending the telemetry: "+strings.Join(gameNames(), ", "))
+	gameAddress  = flag.String("game-address", "", "address of the game for ac and acc, or of the PlayStation for gt7 and gts, which telemetry is requested from")
+	gamePassword = flag.String("game-password", "", "acc broadcasting password, from broadcasting.json")
+	wrcChannels  = flag.String("wrc-channels", "", "wrc channel catalogue, Documents/My Games/WRC/telemetry/readme/channels.json")
+	wrcStructure = flag.String("wrc-structure", "", "wrc packet structure, from Documents/My Games/WRC/telemetry/udp")
+	maxRPM       = flag.Float64("max-rpm", 0, "maximum RPM of the car for ac, outgauge and rbr, which don't send it; otherwise it's learnt once the engine has been revved")
+)
+
+// game is the telemetry format of a game, chosen with -game
+type game struct {
+	// port the game sends to by default, or zero if it must be configured
+	port int
+
+	// pack makes the decoder for the game's datagrams
+	pack func() (Pack, error)
+
+	// dial starts a client for games which only send telemetry once asked.
+	// It's read in place of a udp source, and decoded by pack.
+	dial func(listen string, pack Pack) (Source, error)
+
+	// live is set for games whose telemetry can only be read from the game,
+	// not replayed from a file or capture
+	live bool
+}
+
+var games = map[string]game{
+	"dirt": {
+		port: 20777,
+		pack: func() (Pack, error) { return newDirtPack(), nil },
+	},
+	"wrc": {
+		port: 20777,
+		pack: newWRCPack,
+	},
+	"ac": {
+		pack: func() (Pack, error) { return &assettocorsa.CarInfo{MaxRPM: float32(*maxRPM)}, nil },
+		dial: func(_ string, _ Pack) (Source, error) {
+			return assettocorsa.NewClient(*gameAddress, assettocorsa.SubscribeUpdate, 0)
+		},
+	},
+	"acc": {
+		pack: func() (Pack, error) { return &accPack{}, nil },
+		dial: dialACC,
+		live: true,
+	},
+	"pcars2": {
+		port: pcars2.DefaultPort,
+		pack: func() (Pack, error) { return &pcars2.State{}, nil },
+	},
+	"forza": {
+		pack: func() (Pack, error) { return &forza.Dash{}, nil },
+	},
+	"gt7": {
+		pack: func() (Pack, error) { return &gt7.Packet{}, nil },
+		dial: dialGT7,
+	},
+	"gts": {
+		pack: func() (Pack, error) { return &gt7.Packet{Key: &gt7.SportKey}, nil },
+		dial: dialGT7,
+	},
+	"outgauge": {
+		pack: func() (Pack, error) { return &outgauge.OutGauge{MaxRPM: float32(*maxRPM)}, nil },
+	},
+	"rbr": {
+		port: rbr.DefaultPort,
+		pack: func() (Pack, error) { return &rbr.Packet{MaxRPM: float32(*maxRPM)}, nil },
+	},
+	"kartkraft": {
+		port: kartkraft.DefaultPort,
+		pack: func() (Pack, error) { return &kartkraft.Frame{}, nil },
+	},
+}
+
+func gameNames() []string {
+	names := make([]string, 0, len(games))
+	for name := range games {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// openGame makes the decoder for the named game
+func openGame(name string) (game, Pack, error) {
+	g, ok := games[name]
+	if !ok {
+		return g, nil, fmt.Errorf("unknown game %q, want one of %s", name, strings.Join(gameNames(), ", "))
+	}
+	p, err := g.pack()
+	return g, p, err
+}
+
+// openSchema makes a decoder for the game described by the schema file at path
+func openSchema(path string) (game, Pack, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return game{}, nil, err
+	}
+	defer f.Close()
+
+	p, err := schema.Load(f)
+	if err != nil {
+		return game{}, nil, err
+	}
+	return game{port: p.Port()}, p, nil
+}
+
+// listen for the game's telemetry over UDP on address, or the game's default
+// port if address is empty, asking the game for it if need be
+func (g game) listen(name, address string, p Pack) (Source, error) {
+	switch {
+	case g.dial != nil:
+		return g.dial(address, p)
+	case address != "":
+		return NewTelemetry(address)
+	case g.port == 0:
+		return nil, fmt.Errorf("%s has no default port, set the one the game sends to with -source udp:ADDRESS", name)
+	}
+	return NewTelemetry(":" + strconv.Itoa(g.port))
+}
+
+// newWRCPack reads the WRC channel catalogue and packet structure
+func newWRCPack() (Pack, error) {
+	if *wrcChannels == "" || *wrcStructure == "" {
+		return nil, errors.New("wrc needs its channel catalogue and packet structure, set with -wrc-channels and -wrc-structure")
+	}
+	channels, err := os.Open(*wrcChannels)
+	if err != nil {
+		return nil, err
+	}
+	defer channels.Close()
+	structure, err := os.Open(*wrcStructure)
+	if err != nil {
+		return nil, err
+	}
+	defer structure.Close()
+	return codemasters.NewWRCPacket(channels, structure)
+}
+
+// accPack is the model of an ACC broadcasting client.  The client applies
+// every message to the model as it's read, so there's nothing to decode.
+type accPack struct {
+	*acc.Model
+}
+
+func (p *accPack) Decode(b []byte) {}
+
+func (p *accPack) Size() int {
+	return 0
+}
+
+// accSource reads messages from an ACC broadcasting client
+type accSource struct {
+	*acc.Client
+}
+
+// Read the next message into the client's model
+func (s accSource) Read(b []byte) (int, error) {
+	_, err := s.Next()
+	return 0, err
+}
+
+func dialACC(_ string, p Pack) (Source, error) {
+	c, err := acc.NewClient(acc.Config{Address: *gameAddress, Password: *gamePassword})
+	if err != nil {
+		return nil, err
+	}
+	p.(*accPack).Model = &c.Model
+	return accSource{c}, nil
+}
+
+// dialGT7 requests telemetry from the PlayStation, which Gran Turismo 7 and
+// Sport send alike, other than their keys
+func dialGT7(listen string, _ Pack) (Source, error) {
+	if *gameAddress == "" {
+		return nil, errors.New("gt7 and gts need the PlayStation's address, set with -game-address")
+	}
+	return gt7.NewClient(listen, *gameAddress, gt7.HeartbeatA)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opensimdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	channels, structure := filepath.Join(dir, "channels.json"), filepath.Join(dir, "wrc.json")
+	ioutil.WriteFile(channels, []byte(`{"channels": [{"id": "vehicle_gear_index", "type": "uint8"}]}`), 0644)
+	ioutil.WriteFile(structure, []byte(`{"packets": [{"id": "session_update", "channels": ["vehicle_gear_index"]}]}`), 0644)
+
+	defer func(c, s, a string) { *wrcChannels, *wrcStructure, *gameAddress = c, s, a }(*wrcChannels, *wrcStructure, *gameAddress)
+	*wrcChannels, *wrcStructure, *gameAddress = channels, structure, "127.0.0.1:9"
+
+	for _, name := range gameNames() {
+		g, p, err := openGame(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if p == nil || p.Size() < 0 {
+			t.Errorf("%s: pack %v", name, p)
+			continue
+		}
+		p.Decode(make([]byte, p.Size())) // Zeros mustn't panic
+
+		s, err := g.listen(name, "127.0.0.1:0", p)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		s.Close()
+	}
+
+	if _, _, err := openGame("f1"); err == nil {
+		t.Error("opened an unknown game")
+	}
+	if g, p, _ := openGame("forza"); g.port != 0 {
+		t.Error("forza has a default port")
+	} else if _, err := g.listen("forza", "", p); err == nil {
+		t.Error("listened for forza without a port")
+	}
+}
+
+func TestSchemaGame(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opensimdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sim.json")
+	ioutil.WriteFile(path, []byte(`{"name": "Sim", "port": 20800, "packets": [{
+		"fields": [{"offset": 0, "type": "u8", "channel": "gear", "bias": -1}]
+	}]}`), 0644)
+
+	g, p, err := openSchema(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.port != 20800 {
+		t.Errorf("port = %d", g.port)
+	}
+	p.Decode([]byte{4})
+	if p.GetGear() != 3 {
+		t.Errorf("gear = %d", p.GetGear())
+	}
+}
@@ -0,0 +1,136 @@
+// Package gt7 receives telemetry from Gran Turismo 7 and Gran Turismo Sport.
+// The PlayStation only sends telemetry to a client which regularly sends it a
+// heartbeat, and every packet is encrypted with Salsa20.
+package gt7
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeartbeatPort on the PlayStation
+	HeartbeatPort = 33739
+
+	// TelemetryPort the PlayStation sends telemetry to
+	TelemetryPort = 33740
+
+	// HeartbeatPackets is how many packets are received between heartbeats.
+	// The game stops sending after a few seconds without a heartbeat.
+	HeartbeatPackets = 100
+
+	// DefaultTimeout after which a heartbeat is sent if no packets arrive
+	DefaultTimeout = time.Second
+)
+
+// Heartbeats select which packet format the game sends
+const (
+	HeartbeatA     = 'A' // PacketSize
+	HeartbeatB     = 'B' // PacketSizeB
+	HeartbeatTilde = '~' // PacketSizeTilde
+)
+
+// Decodable is the same as opensimdash's Decodable; packets which can be
+// decoded from a byte slice without allocations.
+type Decodable interface {
+	Decode(b []byte)
+	Size() int
+}
+
+// Client listens for telemetry from a PlayStation and keeps it flowing by
+// sending heartbeats.
+type Client struct {
+	conn      *net.UDPConn
+	ps        *net.UDPAddr
+	heartbeat []byte
+	timeout   time.Duration
+	count     int
+}
+
+// NewClient listens on address (":33740" if empty) for telemetry from the
+// PlayStation at playstation, which may omit the port.  Heartbeat is one of
+// HeartbeatA, HeartbeatB or HeartbeatTilde.
+func NewClient(address, playstation string, heartbeat byte) (*Client, error) {
+	if address == "" {
+		address = ":" + strconv.Itoa(TelemetryPort)
+	}
+	if _, _, err := net.SplitHostPort(playstation); err != nil {
+		playstation = net.JoinHostPort(playstation, strconv.Itoa(HeartbeatPort))
+	}
+	ps, err := net.ResolveUDPAddr("udp", playstation)
+	if err != nil {
+		return nil, err
+	}
+	laddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn:      conn,
+		ps:        ps,
+		heartbeat: []byte{heartbeat},
+		timeout:   DefaultTimeout,
+	}, nil
+}
+
+// Heartbeat asks the PlayStation to keep sending telemetry
+func (c *Client) Heartbeat() error {
+	c.count = 0
+	_, err := c.conn.WriteToUDP(c.heartbeat, c.ps)
+	return err
+}
+
+// Read the next datagram from the PlayStation, sending heartbeats as needed.
+// Datagrams from any other address are ignored.
+func (c *Client) Read(b []byte) (int, error) {
+	if c.count == 0 {
+		if err := c.Heartbeat(); err != nil {
+			return 0, err
+		}
+	}
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+		n, addr, err := c.conn.ReadFromUDP(b)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				if err := c.Heartbeat(); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			return 0, err
+		}
+		if !addr.IP.Equal(c.ps.IP) {
+			continue
+		}
+		if c.count++; c.count >= HeartbeatPackets {
+			c.count = 0
+		}
+		return n, nil
+	}
+}
+
+// DecodePacket from the PlayStation using the optional buffer.  The same
+// buffer rules apply as for Telemetry.DecodePacket.
+func (c *Client) DecodePacket(d Decodable, buf []byte) error {
+	b := buf
+	if b == nil {
+		b = make([]byte, d.Size())
+	}
+	n, err := c.Read(b)
+	if err != nil {
+		return err
+	}
+	d.Decode(b[:n])
+	return nil
+}
+
+// Close the connection.  The game stops sending once heartbeats stop.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,309 @@
+package gt7
+
+// https://www.gtplanet.net/forum/threads/gt7-is-compatible-with-motion-rig.410728/
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	// PacketSize is the size of a packet requested with HeartbeatA
+	PacketSize = 0x128
+
+	// PacketSizeB is the size of a packet requested with HeartbeatB
+	PacketSizeB = 0x13C
+
+	// PacketSizeTilde is the size of a packet requested with HeartbeatTilde
+	PacketSizeTilde = 0x158
+
+	// Magic is "0S7G" once the packet is decrypted
+	Magic = 0x47375330
+
+	// Offset of the nonce seed, which is not encrypted
+	ivOffset = 0x40
+
+	// Speed is sent in meters per second, so convert to MPH
+	mslashs float32 = 2.23694
+)
+
+// Each packet size is encrypted with a different nonce mask
+const (
+	maskA     = 0xDEADBEAF
+	maskB     = 0xDEADBEEF
+	maskTilde = 0x55FABB4F
+)
+
+// Keys are the first 32 bytes of "Simulator Interface Packet GT7 ver 0.0" and
+// "Simulator Interface Packet ver 0.0" respectively.
+var (
+	Key      = [32]byte{}
+	SportKey = [32]byte{}
+)
+
+func init() {
+	copy(Key[:], "Simulator Interface Packet GT7 ver 0.0")
+	copy(SportKey[:], "Simulator Interface Packet ver 0.0")
+}
+
+// ErrMagic is returned by Decrypt when a packet didn't decrypt properly
+var ErrMagic = errors.New("gt7: invalid magic")
+
+// ErrSize is returned by Decrypt for packets of an unknown size
+var ErrSize = errors.New("gt7: unknown packet size")
+
+// Packet flags
+const (
+	FlagCarOnTrack      = 1 << 0
+	FlagPaused          = 1 << 1
+	FlagLoading         = 1 << 2
+	FlagInGear          = 1 << 3
+	FlagHasTurbo        = 1 << 4
+	FlagRevLimiterAlert = 1 << 5
+	FlagHandBrake       = 1 << 6
+	FlagLights          = 1 << 7
+	FlagHighBeam        = 1 << 8
+	FlagLowBeam         = 1 << 9
+	FlagASM             = 1 << 10
+	FlagTCS             = 1 << 11
+)
+
+// Packet is the car state sent by the game.  Wheels are ordered front left,
+// front right, rear left, rear right.
+type Packet struct {
+	// Key used to decrypt packets, Key if nil
+	Key *[32]byte
+
+	// Invalid counts packets which failed to decrypt
+	Invalid uint64
+
+	PositionX         float32
+	PositionY         float32
+	PositionZ         float32
+	VelocityX         float32
+	VelocityY         float32
+	VelocityZ         float32
+	Pitch             float32
+	Yaw               float32
+	Roll              float32
+	BodyHeight        float32
+	EngineRPM         float32
+	FuelLevel         float32 // Liters, or percent for electric cars
+	FuelCapacity      float32
+	Speed             float32 // Meters per second
+	Boost             float32 // Bar, offset by one
+	OilPressure       float32
+	WaterTemp         float32
+	OilTemp           float32
+	TyreTemp          [4]float32
+	PacketID          int32
+	LapCount          int16
+	TotalLaps         int16
+	BestLapTime       int32 // Milliseconds, -1 when not set
+	LastLapTime       int32 // Milliseconds, -1 when not set
+	TimeOfDay         int32 // Milliseconds
+	StartPosition     int16 // -1 once the race started
+	NumCars           int16
+	RevLimiterMinRPM  int16 // RPM at which the rev limiter alert starts
+	RevLimiterMaxRPM  int16 // RPM at which the rev limiter alert is fully lit
+	EstimatedTopSpeed int16 // Kilometers per hour
+	Flags             uint16
+	Gear              uint8 // 0 = reverse
+	SuggestedGear     uint8 // 15 = no suggestion
+	Throttle          uint8
+	Brake             uint8
+	WheelRPS          [4]float32
+	TyreRadius        [4]float32
+	SuspensionHeight  [4]float32
+	Clutch            float32
+	ClutchEngagement  float32
+	RPMAfterClutch    float32
+	TopSpeed          float32
+	GearRatios        [8]float32
+	CarCode           int32
+
+	buf    [PacketSizeTilde]byte
+	cipher salsa20
+}
+
+// Size of the largest packet
+func (p *Packet) Size() int {
+	return PacketSizeTilde
+}
+
+// Decrypt a packet into dst, which must be at least as long as src, and check
+// its magic.
+func Decrypt(key *[32]byte, dst, src []byte) error {
+	var s salsa20
+	return decrypt(&s, key, dst, src)
+}
+
+func decrypt(s *salsa20, key *[32]byte, dst, src []byte) error {
+	var mask uint32
+	switch len(src) {
+	case PacketSize:
+		mask = maskA
+	case PacketSizeB:
+		mask = maskB
+	case PacketSizeTilde:
+		mask = maskTilde
+	default:
+		return ErrSize
+	}
+	dst = dst[:len(src)]
+	copy(dst, src)
+
+	iv1 := binary.LittleEndian.Uint32(src[ivOffset:])
+	iv2 := iv1 ^ mask
+	s.init(key, uint64(iv2)|uint64(iv1)<<32)
+	s.xor(dst)
+
+	if binary.LittleEndian.Uint32(dst[0:4]) != Magic {
+		return ErrMagic
+	}
+	return nil
+}
+
+// Decode decrypts the packet into an internal buffer, so b isn't modified, and
+// decodes it.  Packets which fail to decrypt are ignored.
+func (p *Packet) Decode(b []byte) {
+	key := p.Key
+	if key == nil {
+		key = &Key
+	}
+	if err := decrypt(&p.cipher, key, p.buf[:], b); err != nil {
+		p.Invalid++
+		return
+	}
+	d := p.buf[:PacketSize]
+
+	p.PositionX = float32At(d, 0x04)
+	p.PositionY = float32At(d, 0x08)
+	p.PositionZ = float32At(d, 0x0C)
+	p.VelocityX = float32At(d, 0x10)
+	p.VelocityY = float32At(d, 0x14)
+	p.VelocityZ = float32At(d, 0x18)
+	p.Pitch = float32At(d, 0x1C)
+	p.Yaw = float32At(d, 0x20)
+	p.Roll = float32At(d, 0x24)
+	p.BodyHeight = float32At(d, 0x38)
+	p.EngineRPM = float32At(d, 0x3C)
+	p.FuelLevel = float32At(d, 0x44)
+	p.FuelCapacity = float32At(d, 0x48)
+	p.Speed = float32At(d, 0x4C)
+	p.Boost = float32At(d, 0x50)
+	p.OilPressure = float32At(d, 0x54)
+	p.WaterTemp = float32At(d, 0x58)
+	p.OilTemp = float32At(d, 0x5C)
+	for i := 0; i < 4; i++ {
+		p.TyreTemp[i] = float32At(d, 0x60+4*i)
+		p.WheelRPS[i] = float32At(d, 0xA4+4*i)
+		p.TyreRadius[i] = float32At(d, 0xB4+4*i)
+		p.SuspensionHeight[i] = float32At(d, 0xC4+4*i)
+	}
+	p.PacketID = int32(binary.LittleEndian.Uint32(d[0x70:]))
+	p.LapCount = int16(binary.LittleEndian.Uint16(d[0x74:]))
+	p.TotalLaps = int16(binary.LittleEndian.Uint16(d[0x76:]))
+	p.BestLapTime = int32(binary.LittleEndian.Uint32(d[0x78:]))
+	p.LastLapTime = int32(binary.LittleEndian.Uint32(d[0x7C:]))
+	p.TimeOfDay = int32(binary.LittleEndian.Uint32(d[0x80:]))
+	p.StartPosition = int16(binary.LittleEndian.Uint16(d[0x84:]))
+	p.NumCars = int16(binary.LittleEndian.Uint16(d[0x86:]))
+	p.RevLimiterMinRPM = int16(binary.LittleEndian.Uint16(d[0x88:]))
+	p.RevLimiterMaxRPM = int16(binary.LittleEndian.Uint16(d[0x8A:]))
+	p.EstimatedTopSpeed = int16(binary.LittleEndian.Uint16(d[0x8C:]))
+	p.Flags = binary.LittleEndian.Uint16(d[0x8E:])
+	p.Gear = d[0x90] & 0x0f
+	p.SuggestedGear = d[0x90] >> 4
+	p.Throttle = d[0x91]
+	p.Brake = d[0x92]
+	p.Clutch = float32At(d, 0xF4)
+	p.ClutchEngagement = float32At(d, 0xF8)
+	p.RPMAfterClutch = float32At(d, 0xFC)
+	p.TopSpeed = float32At(d, 0x100)
+	for i := 0; i < 8; i++ {
+		p.GearRatios[i] = float32At(d, 0x104+4*i)
+	}
+	p.CarCode = int32(binary.LittleEndian.Uint32(d[0x124:]))
+}
+
+// GetGear returns -1 for reverse
+func (p *Packet) GetGear() int {
+	if p.Gear == 0 {
+		return -1
+	}
+	return int(p.Gear)
+}
+
+// GetRevLightPercent is 100% at the top of the rev limiter alert range, which
+// is where the game's own shift lights are fully lit.
+func (p *Packet) GetRevLightPercent() int {
+	if p.RevLimiterMaxRPM <= 0 {
+		return 0
+	}
+	return int(100 * p.EngineRPM / float32(p.RevLimiterMaxRPM))
+}
+
+func (p *Packet) GetSpeed() int {
+	return int(p.Speed * mslashs)
+}
+
+func (p *Packet) GetRPM() int {
+	return int(p.EngineRPM)
+}
+
+// GetMaxRPM is the top of the rev limiter alert range
+func (p *Packet) GetMaxRPM() int {
+	return int(p.RevLimiterMaxRPM)
+}
+
+// GetIdleRPM is always zero since the game doesn't send it
+func (p *Packet) GetIdleRPM() int {
+	return 0
+}
+
+func (p *Packet) GetFuel() float32 {
+	return p.FuelLevel
+}
+
+func (p *Packet) GetFuelCapacity() float32 {
+	return p.FuelCapacity
+}
+
+func (p *Packet) GetTyreTemps() [4]float32 {
+	return p.TyreTemp
+}
+
+// GetBrakeTemps is always zero since the game doesn't send them
+func (p *Packet) GetBrakeTemps() [4]float32 {
+	return [4]float32{}
+}
+
+func (p *Packet) GetLap() int {
+	return int(p.LapCount)
+}
+
+// GetLapTime is always zero since the game doesn't send it
+func (p *Packet) GetLapTime() float32 {
+	return 0
+}
+
+func (p *Packet) GetLastLapTime() float32 {
+	return lapTime(p.LastLapTime)
+}
+
+func (p *Packet) GetBestLapTime() float32 {
+	return lapTime(p.BestLapTime)
+}
+
+func lapTime(ms int32) float32 {
+	if ms < 0 {
+		return 0
+	}
+	return float32(ms) / 1000
+}
+
+func float32At(b []byte, i int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4]))
+}
@@ -0,0 +1,97 @@
+package gt7
+
+import "encoding/binary"
+
+// salsa20 is a minimal Salsa20/20 stream cipher with a 256-bit key and 64-bit
+// nonce, which is all the game needs.  It keeps its block buffer so that
+// decrypting a packet doesn't allocate.
+type salsa20 struct {
+	state [16]uint32
+	block [64]byte
+}
+
+// sigma is "expand 32-byte k"
+var sigma = [4]uint32{0x61707865, 0x3320646e, 0x79622d32, 0x6b206574}
+
+func (s *salsa20) init(key *[32]byte, nonce uint64) {
+	s.state[0] = sigma[0]
+	s.state[5] = sigma[1]
+	s.state[10] = sigma[2]
+	s.state[15] = sigma[3]
+	for i := 0; i < 4; i++ {
+		s.state[1+i] = binary.LittleEndian.Uint32(key[4*i:])
+		s.state[11+i] = binary.LittleEndian.Uint32(key[16+4*i:])
+	}
+	s.state[6] = uint32(nonce)
+	s.state[7] = uint32(nonce >> 32)
+	s.state[8] = 0 // block counter
+	s.state[9] = 0
+}
+
+// xor the key stream into b in place
+func (s *salsa20) xor(b []byte) {
+	for len(b) > 0 {
+		s.core()
+		n := len(b)
+		if n > 64 {
+			n = 64
+		}
+		for i := 0; i < n; i++ {
+			b[i] ^= s.block[i]
+		}
+		b = b[n:]
+
+		s.state[8]++
+		if s.state[8] == 0 {
+			s.state[9]++
+		}
+	}
+}
+
+func rotl(x uint32, n uint) uint32 {
+	return x<<n | x>>(32-n)
+}
+
+func (s *salsa20) core() {
+	x := s.state
+	for i := 0; i < 20; i += 2 {
+		// Column round
+		x[4] ^= rotl(x[0]+x[12], 7)
+		x[8] ^= rotl(x[4]+x[0], 9)
+		x[12] ^= rotl(x[8]+x[4], 13)
+		x[0] ^= rotl(x[12]+x[8], 18)
+		x[9] ^= rotl(x[5]+x[1], 7)
+		x[13] ^= rotl(x[9]+x[5], 9)
+		x[1] ^= rotl(x[13]+x[9], 13)
+		x[5] ^= rotl(x[1]+x[13], 18)
+		x[14] ^= rotl(x[10]+x[6], 7)
+		x[2] ^= rotl(x[14]+x[10], 9)
+		x[6] ^= rotl(x[2]+x[14], 13)
+		x[10] ^= rotl(x[6]+x[2], 18)
+		x[3] ^= rotl(x[15]+x[11], 7)
+		x[7] ^= rotl(x[3]+x[15], 9)
+		x[11] ^= rotl(x[7]+x[3], 13)
+		x[15] ^= rotl(x[11]+x[7], 18)
+
+		// Row round
+		x[1] ^= rotl(x[0]+x[3], 7)
+		x[2] ^= rotl(x[1]+x[0], 9)
+		x[3] ^= rotl(x[2]+x[1], 13)
+		x[0] ^= rotl(x[3]+x[2], 18)
+		x[6] ^= rotl(x[5]+x[4], 7)
+		x[7] ^= rotl(x[6]+x[5], 9)
+		x[4] ^= rotl(x[7]+x[6], 13)
+		x[5] ^= rotl(x[4]+x[7], 18)
+		x[11] ^= rotl(x[10]+x[9], 7)
+		x[8] ^= rotl(x[11]+x[10], 9)
+		x[9] ^= rotl(x[8]+x[11], 13)
+		x[10] ^= rotl(x[9]+x[8], 18)
+		x[12] ^= rotl(x[15]+x[14], 7)
+		x[13] ^= rotl(x[12]+x[15], 9)
+		x[14] ^= rotl(x[13]+x[12], 13)
+		x[15] ^= rotl(x[14]+x[13], 18)
+	}
+	for i := range x {
+		binary.LittleEndian.PutUint32(s.block[4*i:], x[i]+s.state[i])
+	}
+}
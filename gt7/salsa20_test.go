@@ -0,0 +1,23 @@
+package gt7
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// ECRYPT Salsa20 test vector, set 1 vector 0 (256-bit key)
+func TestSalsa20(t *testing.T) {
+	key := [32]byte{0x80}
+	b := make([]byte, 64)
+
+	var s salsa20
+	s.init(&key, 0)
+	s.xor(b)
+
+	want := "E3BE8FDD8BECA2E3EA8EF9475B29A6E7003951E1097A5C38D23B7A5FAD9F6844" +
+		"B22C97559E2723C7CBBD3FE4FC8D9A0744652A83E72A9C461876AF4D7EF1A117"
+	if got := hex.EncodeToString(b); got != strings.ToLower(want) {
+		t.Errorf("stream = %s", got)
+	}
+}
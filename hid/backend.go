@@ -0,0 +1,107 @@
+package hid
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// DeviceInfo describes a connected HID device, independently of the backend
+// which found it
+type DeviceInfo struct {
+	Path         string // Backend specific device path
+	VendorID     uint16
+	ProductID    uint16
+	Release      uint16 // Device release number in binary-coded decimal
+	Serial       string
+	Manufacturer string
+	Product      string
+	UsagePage    uint16 // Usage page of the top level collection
+	Usage        uint16 // Usage of the top level collection
+	Interface    int    // USB interface number, or -1 if unknown
+}
+
+// Device is an open HID device.  Writes are output reports and reads are
+// input reports, with the same report ID conventions as hidapi.  Close may be
+// called while a read is blocked, which then returns an error.
+type Device interface {
+	io.ReadWriteCloser
+}
+
+// Backend enumerates and opens HID devices
+type Backend interface {
+	Enumerate() ([]DeviceInfo, error)
+	Open(info *DeviceInfo) (Device, error)
+}
+
+var (
+	backendsMu sync.Mutex
+	backends   = map[string]Backend{}
+	backend    Backend
+)
+
+// registerBackend makes a backend available to SetBackend
+func registerBackend(name string, b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	backends[name] = b
+}
+
+// Backends returns the names of the backends available on this platform
+func Backends() []string {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetBackend chooses the backend used to find and open devices by name, or
+// "auto" for the default.  It must be called before Registrar.
+func SetBackend(name string) error {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if name == "auto" || name == "" {
+		backend = nil
+		return nil
+	}
+	b, ok := backends[name]
+	if !ok {
+		return fmt.Errorf("unknown HID backend %q", name)
+	}
+	backend = b
+	return nil
+}
+
+// UseBackend sets the backend to b, which needn't be one of Backends
+func UseBackend(b Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	backend = b
+}
+
+// currentBackend is the chosen backend, otherwise hidapi where it's supported
+// and hidraw where it isn't, such as when built without cgo
+func currentBackend() Backend {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if backend != nil {
+		return backend
+	}
+	if hidapiSupported() {
+		return backends["hidapi"]
+	}
+	if b, ok := backends["hidraw"]; ok {
+		return b
+	}
+	return backends["hidapi"]
+}
@@ -0,0 +1,104 @@
+package hid
+
+// Channel is a single telemetry value a device can display.  The names match
+// those of the schema package where they overlap.
+type Channel string
+
+const (
+	ChannelRevLights     Channel = "rev_light" // Percent
+	ChannelGear          Channel = "gear"      // -1 = reverse, 0 = neutral
+	ChannelSpeed         Channel = "speed"     // MPH
+	ChannelRPM           Channel = "rpm"
+	ChannelMaxRPM        Channel = "max_rpm"
+	ChannelIdleRPM       Channel = "idle_rpm"
+	ChannelStageProgress Channel = "stage_progress" // 0.0 - 1.0
+	ChannelLap           Channel = "lap"
+	ChannelPosition      Channel = "position"
+	ChannelFuel          Channel = "fuel"
+	ChannelFuelPercent   Channel = "fuel_percent"
+	ChannelIndicators    Channel = "indicators" // Indicators bitmask
+)
+
+// indicatorChannels are each 1 while the dash warning light is lit, otherwise 0
+var indicatorChannels = map[Channel]Indicators{
+	"shift_light":      IndicatorShiftLight,
+	"full_beam":        IndicatorFullBeam,
+	"handbrake":        IndicatorHandbrake,
+	"pit_limiter":      IndicatorPitLimiter,
+	"traction_control": IndicatorTractionControl,
+	"abs":              IndicatorABS,
+	"left_signal":      IndicatorLeftSignal,
+	"right_signal":     IndicatorRightSignal,
+	"oil_warning":      IndicatorOilWarning,
+	"battery":          IndicatorBattery,
+}
+
+// Valid is whether the channel is known
+func (c Channel) Valid() bool {
+	switch c {
+	case ChannelRevLights, ChannelGear, ChannelSpeed, ChannelRPM, ChannelMaxRPM,
+		ChannelIdleRPM, ChannelStageProgress, ChannelLap, ChannelPosition,
+		ChannelFuel, ChannelFuelPercent, ChannelIndicators:
+		return true
+	}
+	_, ok := indicatorChannels[c]
+	return ok
+}
+
+// Value of the channel in p, and false if p doesn't report it
+func (c Channel) Value(p TelemetryPack) (float64, bool) {
+	switch c {
+	case ChannelRevLights:
+		return float64(p.GetRevLightPercent()), true
+	case ChannelGear:
+		return float64(p.GetGear()), true
+	case ChannelSpeed:
+		return float64(p.GetSpeed()), true
+	case ChannelRPM, ChannelMaxRPM, ChannelIdleRPM:
+		ep, ok := p.(EnginePack)
+		if !ok || !Reports(p, CapEngine) {
+			return 0, false
+		}
+		switch c {
+		case ChannelRPM:
+			return float64(ep.GetRPM()), true
+		case ChannelMaxRPM:
+			return float64(ep.GetMaxRPM()), true
+		}
+		return float64(ep.GetIdleRPM()), true
+	case ChannelStageProgress:
+		if sp, ok := p.(StagePack); ok && Reports(p, CapStage) {
+			return float64(sp.GetStageProgress()), true
+		}
+	case ChannelLap:
+		if lp, ok := p.(LapPack); ok && Reports(p, CapLap) {
+			return float64(lp.GetLap()), true
+		}
+	case ChannelPosition:
+		if pp, ok := p.(PositionPack); ok && Reports(p, CapPosition) {
+			return float64(pp.GetPosition()), true
+		}
+	case ChannelFuel:
+		if fp, ok := p.(FuelPack); ok && Reports(p, CapFuel) {
+			return float64(fp.GetFuel()), true
+		}
+	case ChannelFuelPercent:
+		if fp, ok := p.(FuelPack); ok && Reports(p, CapFuel) && fp.GetFuelCapacity() > 0 {
+			return float64(100 * fp.GetFuel() / fp.GetFuelCapacity()), true
+		}
+	case ChannelIndicators:
+		if ip, ok := p.(IndicatorPack); ok && Reports(p, CapIndicator) {
+			return float64(ip.GetIndicators()), true
+		}
+	default:
+		if i, ok := indicatorChannels[c]; ok {
+			if ip, ok := p.(IndicatorPack); ok && Reports(p, CapIndicator) {
+				if ip.GetIndicators()&i != 0 {
+					return 1, true
+				}
+				return 0, true
+			}
+		}
+	}
+	return 0, false
+}
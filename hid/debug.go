@@ -2,15 +2,14 @@ package hid
 
 import (
 	"bufio"
+	"io"
 	"log"
-
-	"github.com/karalabe/hid"
 )
 
 // Debugger simplifies creating a HID device connection which simply reads
 // bytes and prints them to a logger.
 type Debugger struct {
-	Device *hid.Device
+	Device io.Reader
 	Log    *log.Logger
 }
 
@@ -0,0 +1,438 @@
+package hid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Definitions is a device definitions file, which declares the HID devices to
+// send telemetry to.  Simple boards need no Go code, as the "report" driver
+// builds the output report from a list of outputs:
+//
+//	{
+//	  "devices": [{
+//	    "name": "Shift lights",
+//	    "match": {"vendor_id": "0x16c0", "product_id": "0x0480", "usage_page": "0xffab", "usage": "0x200"},
+//	    "report_size": 64,
+//	    "outputs": [
+//	      {"byte": 0, "bits": "0-7", "channel": "rev_light", "range": [80, 95]},
+//	      {"byte": 1, "bits": "0-3", "channel": "gear", "bias": 1},
+//	      {"byte": 1, "bits": "7", "channel": "pit_limiter"}
+//	    ]
+//	  }]
+//	}
+//
+// Outputs whose bits overlap are alternatives.  The one showing the channel
+// assigned to the device is sent, otherwise the first of them.
+//
+// Devices which need code name a driver registered with RegisterDriver.
+type Definitions struct {
+	Devices []Definition `json:"devices"`
+}
+
+// Definition declares a single device model
+type Definition struct {
+	Name   string `json:"name"`
+	Driver string `json:"driver"` // Defaults to "report"
+	Match  Match  `json:"match"`
+	Debug  bool   `json:"debug"` // Log input reports instead of sending telemetry
+
+	// Channel shown by drivers which can display one of several
+	Channel Channel `json:"channel"`
+
+	// ReportSize is the output report length excluding the report ID.  As
+	// hidapi expects, the report ID is always sent as the first byte, ahead of
+	// byte 0, and is zero for devices without numbered reports.
+	ReportSize int      `json:"report_size"`
+	ReportID   byte     `json:"report_id"`
+	Outputs    []Output `json:"outputs"`
+
+	// Options specific to the driver
+	Options json.RawMessage `json:"options"`
+}
+
+// Match criteria for connected devices.  A zero usage page or usage matches
+// any.  Serial and Path are optional, and pick out one of several devices of
+// the same model.
+type Match struct {
+	VendorID  ID     `json:"vendor_id"`
+	ProductID ID     `json:"product_id"`
+	UsagePage ID     `json:"usage_page"`
+	Usage     ID     `json:"usage"`
+	Serial    string `json:"serial"`
+	Path      string `json:"path"`
+}
+
+// ID is a USB identifier, given in JSON as a number or a string such as
+// "0x16c0"
+type ID uint16
+
+func (id *ID) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if uq, err := strconv.Unquote(s); err == nil {
+		s = uq
+	}
+	v, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return fmt.Errorf("invalid USB ID %s", b)
+	}
+	*id = ID(v)
+	return nil
+}
+
+// Output maps a telemetry channel onto bits of the output report.  Bits are
+// numbered from the least significant bit of Byte, and may run on into the
+// following bytes.  It's one of:
+//
+//   - a bar graph, when Levels or Range are given.  Each bit is set when the
+//     value reaches its level, the first bit being the lowest.  Range spreads
+//     the levels evenly from the first to the last bit.
+//   - the value itself, value*scale + bias, clamped to fit the bits.  Scale
+//     defaults to one.  The indicators bitmask isn't clamped, but cut to the
+//     first indicators which fit.
+type Output struct {
+	Byte    int         `json:"byte"`
+	Bits    string      `json:"bits"` // "N" or "N-M", default "0-7"
+	Channel Channel     `json:"channel"`
+	Levels  []float64   `json:"levels"`
+	Range   *[2]float64 `json:"range"`
+	Scale   *float64    `json:"scale"`
+	Bias    float64     `json:"bias"`
+}
+
+// DefaultDefinitions are the devices used when none are configured.  Teensy is
+// the regular teensy 2.0++, whose eight LEDs show the rev lights, or the first
+// eight indicators when that channel is assigned to it.  TeensyDebug is a
+// separate Usage/UsagePage possibly used for sending debug messages.  It
+// doesn't receive data, only sends it.  The Leo Bodnar SLI-Pro and SLI-M, and
+// the rev LEDs of the Logitech wheels, use their default options.
+const DefaultDefinitions = `{
+  "devices": [{
+    "name": "Teensy",
+    "match": {"vendor_id": "0x16c0", "product_id": "0x0480", "usage_page": "0xffab", "usage": "0x200"},
+    "report_size": 64,
+    "outputs": [
+      {"byte": 0, "channel": "rev_light", "levels": [80, 83, 85, 87, 89, 91, 93, 95]},
+      {"byte": 0, "channel": "indicators"}
+    ]
+  }, {
+    "name": "TeensyDebug",
+    "debug": true,
+    "match": {"vendor_id": "0x16c0", "product_id": "0x0480", "usage_page": "0xff31", "usage": "0x0074"}
+  }, {
+    "name": "SLI-Pro",
+    "driver": "sli-pro",
+    "match": {"vendor_id": "0x1dd2", "product_id": "0x0103"}
+  }, {
+    "name": "SLI-M",
+    "driver": "sli-m",
+    "match": {"vendor_id": "0x1dd2", "product_id": "0x1110"}
+  }, {
+    "name": "G29",
+    "driver": "logitech-wheel",
+    "match": {"vendor_id": "0x046d", "product_id": "0xc24f"}
+  }, {
+    "name": "G923",
+    "driver": "logitech-wheel",
+    "match": {"vendor_id": "0x046d", "product_id": "0xc266"}
+  }]
+}`
+
+// Driver makes a device template from its definition
+type Driver func(def *Definition) (HIDPackSender, error)
+
+var (
+	driversMu sync.Mutex
+	drivers   = map[string]Driver{
+		"report": newReportDevice,
+		"debug":  newDebugDevice,
+	}
+)
+
+// RegisterDriver makes a driver available to device definitions by name
+func RegisterDriver(name string, d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	drivers[name] = d
+}
+
+// LoadDefinitions from a JSON definitions file
+func LoadDefinitions(r io.Reader) (*Definitions, error) {
+	var defs Definitions
+	if err := json.NewDecoder(r).Decode(&defs); err != nil {
+		return nil, err
+	}
+	for i := range defs.Devices {
+		if _, err := defs.Devices[i].Template(); err != nil {
+			return nil, err
+		}
+	}
+	return &defs, nil
+}
+
+// Register every defined device
+func (defs *Definitions) Register() error {
+	for i := range defs.Devices {
+		d, err := defs.Devices[i].Template()
+		if err != nil {
+			return err
+		}
+		Register(d)
+	}
+	return nil
+}
+
+// Template makes the device template for Register using the definition's
+// driver
+func (def *Definition) Template() (HIDPackSender, error) {
+	name := def.Driver
+	if def.Debug {
+		name = "debug"
+	} else if name == "" {
+		name = "report"
+	}
+
+	driversMu.Lock()
+	driver, ok := drivers[name]
+	driversMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("device %q: unknown driver %q", def.Name, name)
+	}
+	if def.Channel != "" && !def.Channel.Valid() {
+		return nil, fmt.Errorf("device %q: unknown channel %q", def.Name, def.Channel)
+	}
+	d, err := driver(def)
+	if err != nil {
+		return nil, fmt.Errorf("device %q: %v", def.Name, err)
+	}
+	return d, nil
+}
+
+// device is the SimDashDevice matching the definition
+func (def *Definition) device() *SimDashDevice {
+	return &SimDashDevice{
+		VendorID:  uint16(def.Match.VendorID),
+		ProductID: uint16(def.Match.ProductID),
+		UsagePage: uint16(def.Match.UsagePage),
+		Usage:     uint16(def.Match.Usage),
+		Serial:    def.Match.Serial,
+		Path:      def.Match.Path,
+		Channel:   def.Channel,
+	}
+}
+
+func newDebugDevice(def *Definition) (HIDPackSender, error) {
+	return &DebugDevice{SimDashDevice: def.device()}, nil
+}
+
+// output is a parsed Output
+type output struct {
+	channel     Channel
+	bit, nbits  uint // Offset from the start of the report, and width
+	levels      []float64
+	scale, bias float64
+}
+
+func parseOutput(o *Output, size int) (*output, error) {
+	if !o.Channel.Valid() {
+		return nil, fmt.Errorf("unknown channel %q", o.Channel)
+	}
+	first, last := 0, 7
+	if o.Bits != "" {
+		var err error
+		f := strings.SplitN(o.Bits, "-", 2)
+		if first, err = strconv.Atoi(f[0]); err != nil {
+			return nil, fmt.Errorf("invalid bits %q", o.Bits)
+		}
+		last = first
+		if len(f) == 2 {
+			if last, err = strconv.Atoi(f[1]); err != nil {
+				return nil, fmt.Errorf("invalid bits %q", o.Bits)
+			}
+		}
+	}
+	if first < 0 || last < first || last-first >= 32 {
+		return nil, fmt.Errorf("invalid bits %q", o.Bits)
+	}
+	if o.Byte < 0 || o.Byte+last/8 >= size {
+		return nil, fmt.Errorf("%s output bits %d-%d of byte %d are outside the %d byte report", o.Channel, first, last, o.Byte, size)
+	}
+
+	out := &output{
+		channel: o.Channel,
+		bit:     uint(8*o.Byte + first),
+		nbits:   uint(last - first + 1),
+		levels:  o.Levels,
+		scale:   1,
+		bias:    o.Bias,
+	}
+	if o.Scale != nil {
+		out.scale = *o.Scale
+	}
+	if o.Range != nil {
+		if o.Levels != nil {
+			return nil, fmt.Errorf("%s output has both levels and a range", o.Channel)
+		}
+		out.levels = make([]float64, out.nbits)
+		for i := range out.levels {
+			out.levels[i] = o.Range[0]
+			if out.nbits > 1 {
+				out.levels[i] += (o.Range[1] - o.Range[0]) * float64(i) / float64(out.nbits-1)
+			}
+		}
+	}
+	if uint(len(out.levels)) > out.nbits {
+		return nil, fmt.Errorf("%s output has %d levels for %d bits", o.Channel, len(out.levels), out.nbits)
+	}
+	return out, nil
+}
+
+// bits of the output for the telemetry value
+func (o *output) bits(v float64) uint64 {
+	if o.levels != nil {
+		var b uint64
+		for i, level := range o.levels {
+			if v >= level {
+				b |= 1 << uint(i)
+			}
+		}
+		return b
+	}
+
+	max := float64(uint64(1)<<o.nbits - 1)
+	if o.channel == ChannelIndicators {
+		return uint64(v) & uint64(max)
+	}
+	v = math.Round(v*o.scale + o.bias)
+	if v <= 0 || math.IsNaN(v) {
+		return 0
+	} else if v >= max {
+		return uint64(max)
+	}
+	return uint64(v)
+}
+
+// overlaps is whether any of the bits of o are also bits of x
+func (o *output) overlaps(x *output) bool {
+	return o.bit < x.bit+x.nbits && x.bit < o.bit+o.nbits
+}
+
+// put the bits of the output into the report
+func (o *output) put(report []byte, bits uint64) {
+	for i := uint(0); i < o.nbits; i++ {
+		n := o.bit + i
+		if bits&(1<<i) != 0 {
+			report[n/8] |= 1 << (n % 8)
+		}
+	}
+}
+
+// reportDevice is the driver for devices declared entirely by their outputs
+type reportDevice struct {
+	id      byte
+	size    int
+	outputs []*output // Every output, including alternatives
+	shown   []*output // Outputs sent to this instance
+
+	snd  []byte // Report being sent, including the report ID
+	last []byte // Last report sent
+	sent bool
+	*SimDashDevice
+}
+
+func newReportDevice(def *Definition) (HIDPackSender, error) {
+	if def.ReportSize <= 0 {
+		return nil, fmt.Errorf("report_size is required")
+	}
+	d := &reportDevice{
+		id:            def.ReportID,
+		size:          def.ReportSize,
+		SimDashDevice: def.device(),
+	}
+	for i := range def.Outputs {
+		o, err := parseOutput(&def.Outputs[i], def.ReportSize)
+		if err != nil {
+			return nil, err
+		}
+		d.outputs = append(d.outputs, o)
+	}
+	return d.Instance(d.SimDashDevice), nil
+}
+
+func (d *reportDevice) Instance(dev *SimDashDevice) HIDPackSender {
+	return &reportDevice{
+		id:            d.id,
+		size:          d.size,
+		outputs:       d.outputs,
+		shown:         shownOutputs(d.outputs, dev.Channel),
+		snd:           make([]byte, 1+d.size),
+		last:          make([]byte, 1+d.size),
+		SimDashDevice: dev,
+	}
+}
+
+// shownOutputs picks one of each set of overlapping outputs: the one showing
+// channel c, otherwise the first
+func shownOutputs(outputs []*output, c Channel) []*output {
+	var shown []*output
+	for i, o := range outputs {
+		ok := true
+		for j, x := range outputs {
+			if i == j || !o.overlaps(x) {
+				continue
+			}
+			if x.channel == c && o.channel != c || (x.channel == c) == (o.channel == c) && j < i {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			shown = append(shown, o)
+		}
+	}
+	return shown
+}
+
+// setDevice also forgets the last report, so that a reopened device is sent
+// the current one
+func (d *reportDevice) setDevice(dev io.WriteCloser) {
+	d.SimDashDevice.setDevice(dev)
+	d.sent = false
+}
+
+// report computes the output report for the telemetry
+func (d *reportDevice) report(p TelemetryPack) []byte {
+	for i := range d.snd {
+		d.snd[i] = 0
+	}
+	d.snd[0] = d.id
+	report := d.snd[1:]
+	for _, o := range d.shown {
+		if v, ok := o.channel.Value(p); ok {
+			o.put(report, o.bits(v))
+		}
+	}
+	return d.snd
+}
+
+func (d *reportDevice) SendPack(p TelemetryPack) {
+	// Skip sending the report if it hasn't changed
+	report := d.report(p)
+	if d.sent && bytes.Equal(report, d.last) {
+		return
+	}
+
+	// Write failures are handled by the registrar
+	if _, err := d.Write(report); err != nil {
+		return
+	}
+	copy(d.last, report)
+	d.sent = true
+}
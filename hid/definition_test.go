@@ -0,0 +1,92 @@
+package hid
+
+import (
+	"strings"
+	"testing"
+)
+
+// loadTemplates makes a template of each device in the JSON definitions
+func loadTemplates(t testing.TB, definitions string) []HIDPackSender {
+	t.Helper()
+	defs, err := LoadDefinitions(strings.NewReader(definitions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := make([]HIDPackSender, len(defs.Devices))
+	for i := range defs.Devices {
+		if templates[i], err = defs.Devices[i].Template(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return templates
+}
+
+func TestDefaultDefinitions(t *testing.T) {
+	templates := loadTemplates(t, DefaultDefinitions)
+	if len(templates) != 6 {
+		t.Fatalf("%d devices", len(templates))
+	}
+	d := templates[0]
+	if tn, ok := d.(*reportDevice); !ok || tn.VendorID != 0x16c0 || tn.Usage != 0x200 || len(tn.snd) != 65 || len(tn.shown) != 1 {
+		t.Errorf("Teensy = %+v", d)
+	}
+	d = templates[1]
+	if !d.debug() || d.template().UsagePage != 0xff31 {
+		t.Errorf("TeensyDebug = %+v", d)
+	}
+}
+
+func TestReportDevice(t *testing.T) {
+	tmpl := loadTemplates(t, `{"devices": [{
+		"name": "Board",
+		"match": {"vendor_id": 1, "product_id": "0x02"},
+		"report_size": 4,
+		"report_id": 5,
+		"outputs": [
+			{"byte": 0, "bits": "0-7", "channel": "rev_light", "range": [80, 94]},
+			{"byte": 1, "bits": "0-3", "channel": "gear", "bias": 1},
+			{"byte": 1, "bits": "7", "channel": "handbrake"},
+			{"byte": 2, "bits": "4-11", "channel": "speed", "scale": 0.5}
+		]
+	}]}`)[0]
+	d := tmpl.Instance(&SimDashDevice{Serial: "A"})
+	var w fakeWriter
+	d.setDevice(&w)
+
+	p := &fakePack{revs: 86, indicators: IndicatorHandbrake}
+	d.SendPack(p)
+	d.flush()
+	d.SendPack(p) // Unchanged, so not sent
+	d.flush()
+	p.revs = 100
+	d.SendPack(p)
+	d.flush()
+
+	want := []string{
+		"\x05\x0f\x84\x20\x03", // Four rev lights, gear 3 + 1, 100 mph / 2 across bytes 2-3
+		"\x05\xff\x84\x20\x03",
+	}
+	if len(w.reports) != len(want) {
+		t.Fatalf("reports = %x", w.reports)
+	}
+	for i := range want {
+		if string(w.reports[i]) != want[i] {
+			t.Errorf("report %d = %x, want %x", i, w.reports[i], want[i])
+		}
+	}
+}
+
+func TestDefinitionErrors(t *testing.T) {
+	for _, def := range []string{
+		`{"devices": [{"driver": "missing"}]}`,
+		`{"devices": [{"report_size": 1, "outputs": [{"channel": "boost"}]}]}`,
+		`{"devices": [{"report_size": 1, "outputs": [{"byte": 0, "bits": "4-11", "channel": "rpm"}]}]}`,
+		`{"devices": [{"report_size": 1, "outputs": [{"bits": "0-1", "channel": "rpm", "levels": [1, 2, 3]}]}]}`,
+		`{"devices": [{"outputs": []}]}`,
+		`{"devices": [{"match": {"vendor_id": "0x10000"}}]}`,
+	} {
+		if _, err := LoadDefinitions(strings.NewReader(def)); err == nil {
+			t.Errorf("loaded %s", def)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package hid
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType is the kind of change to a device
+type EventType int
+
+const (
+	EventConnected    EventType = iota // Opened after being plugged in
+	EventDisconnected                  // Closed after being unplugged
+	EventWriteFailed                   // Closed after failing a write
+	EventReconnecting                  // Waiting to reopen after a failure
+	EventReconnected                   // Reopened after a failure
+	EventGaveUp                        // Forgotten until it's plugged in again
+)
+
+var eventNames = [...]string{
+	EventConnected:    "connected",
+	EventDisconnected: "disconnected",
+	EventWriteFailed:  "write failed",
+	EventReconnecting: "reconnecting",
+	EventReconnected:  "reconnected",
+	EventGaveUp:       "gave up reconnecting",
+}
+
+func (t EventType) String() string {
+	if t >= 0 && int(t) < len(eventNames) {
+		return eventNames[t]
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a change to a device, as sent to the handler given to OnEvent
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Device string // Description of the device, as logged
+	Path   string
+	Serial string
+	Debug  bool // Whether it's a debug device rather than a telemetry one
+
+	// Err is the failure for EventWriteFailed, EventReconnecting and
+	// EventGaveUp
+	Err error
+
+	// Attempt counts reconnections since the failure, and Backoff is the wait
+	// until this one, for EventReconnecting
+	Attempt int
+	Backoff time.Duration
+}
+
+func (e *Event) String() string {
+	kind := "telemetry"
+	if e.Debug {
+		kind = "debug"
+	}
+	switch e.Type {
+	case EventReconnecting:
+		return fmt.Sprintf("HID %s device %s in %v (attempt %d, %v) : %s", kind, e.Type, e.Backoff, e.Attempt, e.Err, e.Device)
+	case EventWriteFailed, EventGaveUp:
+		return fmt.Sprintf("HID %s device %s (%v) : %s", kind, e.Type, e.Err, e.Device)
+	}
+	return fmt.Sprintf("HID %s device %s : %s", kind, e.Type, e.Device)
+}
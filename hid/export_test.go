@@ -0,0 +1,15 @@
+package hid
+
+import "time"
+
+// LoadTemplates of the devices in JSON definitions, for the external tests
+var LoadTemplates = loadTemplates
+
+// SetBackoff of a registrar from NewRegistrar, so tests needn't wait long
+func SetBackoff(reg HIDRegistrar, min, max time.Duration, attempts int) {
+	r := reg.(*registrar)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.minBackoff, r.maxBackoff, r.maxAttempts = min, max, attempts
+}
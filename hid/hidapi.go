@@ -0,0 +1,136 @@
+package hid
+
+import (
+	"sync"
+
+	"github.com/karalabe/hid"
+)
+
+func init() {
+	registerBackend("hidapi", hidapi{})
+}
+
+// hidapi is the backend using karalabe/hid, which bundles hidapi and needs cgo
+type hidapi struct{}
+
+func hidapiSupported() bool {
+	return hid.Supported()
+}
+
+func (hidapi) Enumerate() ([]DeviceInfo, error) {
+	devices := hid.Enumerate(0, 0)
+	infos := make([]DeviceInfo, len(devices))
+	for i, d := range devices {
+		infos[i] = DeviceInfo{
+			Path:         d.Path,
+			VendorID:     d.VendorID,
+			ProductID:    d.ProductID,
+			Release:      d.Release,
+			Serial:       d.Serial,
+			Manufacturer: d.Manufacturer,
+			Product:      d.Product,
+			UsagePage:    d.UsagePage,
+			Usage:        d.Usage,
+			Interface:    d.Interface,
+		}
+	}
+	return infos, nil
+}
+
+func (hidapi) Open(info *DeviceInfo) (Device, error) {
+	d := hid.DeviceInfo{
+		Path:         info.Path,
+		VendorID:     info.VendorID,
+		ProductID:    info.ProductID,
+		Release:      info.Release,
+		Serial:       info.Serial,
+		Manufacturer: info.Manufacturer,
+		Product:      info.Product,
+		UsagePage:    info.UsagePage,
+		Usage:        info.Usage,
+		Interface:    info.Interface,
+	}
+	dev, err := d.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &hidapiDevice{dev: dev, path: info.Path}, nil
+}
+
+// hidapiDevice defers closing a device until its reads and writes have
+// returned.  hid_close frees the device even while hid_read or hid_write are
+// using it, and a read blocks until there's an input report, so an input loop
+// may only finish once the device has been closed.
+type hidapiDevice struct {
+	dev  Device
+	path string
+
+	mu     sync.Mutex
+	busy   int  // Reads and writes in progress
+	closed bool // Whether Close has been called
+	out    *reportFile
+}
+
+// begin a read or write, unless the device is closed
+func (d *hidapiDevice) begin() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return hid.ErrDeviceClosed
+	}
+	d.busy++
+	return nil
+}
+
+// end a read or write, closing the device if it was closed meanwhile
+func (d *hidapiDevice) end(err error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.busy--
+	if d.closed {
+		if d.busy == 0 {
+			d.release()
+		}
+		return hid.ErrDeviceClosed
+	}
+	return err
+}
+
+func (d *hidapiDevice) release() {
+	d.dev.Close()
+	if d.out != nil {
+		d.out.Close()
+	}
+}
+
+func (d *hidapiDevice) Read(b []byte) (int, error) {
+	if err := d.begin(); err != nil {
+		return 0, err
+	}
+	n, err := d.dev.Read(b)
+	return n, d.end(err)
+}
+
+func (d *hidapiDevice) Write(b []byte) (int, error) {
+	if err := d.begin(); err != nil {
+		return 0, err
+	}
+	n, err := d.write(b)
+	return n, d.end(err)
+}
+
+func (d *hidapiDevice) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return hid.ErrDeviceClosed
+	}
+	d.closed = true
+	if d.busy == 0 {
+		d.release()
+	}
+	return nil
+}
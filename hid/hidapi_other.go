@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package hid
+
+// reportFile is only needed on Windows
+type reportFile struct{}
+
+func (f *reportFile) Close() error { return nil }
+
+func (d *hidapiDevice) write(b []byte) (int, error) {
+	return d.dev.Write(b)
+}
@@ -0,0 +1,54 @@
+package hid
+
+import (
+	"testing"
+	"time"
+)
+
+// blockedReader blocks reads until there's input, and records when it's closed
+type blockedReader struct {
+	started, closed chan struct{}
+	input           chan []byte
+}
+
+func (d *blockedReader) Read(b []byte) (int, error) {
+	d.started <- struct{}{}
+	return copy(b, <-d.input), nil
+}
+
+func (d *blockedReader) Write(b []byte) (int, error) { return len(b), nil }
+func (d *blockedReader) Close() error                { close(d.closed); return nil }
+
+func TestHidapiDeviceClose(t *testing.T) {
+	raw := &blockedReader{
+		started: make(chan struct{}),
+		closed:  make(chan struct{}),
+		input:   make(chan []byte),
+	}
+	dev := &hidapiDevice{dev: raw}
+	read := make(chan error)
+	go func() {
+		_, err := dev.Read(make([]byte, 8))
+		read <- err
+	}()
+	<-raw.started
+
+	// The device is only really closed once the read has returned
+	if err := dev.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-raw.closed:
+		t.Fatal("closed during a read")
+	case <-time.After(20 * time.Millisecond):
+	}
+	raw.input <- []byte{1}
+	if err := <-read; err == nil {
+		t.Error("read after closing didn't fail")
+	}
+	<-raw.closed
+
+	if _, err := dev.Write([]byte{0}); err == nil {
+		t.Error("wrote to a closed device")
+	}
+}
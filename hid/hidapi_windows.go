@@ -0,0 +1,100 @@
+package hid
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modhid = syscall.NewLazyDLL("hid.dll")
+
+	procHidDGetPreparsedData  = modhid.NewProc("HidD_GetPreparsedData")
+	procHidDFreePreparsedData = modhid.NewProc("HidD_FreePreparsedData")
+	procHidPGetCaps           = modhid.NewProc("HidP_GetCaps")
+)
+
+// hidpStatusSuccess is HIDP_STATUS_SUCCESS
+const hidpStatusSuccess = 0x00110000
+
+// hidpCaps is HIDP_CAPS, of which only the report lengths are used
+type hidpCaps struct {
+	Usage                   uint16
+	UsagePage               uint16
+	InputReportByteLength   uint16
+	OutputReportByteLength  uint16
+	FeatureReportByteLength uint16
+	_                       [27]uint16
+}
+
+// write drops the leading zero report ID of unnumbered reports, as
+// karalabe/hid prepends one itself on Windows.  It can't write numbered
+// reports, which are written to a reportFile instead.
+func (d *hidapiDevice) write(b []byte) (int, error) {
+	if len(b) > 0 && b[0] == 0 {
+		n, err := d.dev.Write(b[1:])
+		if n > 0 {
+			n++
+		}
+		return n, err
+	}
+	if d.out == nil {
+		out, err := openReportFile(d.path)
+		if err != nil {
+			return 0, err
+		}
+		d.out = out
+	}
+	return d.out.Write(b)
+}
+
+// reportFile writes output reports to a device with WriteFile, as hidapi
+// does, but without adding a report ID
+type reportFile struct {
+	h    syscall.Handle
+	size int // Output report length, including the report ID
+	buf  []byte
+}
+
+func openReportFile(path string) (*reportFile, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_WRITE,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE, nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Windows only accepts writes of the device's output report length
+	var data uintptr
+	if r, _, err := procHidDGetPreparsedData.Call(uintptr(h), uintptr(unsafe.Pointer(&data))); r == 0 {
+		syscall.CloseHandle(h)
+		return nil, err
+	}
+	defer procHidDFreePreparsedData.Call(data)
+	var caps hidpCaps
+	if r, _, _ := procHidPGetCaps.Call(data, uintptr(unsafe.Pointer(&caps))); uint32(r) != hidpStatusSuccess {
+		syscall.CloseHandle(h)
+		return nil, fmt.Errorf("HidP_GetCaps: status %#x", uint32(r))
+	}
+	return &reportFile{h: h, size: int(caps.OutputReportByteLength)}, nil
+}
+
+// Write the report, padded with zeros to the output report length
+func (f *reportFile) Write(b []byte) (int, error) {
+	f.buf = append(f.buf[:0], b...)
+	for len(f.buf) < f.size {
+		f.buf = append(f.buf, 0)
+	}
+	var n uint32
+	if err := syscall.WriteFile(f.h, f.buf, &n, nil); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (f *reportFile) Close() error {
+	return syscall.CloseHandle(f.h)
+}
@@ -0,0 +1,179 @@
+package hid
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hidraw is the pure Go backend for the Linux hidraw driver, which finds
+// devices in sysfs and reads and writes their /dev/hidrawN nodes
+type hidraw struct {
+	sysfs string // Usually /sys
+	dev   string // Usually /dev
+}
+
+func (h *hidraw) Enumerate() ([]DeviceInfo, error) {
+	class := filepath.Join(h.sysfs, "class", "hidraw")
+	entries, err := ioutil.ReadDir(class)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	var infos []DeviceInfo
+	for _, name := range names {
+		// Devices can disappear mid-enumeration, so skip any which can't be read
+		if info, ok := h.device(filepath.Join(class, name, "device")); ok {
+			info.Path = filepath.Join(h.dev, name)
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// device reads the sysfs directory of a HID device, whose parent is the USB
+// interface and grandparent the USB device
+func (h *hidraw) device(dir string) (DeviceInfo, bool) {
+	info := DeviceInfo{Interface: -1}
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return info, false
+	}
+
+	uevent, err := readUevent(filepath.Join(dir, "uevent"))
+	if err != nil {
+		return info, false
+	}
+	// HID_ID is bus:vendor:product, such as 0003:000016C0:00000480
+	id := strings.Split(uevent["HID_ID"], ":")
+	if len(id) != 3 {
+		return info, false
+	}
+	vid, err1 := strconv.ParseUint(id[1], 16, 32)
+	pid, err2 := strconv.ParseUint(id[2], 16, 32)
+	if err1 != nil || err2 != nil {
+		return info, false
+	}
+	info.VendorID, info.ProductID = uint16(vid), uint16(pid)
+	info.Serial = uevent["HID_UNIQ"]
+	info.Product = uevent["HID_NAME"]
+
+	if desc, err := ioutil.ReadFile(filepath.Join(dir, "report_descriptor")); err == nil {
+		info.UsagePage, info.Usage, _ = topCollection(desc)
+	}
+
+	// USB attributes, which Bluetooth and virtual devices don't have
+	intf := filepath.Dir(dir)
+	if n, err := readAttr(intf, "bInterfaceNumber"); err == nil {
+		if v, err := strconv.ParseUint(n, 16, 8); err == nil {
+			info.Interface = int(v)
+		}
+	}
+	usb := filepath.Dir(intf)
+	if v, err := readAttr(usb, "bcdDevice"); err == nil {
+		if r, err := strconv.ParseUint(v, 16, 16); err == nil {
+			info.Release = uint16(r)
+		}
+	}
+	if v, err := readAttr(usb, "manufacturer"); err == nil {
+		info.Manufacturer = v
+	}
+	if v, err := readAttr(usb, "product"); err == nil {
+		info.Product = v
+	}
+	if v, err := readAttr(usb, "serial"); err == nil && info.Serial == "" {
+		info.Serial = v
+	}
+	return info, true
+}
+
+func (h *hidraw) Open(info *DeviceInfo) (Device, error) {
+	f, err := os.OpenFile(info.Path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func readAttr(dir, name string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	return strings.TrimSpace(string(b)), err
+}
+
+// readUevent reads the KEY=VALUE lines of a sysfs uevent file
+func readUevent(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		if i := strings.IndexByte(s.Text(), '='); i > 0 {
+			m[s.Text()[:i]] = s.Text()[i+1:]
+		}
+	}
+	return m, nil
+}
+
+// Report descriptor item tags, including their type bits
+const (
+	itemUsagePage  = 0x04 // Global
+	itemUsage      = 0x08 // Local
+	itemCollection = 0xa0 // Main
+	itemLong       = 0xfe
+)
+
+// topCollection returns the usage page and usage of the first top level
+// collection in a HID report descriptor, which is what hidapi reports for a
+// device on other platforms
+func topCollection(desc []byte) (page, usage uint16, ok bool) {
+	for i := 0; i < len(desc); {
+		prefix := desc[i]
+		if prefix == itemLong {
+			if i+1 >= len(desc) {
+				break
+			}
+			i += 3 + int(desc[i+1])
+			continue
+		}
+		size := int(prefix & 0x03)
+		if size == 3 {
+			size = 4
+		}
+		if i+1+size > len(desc) {
+			break
+		}
+		var data [4]byte
+		copy(data[:], desc[i+1:i+1+size])
+		v := binary.LittleEndian.Uint32(data[:])
+		i += 1 + size
+
+		switch prefix &^ 0x03 {
+		case itemUsagePage:
+			page = uint16(v)
+		case itemUsage:
+			// An extended usage carries its own usage page
+			if size == 4 {
+				page = uint16(v >> 16)
+			}
+			if usage == 0 {
+				usage = uint16(v)
+			}
+		case itemCollection:
+			return page, usage, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,5 @@
+package hid
+
+func init() {
+	registerBackend("hidraw", &hidraw{sysfs: "/sys", dev: "/dev"})
+}
@@ -0,0 +1,96 @@
+package hid
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Teensy RawHID report descriptor, up to its first collection
+var teensyDescriptor = []byte{
+	0x06, 0xab, 0xff, // Usage Page (0xffab)
+	0x0a, 0x00, 0x02, // Usage (0x200)
+	0xa1, 0x01, // Collection (Application)
+	0x75, 0x08, // Report Size (8)
+	0x15, 0x00, // Logical Minimum (0)
+	0xc0, // End Collection
+}
+
+func TestTopCollection(t *testing.T) {
+	if page, usage, ok := topCollection(teensyDescriptor); !ok || page != 0xffab || usage != 0x200 {
+		t.Errorf("teensy = %#x, %#x, %t", page, usage, ok)
+	}
+
+	// Extended usage, preceded by a long item
+	desc := []byte{0xfe, 0x01, 0x00, 0xaa, 0x0b, 0x74, 0x00, 0x31, 0xff, 0xa1, 0x01}
+	if page, usage, ok := topCollection(desc); !ok || page != 0xff31 || usage != 0x74 {
+		t.Errorf("extended = %#x, %#x, %t", page, usage, ok)
+	}
+
+	if _, _, ok := topCollection([]byte{0x06, 0xab}); ok {
+		t.Error("truncated descriptor parsed")
+	}
+}
+
+func TestHidrawEnumerate(t *testing.T) {
+	root, err := ioutil.TempDir("", "opensimdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// Lay out sysfs as the kernel does, with the hidraw class linking to the
+	// HID device below its USB interface and device
+	usb := filepath.Join(root, "devices", "usb1", "1-2")
+	hid := filepath.Join(usb, "1-2:1.0", "0003:16C0:0480.0001")
+	files := map[string]string{
+		filepath.Join(usb, "manufacturer"):                "Teensyduino\n",
+		filepath.Join(usb, "product"):                     "Teensyduino RawHID\n",
+		filepath.Join(usb, "serial"):                      "12345\n",
+		filepath.Join(usb, "bcdDevice"):                   "0275\n",
+		filepath.Join(usb, "1-2:1.0", "bInterfaceNumber"): "00\n",
+		filepath.Join(hid, "uevent"):                      "DRIVER=hid-generic\nHID_ID=0003:000016C0:00000480\nHID_NAME=Teensyduino RawHID\nHID_UNIQ=\n",
+		filepath.Join(hid, "report_descriptor"):           string(teensyDescriptor),
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	class := filepath.Join(root, "class", "hidraw", "hidraw3")
+	if err := os.MkdirAll(class, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(hid, filepath.Join(class, "device")); err != nil {
+		t.Skip(err)
+	}
+	// A device which vanished mid-enumeration is skipped
+	if err := os.MkdirAll(filepath.Join(root, "class", "hidraw", "hidraw4"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &hidraw{sysfs: root, dev: "/dev"}
+	infos, err := h.Enumerate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DeviceInfo{
+		Path:         "/dev/hidraw3",
+		VendorID:     0x16c0,
+		ProductID:    0x0480,
+		Release:      0x0275,
+		Serial:       "12345",
+		Manufacturer: "Teensyduino",
+		Product:      "Teensyduino RawHID",
+		UsagePage:    0xffab,
+		Usage:        0x200,
+		Interface:    0,
+	}
+	if len(infos) != 1 || infos[0] != want {
+		t.Errorf("Enumerate = %+v", infos)
+	}
+}
@@ -0,0 +1,279 @@
+// Package hidtest provides an in-memory HID backend, so that device drivers,
+// registration and hotplug can be tested without hardware:
+//
+//	b := hidtest.NewBackend()
+//	dev := b.Connect(hid.DeviceInfo{VendorID: 0x16c0, ProductID: 0x0480, UsagePage: 0xffab, Usage: 0x200})
+//	r := hid.NewRegistrar(b, nil, template)
+//	r.SendPack(&hidtest.Pack{RevLight: 90})
+//	report := dev.LastReport()
+//
+// Disconnecting a device makes it vanish from enumeration and fails its open
+// handles, as unplugging it would.
+package hidtest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+var (
+	// ErrDisconnected is returned by reads and writes after Disconnect
+	ErrDisconnected = errors.New("hidtest: device disconnected")
+
+	// ErrClosed is returned by reads and writes after Close
+	ErrClosed = errors.New("hidtest: device closed")
+)
+
+// Backend is a hid.Backend of simulated devices
+type Backend struct {
+	mu      sync.Mutex
+	devices map[string]*Device
+	next    int
+}
+
+// NewBackend with no devices connected
+func NewBackend() *Backend {
+	return &Backend{devices: make(map[string]*Device)}
+}
+
+// Connect a simulated device.  A path is made up if info has none.
+func (b *Backend) Connect(info hid.DeviceInfo) *Device {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if info.Path == "" {
+		info.Path = fmt.Sprintf("hidtest%d", b.next)
+		b.next++
+	}
+	d := &Device{Info: info}
+	b.devices[info.Path] = d
+	return d
+}
+
+// Disconnect the device at path, failing any reads and writes of it
+func (b *Backend) Disconnect(path string) {
+	b.mu.Lock()
+	d, ok := b.devices[path]
+	delete(b.devices, path)
+	b.mu.Unlock()
+
+	if ok {
+		d.disconnect()
+	}
+}
+
+// Device at path, or nil if none is connected
+func (b *Backend) Device(path string) *Device {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.devices[path]
+}
+
+// Enumerate the connected devices, ordered by path
+func (b *Backend) Enumerate() ([]hid.DeviceInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	infos := make([]hid.DeviceInfo, 0, len(b.devices))
+	for _, d := range b.devices {
+		infos = append(infos, d.Info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos, nil
+}
+
+// Open a connected device
+func (b *Backend) Open(info *hid.DeviceInfo) (hid.Device, error) {
+	b.mu.Lock()
+	d, ok := b.devices[info.Path]
+	b.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("hidtest: no device at %s", info.Path)
+	}
+	return d.open(), nil
+}
+
+// Device is a simulated device, which records the reports written to it and
+// returns input reports queued with Input
+type Device struct {
+	Info hid.DeviceInfo
+
+	mu           sync.Mutex
+	cond         *sync.Cond
+	reports      [][]byte
+	input        [][]byte
+	opens        int
+	handles      int
+	disconnected bool
+	writeErr     error
+	held         bool
+}
+
+func (d *Device) open() *handle {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cond == nil {
+		d.cond = sync.NewCond(&d.mu)
+	}
+	d.opens++
+	d.handles++
+	return &handle{d: d}
+}
+
+func (d *Device) disconnect() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.disconnected = true
+	if d.cond != nil {
+		d.cond.Broadcast()
+	}
+}
+
+// Reports written to the device, oldest first
+func (d *Device) Reports() [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	reports := make([][]byte, len(d.reports))
+	copy(reports, d.reports)
+	return reports
+}
+
+// LastReport written to the device, or nil if there were none
+func (d *Device) LastReport() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.reports) == 0 {
+		return nil
+	}
+	return d.reports[len(d.reports)-1]
+}
+
+// Input queues an input report to be read from the device
+func (d *Device) Input(report []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.input = append(d.input, append([]byte(nil), report...))
+	if d.cond != nil {
+		d.cond.Broadcast()
+	}
+}
+
+// FailWrites makes writes to the device fail with err until it's called again
+// with nil
+func (d *Device) FailWrites(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.writeErr = err
+}
+
+// HoldWrites makes writes to the device block until ReleaseWrites, as for a
+// stalled endpoint
+func (d *Device) HoldWrites() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.held = true
+}
+
+// ReleaseWrites held by HoldWrites
+func (d *Device) ReleaseWrites() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.held = false
+	if d.cond != nil {
+		d.cond.Broadcast()
+	}
+}
+
+// Opens is how many times the device has been opened
+func (d *Device) Opens() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.opens
+}
+
+// IsOpen is whether the device has any handles which aren't closed
+func (d *Device) IsOpen() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.handles > 0
+}
+
+// handle is an open Device
+type handle struct {
+	d      *Device
+	closed bool
+}
+
+func (h *handle) err() error {
+	if h.closed {
+		return ErrClosed
+	} else if h.d.disconnected {
+		return ErrDisconnected
+	}
+	return nil
+}
+
+func (h *handle) Write(b []byte) (int, error) {
+	h.d.mu.Lock()
+	defer h.d.mu.Unlock()
+
+	for h.d.held && h.err() == nil {
+		h.d.cond.Wait()
+	}
+	if err := h.err(); err != nil {
+		return 0, err
+	} else if h.d.writeErr != nil {
+		return 0, h.d.writeErr
+	}
+	h.d.reports = append(h.d.reports, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+// Read blocks until an input report is queued, truncating it to the length of
+// b as for a real device
+func (h *handle) Read(b []byte) (int, error) {
+	h.d.mu.Lock()
+	defer h.d.mu.Unlock()
+
+	for len(h.d.input) == 0 {
+		if err := h.err(); err != nil {
+			return 0, err
+		}
+		h.d.cond.Wait()
+	}
+	if err := h.err(); err != nil {
+		return 0, err
+	}
+	n := copy(b, h.d.input[0])
+	h.d.input = h.d.input[1:]
+	return n, nil
+}
+
+func (h *handle) Close() error {
+	h.d.mu.Lock()
+	defer h.d.mu.Unlock()
+
+	if h.closed {
+		return ErrClosed
+	}
+	h.closed = true
+	h.d.handles--
+	h.d.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,61 @@
+package hidtest
+
+import (
+	"testing"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+func TestDevice(t *testing.T) {
+	b := NewBackend()
+	d := b.Connect(hid.DeviceInfo{VendorID: 1, ProductID: 2})
+	if d.Info.Path != "hidtest0" {
+		t.Errorf("path = %q", d.Info.Path)
+	}
+	if infos, _ := b.Enumerate(); len(infos) != 1 || infos[0] != d.Info {
+		t.Errorf("Enumerate = %+v", infos)
+	}
+
+	h, err := b.Open(&d.Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write([]byte{1, 2})
+	report := []byte{3}
+	h.Write(report)
+	report[0] = 4 // Reports are copied
+	if r := d.Reports(); len(r) != 2 || r[1][0] != 3 {
+		t.Errorf("reports = %x", r)
+	}
+
+	d.Input([]byte{5, 6, 7})
+	buf := make([]byte, 2)
+	if n, err := h.Read(buf); n != 2 || err != nil || buf[1] != 6 {
+		t.Errorf("Read = %d, %v, %x", n, err, buf)
+	}
+
+	// Disconnecting fails reads which are blocked, and later writes
+	done := make(chan error)
+	go func() {
+		_, err := h.Read(buf)
+		done <- err
+	}()
+	b.Disconnect(d.Info.Path)
+	if err := <-done; err != ErrDisconnected {
+		t.Errorf("Read after disconnect = %v", err)
+	}
+	if _, err := h.Write(report); err != ErrDisconnected {
+		t.Errorf("Write after disconnect = %v", err)
+	}
+	if _, err := b.Open(&d.Info); err == nil {
+		t.Error("opened disconnected device")
+	}
+
+	h.Close()
+	if d.IsOpen() {
+		t.Error("closed device still open")
+	}
+	if _, err := h.Write(report); err != ErrClosed {
+		t.Errorf("Write after close = %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package hidtest
+
+import (
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+// Pack is a TelemetryPack with settable values, which also implements the
+// optional engine, lap, position, fuel and indicator packs
+type Pack struct {
+	Gear       int
+	RevLight   int
+	Speed      int
+	RPM        int
+	MaxRPM     int
+	IdleRPM    int
+	Lap        int
+	Position   int
+	Fuel       float32
+	FuelMax    float32
+	Indicators hid.Indicators
+}
+
+func (p *Pack) GetGear() int                  { return p.Gear }
+func (p *Pack) GetRevLightPercent() int       { return p.RevLight }
+func (p *Pack) GetSpeed() int                 { return p.Speed }
+func (p *Pack) GetRPM() int                   { return p.RPM }
+func (p *Pack) GetMaxRPM() int                { return p.MaxRPM }
+func (p *Pack) GetIdleRPM() int               { return p.IdleRPM }
+func (p *Pack) GetLap() int                   { return p.Lap }
+func (p *Pack) GetLapTime() float32           { return 0 }
+func (p *Pack) GetLastLapTime() float32       { return 0 }
+func (p *Pack) GetBestLapTime() float32       { return 0 }
+func (p *Pack) GetPosition() int              { return p.Position }
+func (p *Pack) GetFuel() float32              { return p.Fuel }
+func (p *Pack) GetFuelCapacity() float32      { return p.FuelMax }
+func (p *Pack) GetIndicators() hid.Indicators { return p.Indicators }
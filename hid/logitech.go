@@ -0,0 +1,149 @@
+package hid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+func init() {
+	RegisterDriver("logitech-wheel", newLogitechWheel)
+}
+
+// A definition without a match is for a G29.  DefaultDefinitions also lists
+// the PlayStation G923.  The G920 and Xbox G923 speak HID++ instead of the
+// classic commands, so they aren't supported.
+const (
+	logitechVendorID = 0x046d
+	g29ProductID     = 0xc24f
+)
+
+// The rev LED report is the classic Logitech "set LEDs" command, the same as
+// the Linux hid-lg4ff driver sends, after the zero report ID.  Bits 0-4 of
+// the mask light the five LEDs from the outside in.
+const (
+	logitechLEDs    = 5
+	logitechCommand = 0xf8
+	logitechSetLEDs = 0x12
+)
+
+// LogitechOptions are the "options" of a logitech-wheel device definition:
+//
+//	{"thresholds": [84, 88, 92, 95, 97], "flash": 99, "flash_ms": 80}
+//
+// Each LED lights at its rev light percent threshold, and all of them flash
+// once the rev light percent reaches Flash, as at the limiter.  A Flash of zero
+// disables flashing.
+type LogitechOptions struct {
+	Thresholds []float64 `json:"thresholds"`
+	Flash      float64   `json:"flash"`
+	FlashMS    int       `json:"flash_ms"` // LEDs are on, then off, for this long
+}
+
+func defaultLogitechOptions() LogitechOptions {
+	return LogitechOptions{
+		Thresholds: []float64{84, 88, 92, 95, 97},
+		Flash:      99,
+		FlashMS:    80,
+	}
+}
+
+// logitechWheel drives the rev LEDs of a G29 or PlayStation G923.  The game
+// owns the wheel's force feedback, so only the LED command is ever written.
+// Wheels are opened shared and never read, and the LEDs only written when they
+// change, which leaves the game's force feedback undisturbed.
+type logitechWheel struct {
+	thresholds []float64
+	flash      float64
+	flashEvery time.Duration
+
+	snd, last []byte
+	sent      bool
+	now       func() time.Time // Flashing clock, replaced by tests
+	*SimDashDevice
+}
+
+func newLogitechWheel(def *Definition) (HIDPackSender, error) {
+	opts := defaultLogitechOptions()
+	if len(def.Options) > 0 {
+		if err := json.Unmarshal(def.Options, &opts); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.Thresholds) != logitechLEDs {
+		return nil, fmt.Errorf("%d thresholds for %d LEDs", len(opts.Thresholds), logitechLEDs)
+	}
+	for i := 1; i < len(opts.Thresholds); i++ {
+		if opts.Thresholds[i] < opts.Thresholds[i-1] {
+			return nil, fmt.Errorf("thresholds aren't in order")
+		}
+	}
+	if opts.Flash > 0 && opts.FlashMS <= 0 {
+		return nil, fmt.Errorf("flash_ms %d isn't positive", opts.FlashMS)
+	}
+
+	dev := def.device()
+	if dev.VendorID == 0 && dev.ProductID == 0 {
+		dev.VendorID, dev.ProductID = logitechVendorID, g29ProductID
+	}
+	w := &logitechWheel{
+		thresholds:    opts.Thresholds,
+		flash:         opts.Flash,
+		flashEvery:    time.Duration(opts.FlashMS) * time.Millisecond,
+		SimDashDevice: dev,
+	}
+	return w.Instance(dev), nil
+}
+
+func (w *logitechWheel) Instance(d *SimDashDevice) HIDPackSender {
+	return &logitechWheel{
+		thresholds:    w.thresholds,
+		flash:         w.flash,
+		flashEvery:    w.flashEvery,
+		snd:           []byte{0, logitechCommand, logitechSetLEDs, 0, 0, 0, 0, 0},
+		last:          make([]byte, 8),
+		now:           time.Now,
+		SimDashDevice: d,
+	}
+}
+
+// setDevice also forgets the last LEDs, so a reopened wheel is sent them
+func (w *logitechWheel) setDevice(dev io.WriteCloser) {
+	w.SimDashDevice.setDevice(dev)
+	w.sent = false
+}
+
+// leds is the LED mask for the rev light percent
+func (w *logitechWheel) leds(revs float64) byte {
+	if w.flash > 0 && revs >= w.flash {
+		if (w.now().UnixNano()/int64(w.flashEvery))%2 == 1 {
+			return 0
+		}
+		return 1<<logitechLEDs - 1
+	}
+	var mask byte
+	for i, level := range w.thresholds {
+		if revs >= level {
+			mask |= 1 << uint(i)
+		}
+	}
+	return mask
+}
+
+func (w *logitechWheel) SendPack(p TelemetryPack) {
+	w.snd[3] = w.leds(float64(p.GetRevLightPercent()))
+
+	// Skip sending the report if the LEDs haven't changed
+	if w.sent && bytes.Equal(w.snd, w.last) {
+		return
+	}
+
+	// Write failures are handled by the registrar
+	if _, err := w.Write(w.snd); err != nil {
+		return
+	}
+	copy(w.last, w.snd)
+	w.sent = true
+}
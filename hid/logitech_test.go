@@ -0,0 +1,86 @@
+package hid
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogitechWheel(t *testing.T) {
+	tmpl := loadTemplates(t, `{"devices": [{
+		"driver": "logitech-wheel",
+		"options": {"thresholds": [80, 85, 90, 95, 98], "flash": 99, "flash_ms": 100}
+	}]}`)[0]
+	if d := tmpl.template(); d.VendorID != 0x046d || d.ProductID != 0xc24f {
+		t.Errorf("template = %+v", d)
+	}
+
+	var fw fakeWriter
+	w := tmpl.Instance(&SimDashDevice{}).(*logitechWheel)
+	w.setDevice(&fw)
+	clock := time.Unix(0, 0)
+	w.now = func() time.Time { return clock }
+
+	send := func(revs int) []byte {
+		t.Helper()
+		n := len(fw.reports)
+		w.SendPack(&fakePack{revs: revs})
+		w.flush()
+		if len(fw.reports) == n {
+			return nil
+		}
+		return fw.reports[len(fw.reports)-1]
+	}
+
+	if rep := send(87); string(rep) != "\x00\xf8\x12\x03\x00\x00\x00\x00" {
+		t.Errorf("report = %x", rep)
+	}
+	if rep := send(88); rep != nil {
+		t.Errorf("unchanged LEDs sent %x", rep)
+	}
+
+	// At the limiter all the LEDs flash
+	if rep := send(100); rep == nil || rep[3] != 0x1f {
+		t.Errorf("flash on = %x", rep)
+	}
+	clock = clock.Add(100 * time.Millisecond)
+	if rep := send(100); rep == nil || rep[3] != 0 {
+		t.Errorf("flash off = %x", rep)
+	}
+	clock = clock.Add(100 * time.Millisecond)
+	if rep := send(100); rep == nil || rep[3] != 0x1f {
+		t.Errorf("flash on again = %x", rep)
+	}
+
+	// A reopened wheel is sent the LEDs again
+	w.setDevice(&fw)
+	if rep := send(100); rep == nil || rep[3] != 0x1f {
+		t.Errorf("reopened = %x", rep)
+	}
+}
+
+func TestLogitechOptionErrors(t *testing.T) {
+	for _, opts := range []string{
+		`{"thresholds": [80, 90]}`,
+		`{"thresholds": [80, 90, 85, 95, 98]}`,
+		`{"flash_ms": 0}`,
+	} {
+		_, err := LoadDefinitions(strings.NewReader(`{"devices": [{"driver": "logitech-wheel", "options": ` + opts + `}]}`))
+		if err == nil {
+			t.Errorf("loaded %s", opts)
+		}
+	}
+}
+
+func TestLogitechDefaults(t *testing.T) {
+	// Only wheels taking the classic LED command, not HID++ ones
+	var wheels []uint16
+	for _, tmpl := range loadTemplates(t, DefaultDefinitions) {
+		if _, ok := tmpl.(*logitechWheel); ok {
+			wheels = append(wheels, tmpl.template().ProductID)
+		}
+	}
+	if len(wheels) != 2 || wheels[0] != g29ProductID || wheels[1] != 0xc266 {
+		t.Errorf("wheels = %x", wheels)
+	}
+}
@@ -0,0 +1,62 @@
+package hid
+
+import (
+	"time"
+)
+
+// peakSettle is how long the highest RPM seen must stand before it's taken as
+// the maximum RPM
+const peakSettle = 5 * time.Second
+
+// PeakRPM learns the maximum RPM of games which don't send it, from the
+// highest RPM seen.  A peak is only taken as the maximum once it has stood for
+// a few seconds and is at least twice the lowest running RPM, ie. idle, so the
+// rev lights aren't full at idle or at the first blip of the throttle.  Until
+// then the maximum is unknown.
+type PeakRPM struct {
+	peak, low float32
+	learnt    float32
+	since     time.Time        // When peak was reached
+	now       func() time.Time // Clock, replaced by tests
+}
+
+// Update with the RPM of a packet
+func (r *PeakRPM) Update(rpm float32) {
+	if rpm <= 0 {
+		return // Engine off
+	}
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+	if r.peak > r.learnt && r.peak >= 2*r.low && now.Sub(r.since) >= peakSettle {
+		r.learnt = r.peak
+	}
+	if rpm > r.peak {
+		r.peak, r.since = rpm, now
+	}
+	if r.low == 0 || rpm < r.low {
+		r.low = rpm
+	}
+}
+
+// Max is set, when the user gave a maximum RPM, otherwise the learnt maximum
+// or zero while it's unknown
+func (r *PeakRPM) Max(set float32) float32 {
+	if set > 0 {
+		return set
+	}
+	return r.learnt
+}
+
+// Percent of the Max which rpm is, up to 100, for the rev lights
+func (r *PeakRPM) Percent(rpm, set float32) int {
+	max := r.Max(set)
+	if max <= 0 {
+		return 0
+	}
+	if rpm >= max {
+		return 100
+	}
+	return int(100 * rpm / max)
+}
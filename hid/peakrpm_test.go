@@ -0,0 +1,48 @@
+package hid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeakRPM(t *testing.T) {
+	clock := time.Unix(0, 0)
+	r := PeakRPM{now: func() time.Time { return clock }}
+	update := func(rpm float32, after time.Duration) {
+		clock = clock.Add(after)
+		r.Update(rpm)
+	}
+
+	// Idling for a long time doesn't make idle the maximum
+	update(900, 0)
+	update(900, time.Minute)
+	if r.Percent(900, 0) != 0 {
+		t.Errorf("Rev = %d at idle", r.Percent(900, 0))
+	}
+
+	// Nor does a blip, until it has stood
+	update(7000, time.Second)
+	update(3000, time.Second)
+	if r.Percent(3000, 0) != 0 {
+		t.Errorf("Rev = %d before the peak stood", r.Percent(3000, 0))
+	}
+	update(3500, peakSettle)
+	if r.Max(0) != 7000 || r.Percent(3500, 0) != 50 {
+		t.Errorf("Max = %f, Rev = %d", r.Max(0), r.Percent(3500, 0))
+	}
+
+	// A new peak is full rev lights, and the maximum once it has stood
+	update(8000, time.Second)
+	if r.Max(0) != 7000 || r.Percent(8000, 0) != 100 {
+		t.Errorf("Max = %f, Rev = %d above the maximum", r.Max(0), r.Percent(8000, 0))
+	}
+	update(4000, peakSettle)
+	if r.Max(0) != 8000 {
+		t.Errorf("Max = %f", r.Max(0))
+	}
+
+	// A maximum given by the user is used as is
+	if r.Max(6000) != 6000 || r.Percent(4500, 6000) != 75 {
+		t.Errorf("Max = %f, Rev = %d with a set maximum", r.Max(6000), r.Percent(4500, 6000))
+	}
+}
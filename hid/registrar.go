@@ -1,12 +1,13 @@
 package hid
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"sort"
 	"sync"
-
-	"github.com/karalabe/hid"
+	"time"
 )
 
 // PackSender is a generic interface for a writing telemetry packs
@@ -20,58 +21,190 @@ type PackSender interface {
 type HIDPackSender interface {
 	PackSender
 
+	// Instance returns a new device of the same model, which is sent telemetry
+	// for the connected device d.  Registered devices are templates, and an
+	// instance is made for every connected device which matches one.
+	Instance(d *SimDashDevice) HIDPackSender
+
 	// Sealed methods only implemented by SimDashDevice
 	getDevice() io.WriteCloser
 	setDevice(io.WriteCloser)
-	equals(*hid.DeviceInfo) bool
+	onFailure(func())
+	writeErr() error
+	flush()
+	stats() Stats
+	template() *SimDashDevice
+	equals(*DeviceInfo) bool
 	debug() bool // TODO change to an enumerated type to allow more device types
 }
 
 type SimDashDevice struct {
 	VendorID  uint16
 	ProductID uint16
-	UsagePage uint16
-	Usage     uint16
+	UsagePage uint16 // Zero matches any
+	Usage     uint16 // Zero matches any
+
+	// Serial and Path tell apart instances of the same model.  When set on a
+	// registered device, only the connected device with that serial number or
+	// platform path matches it.
+	Serial string
+	Path   string
+
+	// Channel the device displays, if it can display more than one.  It can be
+	// chosen per serial number with AssignChannel.
+	Channel Channel
 
-	// TODO allow multiple instances of the same device
 	device io.WriteCloser
+	w      *writer // Started by the first Write
+	st     *deviceStats
+	failed func()
 }
 
+// ErrNotConnected is returned when writing to a device which isn't open
+var ErrNotConnected = errors.New("hid: device not connected")
+
+// Write a report to the device.  The report is copied and written by the
+// device's own goroutine, replacing any earlier report not yet written, so
+// Write doesn't wait for the device.  Drivers needn't handle failures, as the
+// registrar closes and reopens a device which fails to write.
 func (d *SimDashDevice) Write(p []byte) (int, error) {
-	return d.device.Write(p)
+	if d.device == nil {
+		return 0, ErrNotConnected
+	}
+	return d.writer().Write(p)
+}
+
+// WriteControl writes a control report, such as a brightness setting, in the
+// same way as Write.  Control reports are written ahead of telemetry reports,
+// and aren't replaced by them when the device can't keep up.
+func (d *SimDashDevice) WriteControl(p []byte) (int, error) {
+	if d.device == nil {
+		return 0, ErrNotConnected
+	}
+	return d.writer().WriteControl(p)
+}
+
+func (d *SimDashDevice) writer() *writer {
+	if d.w == nil {
+		if d.st == nil {
+			d.st = &deviceStats{}
+		}
+		d.w = newWriter(d.device, d.st, d.failed)
+	}
+	return d.w
 }
 
 func (d *SimDashDevice) String() string {
-	return fmt.Sprintf(
+	s := fmt.Sprintf(
 		"VID=%d PID=%d UsagePage=%d Usage=%d",
 		d.VendorID,
 		d.ProductID,
 		d.UsagePage,
 		d.Usage)
+	if d.Serial != "" {
+		s += " Serial=" + d.Serial
+	}
+	if d.Path != "" {
+		s += " Path=" + d.Path
+	}
+	return s
 }
 
 func (d *SimDashDevice) setDevice(dev io.WriteCloser) {
+	if d.w != nil {
+		d.w.stop()
+		d.w = nil
+	}
 	d.device = dev
 }
 
+func (d *SimDashDevice) onFailure(f func()) {
+	d.failed = f
+}
+
+func (d *SimDashDevice) writeErr() error {
+	if d.w == nil {
+		return nil
+	}
+	return d.w.error()
+}
+
+func (d *SimDashDevice) flush() {
+	if d.w != nil {
+		d.w.flush()
+	}
+}
+
+func (d *SimDashDevice) stats() Stats {
+	var st Stats
+	if d.st != nil {
+		st = d.st.get()
+	}
+	st.Device, st.Path, st.Serial = d.String(), d.Path, d.Serial
+	return st
+}
+
 func (d *SimDashDevice) getDevice() io.WriteCloser {
 	return d.device
 }
 
-func (d *SimDashDevice) equals(h *hid.DeviceInfo) bool {
+func (d *SimDashDevice) template() *SimDashDevice {
+	return d
+}
+
+func (d *SimDashDevice) equals(h *DeviceInfo) bool {
 	if d.VendorID == h.VendorID &&
 		d.ProductID == h.ProductID &&
-		d.UsagePage == h.UsagePage &&
-		d.Usage == h.Usage {
+		(d.UsagePage == 0 || d.UsagePage == h.UsagePage) &&
+		(d.Usage == 0 || d.Usage == h.Usage) &&
+		(d.Serial == "" || d.Serial == h.Serial) &&
+		(d.Path == "" || d.Path == h.Path) {
 		return true
 	}
 	return false
 }
 
+// specific is whether the device only matches a particular instance
+func (d *SimDashDevice) specific() bool {
+	return d.Serial != "" || d.Path != ""
+}
+
+// instance of the device template for the connected device h
+func (d *SimDashDevice) instance(h *DeviceInfo) *SimDashDevice {
+	return &SimDashDevice{
+		VendorID:  d.VendorID,
+		ProductID: d.ProductID,
+		UsagePage: d.UsagePage,
+		Usage:     d.Usage,
+		Serial:    h.Serial,
+		Path:      h.Path,
+		Channel:   d.Channel,
+	}
+}
+
 func (d *SimDashDevice) debug() bool {
 	return false
 }
 
+// InputHandler is optionally implemented by a telemetry device which reads
+// input reports, such as switch positions.  HandleInput is called with each
+// report from a goroutine of its own, concurrently with SendPack.
+type InputHandler interface {
+	HandleInput(report []byte)
+}
+
+// inputLoop passes input reports from device to h until the device is closed
+func inputLoop(device Device, h InputHandler) {
+	buf := make([]byte, 64)
+	for {
+		n, err := device.Read(buf)
+		if err != nil {
+			return
+		}
+		h.HandleInput(buf[:n])
+	}
+}
+
 // DebugDevice is the same as SimDashDevice but telmetry is not sent to it,
 // instead an infinite loop reads messages from the device and logs the output.
 type DebugDevice struct {
@@ -83,24 +216,79 @@ func (d *DebugDevice) debug() bool {
 	return true
 }
 
+func (d *DebugDevice) Instance(dev *SimDashDevice) HIDPackSender {
+	return &DebugDevice{SimDashDevice: dev}
+}
+
 // HIDRegistrar fulfills UsbDeviceNotifier interface but adds SendPack method
 type HIDRegistrar interface {
 	PackSender
 
 	Add(uintptr)
 	Remove(uintptr)
+
+	// Flush waits until the reports sent to each device have been written
+	Flush()
+
+	// Stats of every telemetry device which is connected or reconnecting,
+	// ordered by path
+	Stats() []Stats
+
+	// OnEvent calls f with every device event, in order.  f is called with the
+	// registrar locked, so it mustn't block or call the registrar.
+	OnEvent(f func(Event))
+}
+
+const (
+	// Reconnection backoff after a write failure doubles from minBackoff up to
+	// maxBackoff, giving up after maxAttempts
+	minBackoff  = 100 * time.Millisecond
+	maxBackoff  = 5 * time.Second
+	maxAttempts = 20
+)
+
+// errVanished is the reconnection failure when a device is no longer
+// enumerated, but no removal was notified
+var errVanished = errors.New("device vanished")
+
+// retry is a device being reconnected after a write failure
+type retry struct {
+	attempt int
+	timer   *time.Timer
 }
 
 type registrar struct {
-	logger  *log.Logger // TODO probably better to use an interface
-	once    sync.Once
-	mu      sync.Mutex
-	devices []HIDPackSender
-	writers []HIDPackSender
+	logger    *log.Logger // TODO probably better to use an interface
+	backend   Backend     // The current backend if nil
+	once      sync.Once
+	mu        sync.Mutex
+	devices   []HIDPackSender          // Registered device templates
+	instances map[string]HIDPackSender // Connected devices by path
+	writers   []HIDPackSender
+	retries   map[string]*retry  // Failed devices by path
+	channels  map[string]Channel // Channels assigned by serial number
+	onEvent   func(Event)
+
+	minBackoff, maxBackoff time.Duration
+	maxAttempts            int
 }
 
-var r = &registrar{}
+var r = newRegistrar(nil)
+
+func newRegistrar(b Backend) *registrar {
+	return &registrar{
+		backend:     b,
+		instances:   make(map[string]HIDPackSender),
+		retries:     make(map[string]*retry),
+		channels:    make(map[string]Channel),
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+		maxAttempts: maxAttempts,
+	}
+}
 
+// Register a device model.  Every connected device matching it gets its own
+// instance, so several of the same model can be used at once.
 func Register(d HIDPackSender) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -108,6 +296,16 @@ func Register(d HIDPackSender) {
 	r.devices = append(r.devices, d)
 }
 
+// AssignChannel to the device with the serial number, so that devices of the
+// same model can display different telemetry.  It applies to devices which
+// connect afterwards.
+func AssignChannel(serial string, c Channel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.channels[serial] = c
+}
+
 // Registrar returns the HIDRegistrar which fullfills the UsbDeviceNotifier
 // interface and is intended to receive notifications on device changes via
 // WM_DEVICECHANGE messages.  Any HID devices which are detected can be written
@@ -121,6 +319,29 @@ func Registrar(logger *log.Logger) HIDRegistrar {
 	return r
 }
 
+// NewRegistrar returns a HIDRegistrar independent of Registrar, which finds
+// devices using the backend b and sends telemetry to the devices given.  It's
+// mostly useful for testing drivers with a fake backend.
+func NewRegistrar(b Backend, logger *log.Logger, devices ...HIDPackSender) HIDRegistrar {
+	reg := newRegistrar(b)
+	reg.logger = logger
+	reg.devices = devices
+	reg.Add(uintptr(0))
+	return reg
+}
+
+// DevicePaths returns the platform path of every connected HID device, which
+// can be compared between calls to notice devices connecting or disconnecting.
+// It returns none if devices can't be enumerated.
+func DevicePaths() []string {
+	devices, _ := currentBackend().Enumerate()
+	paths := make([]string, len(devices))
+	for i, d := range devices {
+		paths[i] = d.Path
+	}
+	return paths
+}
+
 func (r *registrar) logf(format string, args ...interface{}) {
 	if r.logger != nil {
 		r.logger.Printf(format, args...)
@@ -129,6 +350,51 @@ func (r *registrar) logf(format string, args ...interface{}) {
 	}
 }
 
+func (r *registrar) OnEvent(f func(Event)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onEvent = f
+}
+
+// emit an event about dev, logging it and passing it to the event handler
+func (r *registrar) emit(e Event, dev HIDPackSender) {
+	e.Time = time.Now()
+	e.Device = fmt.Sprint(dev)
+	e.Path = dev.template().Path
+	e.Serial = dev.template().Serial
+	e.Debug = dev.debug()
+	r.logf("%v", &e)
+	if r.onEvent != nil {
+		r.onEvent(e)
+	}
+}
+
+func (r *registrar) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.writers {
+		d.flush()
+	}
+}
+
+func (r *registrar) Stats() []Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stats []Stats
+	for _, d := range r.instances {
+		if !d.debug() {
+			stats = append(stats, d.stats())
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Path < stats[j].Path })
+	return stats
+}
+
+// SendPack to every device's driver.  Drivers' writes are queued for each
+// device's own goroutine, so a slow device doesn't hold up the others.
 func (r *registrar) SendPack(p TelemetryPack) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -136,10 +402,113 @@ func (r *registrar) SendPack(p TelemetryPack) {
 	for _, d := range r.writers {
 		d.SendPack(p)
 	}
+	r.reap()
+}
+
+// failed is called by a device's writer when a write fails
+func (r *registrar) failed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reap()
+}
+
+// reap closes devices which failed to write, and tries to reopen them
+func (r *registrar) reap() {
+	var i int
+	for _, d := range r.writers {
+		if err := d.writeErr(); err != nil {
+			r.emit(Event{Type: EventWriteFailed, Err: err}, d)
+			dev := d.getDevice()
+			d.setDevice(nil)
+			dev.Close()
+			r.retry(d.template().Path, 1, err)
+			continue
+		}
+		r.writers[i] = d
+		i++
+	}
+	r.writers = r.writers[:i]
+}
+
+// retry reopening the device at path after backing off
+func (r *registrar) retry(path string, attempt int, err error) {
+	backoff := r.minBackoff
+	for n := 1; n < attempt && backoff < r.maxBackoff; n++ {
+		backoff *= 2
+	}
+	if backoff > r.maxBackoff {
+		backoff = r.maxBackoff
+	}
+	r.emit(Event{Type: EventReconnecting, Err: err, Attempt: attempt, Backoff: backoff}, r.instances[path])
+	r.retries[path] = &retry{
+		attempt: attempt,
+		timer:   time.AfterFunc(backoff, func() { r.reopen(path) }),
+	}
+}
+
+// reopen a device which failed, backing off again if it can't be.  A device
+// which is never enumerated again is forgotten after maxAttempts, so that it's
+// opened afresh if it's plugged back in.
+func (r *registrar) reopen(path string) {
+	b := r.getBackend()
+	devices, err := b.Enumerate()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rt, ok := r.retries[path]
+	if !ok {
+		return // Removed meanwhile
+	}
+	delete(r.retries, path)
+	dev := r.instances[path]
+
+	if err == nil {
+		err = errVanished
+		for i := range devices {
+			if devices[i].Path != path {
+				continue
+			}
+			var device Device
+			if device, err = b.Open(&devices[i]); err == nil {
+				dev.setDevice(device)
+				dev.onFailure(r.failed)
+				r.writers = append(r.writers, dev)
+				r.emit(Event{Type: EventReconnected}, dev)
+				if h, ok := dev.(InputHandler); ok {
+					go inputLoop(device, h)
+				}
+				return
+			}
+		}
+	}
+
+	if rt.attempt >= r.maxAttempts {
+		delete(r.instances, path)
+		r.emit(Event{Type: EventGaveUp, Err: err}, dev)
+		return
+	}
+	r.retry(path, rt.attempt+1, err)
+}
+
+func (r *registrar) getBackend() Backend {
+	if r.backend != nil {
+		return r.backend
+	}
+	return currentBackend()
 }
 
 func (r *registrar) Remove(_ uintptr) {
-	devices := hid.Enumerate(0, 0)
+	devices, err := r.getBackend().Enumerate()
+	if err != nil {
+		r.logf("HID enumeration failed : %v", err)
+		return
+	}
+	connected := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		connected[d.Path] = true
+	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -147,59 +516,97 @@ func (r *registrar) Remove(_ uintptr) {
 	// Remove any writers that aren't connected
 	var i int
 	for _, conn := range r.writers {
-		for _, d := range devices {
-			// If device is still connected, make sure its in the writers array
-			if conn.equals(&d) {
-				r.writers[i] = conn
-				i++
-			}
+		// If device is still connected, make sure its in the writers array
+		if connected[conn.template().Path] {
+			r.writers[i] = conn
+			i++
 		}
 	}
 	r.writers = r.writers[:i]
 
-	// Close devices that are disconnected
-	for _, dev := range r.devices {
-		var found bool
-		for _, d := range devices {
-			if dev.equals(&d) {
-				found = true
+	// Close devices that are disconnected, and stop reconnecting them
+	for path, dev := range r.instances {
+		if !connected[path] {
+			if rt, ok := r.retries[path]; ok {
+				rt.timer.Stop()
+				delete(r.retries, path)
 			}
-		}
-
-		if !found && dev.getDevice() != nil {
-			r.logf("HID device disconnected : %v", dev)
-			dev.getDevice().Close()
-			dev.setDevice(nil)
+			if device := dev.getDevice(); device != nil {
+				dev.setDevice(nil)
+				device.Close()
+			}
+			r.emit(Event{Type: EventDisconnected}, dev)
+			delete(r.instances, path)
 		}
 	}
 }
 
 func (r *registrar) Add(_ uintptr) {
-	devices := hid.Enumerate(0, 0)
+	b := r.getBackend()
+	devices, err := b.Enumerate()
+	if err != nil {
+		r.logf("HID enumeration failed : %v", err)
+		return
+	}
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Check which writers are supported
-	for _, dev := range r.devices {
-		for _, d := range devices {
-			if dev.equals(&d) && dev.getDevice() == nil {
-				if device, err := d.Open(); err != nil {
-					r.logf("%v : %v", err, dev)
-				} else if dev.debug() {
-					r.logf("HID debug device connected : %v", dev)
-					dev.setDevice(device)
-					debugger := &Debugger{
-						Device: device,
-						Log:    r.logger,
-					}
-					go debugger.ReadLoop()
-				} else {
-					r.logf("HID telemetry device connected : %v", dev)
-					dev.setDevice(device)
-					r.writers = append(r.writers, dev)
-				}
+	// Open an instance of the matching device for every new device
+	for i := range devices {
+		d := &devices[i]
+		if _, ok := r.instances[d.Path]; ok {
+			continue
+		}
+		tmpl := r.match(d)
+		if tmpl == nil {
+			continue
+		}
+
+		inst := tmpl.template().instance(d)
+		if c, ok := r.channels[d.Serial]; ok {
+			inst.Channel = c
+		}
+		dev := tmpl.Instance(inst)
+
+		if device, err := b.Open(d); err != nil {
+			r.logf("%v : %v", err, dev)
+		} else if dev.debug() {
+			dev.setDevice(device)
+			r.instances[d.Path] = dev
+			r.emit(Event{Type: EventConnected}, dev)
+			debugger := &Debugger{
+				Device: device,
+				Log:    r.logger,
 			}
+			go debugger.ReadLoop()
+		} else {
+			dev.setDevice(device)
+			dev.onFailure(r.failed)
+			r.instances[d.Path] = dev
+			r.writers = append(r.writers, dev)
+			r.emit(Event{Type: EventConnected}, dev)
+			if h, ok := dev.(InputHandler); ok {
+				go inputLoop(device, h)
+			}
+		}
+	}
+}
+
+// match returns the registered device template matching d, preferring one
+// registered for its particular serial number or path
+func (r *registrar) match(d *DeviceInfo) HIDPackSender {
+	var match HIDPackSender
+	for _, dev := range r.devices {
+		if !dev.equals(d) {
+			continue
+		}
+		if dev.template().specific() {
+			return dev
+		}
+		if match == nil {
+			match = dev
 		}
 	}
+	return match
 }
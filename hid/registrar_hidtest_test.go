@@ -0,0 +1,257 @@
+package hid_test
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jake-dog/opensimdash/hid"
+	"github.com/jake-dog/opensimdash/hid/hidtest"
+)
+
+var (
+	teensyInfo = hid.DeviceInfo{VendorID: 0x16c0, ProductID: 0x0480, UsagePage: 0xffab, Usage: 0x200}
+	debugInfo  = hid.DeviceInfo{VendorID: 0x16c0, ProductID: 0x0480, UsagePage: 0xff31, Usage: 0x74}
+)
+
+func TestRegistrarHotplug(t *testing.T) {
+	b := hidtest.NewBackend()
+	a := teensyInfo
+	a.Path, a.Serial = "a", "A"
+	devA := b.Connect(a)
+	other := b.Connect(hid.DeviceInfo{VendorID: 0x046d, ProductID: 0xc077}) // A mouse
+
+	r := hid.NewRegistrar(b, nil, hid.LoadTemplates(t, hid.DefaultDefinitions)...)
+	if !devA.IsOpen() || other.IsOpen() {
+		t.Fatalf("open = %t, %t", devA.IsOpen(), other.IsOpen())
+	}
+
+	// A second teensy of the same model gets its own instance
+	bi := teensyInfo
+	bi.Path, bi.Serial = "b", "B"
+	devB := b.Connect(bi)
+	r.Add(0)
+	r.SendPack(&hidtest.Pack{RevLight: 86})
+	r.Flush()
+	for _, d := range []*hidtest.Device{devA, devB} {
+		if rep := d.LastReport(); len(rep) != 65 || rep[1] != 0x07 {
+			t.Errorf("%s report = %x", d.Info.Path, rep)
+		}
+	}
+
+	// Unplugged devices are closed and no longer sent telemetry
+	b.Disconnect("a")
+	r.Remove(0)
+	if devA.IsOpen() {
+		t.Error("disconnected device still open")
+	}
+	r.SendPack(&hidtest.Pack{RevLight: 100})
+	r.Flush()
+	if n := len(devA.Reports()); n != 1 {
+		t.Errorf("disconnected device sent %d reports", n)
+	}
+	if rep := devB.LastReport(); rep[1] != 0xff {
+		t.Errorf("b report = %x", rep)
+	}
+
+	// Plugging back in opens the device again
+	devA = b.Connect(a)
+	r.Add(0)
+	r.SendPack(&hidtest.Pack{RevLight: 80})
+	r.Flush()
+	if devA.Opens() != 1 || devA.LastReport()[1] != 0x01 {
+		t.Errorf("reconnected opens = %d, reports = %x", devA.Opens(), devA.Reports())
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for a logger and a test to share
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncBuffer) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(b)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+func TestRegistrarDebugDevice(t *testing.T) {
+	b := hidtest.NewBackend()
+	dev := b.Connect(debugInfo)
+	var out syncBuffer
+	r := hid.NewRegistrar(b, log.New(&out, "", 0), hid.LoadTemplates(t, hid.DefaultDefinitions)...)
+
+	dev.Input([]byte("shift light on\n"))
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(out.String(), "shift light on") {
+		if time.Now().After(deadline) {
+			t.Fatalf("log = %q", out.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Debug devices aren't sent telemetry
+	r.SendPack(&hidtest.Pack{RevLight: 100})
+	r.Flush()
+	if n := len(dev.Reports()); n != 0 {
+		t.Errorf("debug device sent %d reports", n)
+	}
+
+	// Unplugging stops the debugger
+	b.Disconnect(dev.Info.Path)
+	r.Remove(0)
+	for !strings.Contains(out.String(), "Aborting debugging") {
+		if time.Now().After(deadline) {
+			t.Fatalf("log = %q", out.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// events collects registrar events, so tests can wait for them
+type events chan hid.Event
+
+func (ev events) wait(t *testing.T, want hid.EventType) hid.Event {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-ev:
+			if e.Type == want {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %v", want)
+		}
+	}
+}
+
+func TestRegistrarWriteFailure(t *testing.T) {
+	b := hidtest.NewBackend()
+	info := teensyInfo
+	info.Path = "a"
+	dev := b.Connect(info)
+	r := hid.NewRegistrar(b, nil, hid.LoadTemplates(t, hid.DefaultDefinitions)...)
+	hid.SetBackoff(r, time.Millisecond, 4*time.Millisecond, 100)
+	ev := make(events, 100)
+	r.OnEvent(func(e hid.Event) { ev <- e })
+
+	// A failed write closes the device, which is reopened once it recovers
+	failure := errors.New("pipe error")
+	dev.FailWrites(failure)
+	r.SendPack(&hidtest.Pack{RevLight: 86})
+	r.Flush()
+	if e := ev.wait(t, hid.EventWriteFailed); e.Err != failure || e.Path != "a" {
+		t.Errorf("failed event = %+v", e)
+	}
+	if e := ev.wait(t, hid.EventReconnecting); e.Attempt != 1 || e.Backoff != time.Millisecond {
+		t.Errorf("reconnecting event = %+v", e)
+	}
+	dev.FailWrites(nil)
+	ev.wait(t, hid.EventReconnected)
+	if dev.Opens() != 2 || !dev.IsOpen() {
+		t.Errorf("opens = %d, open = %t", dev.Opens(), dev.IsOpen())
+	}
+	r.SendPack(&hidtest.Pack{RevLight: 100})
+	r.Flush()
+	if rep := dev.LastReport(); rep == nil || rep[1] != 0xff {
+		t.Errorf("report after reconnecting = %x", rep)
+	}
+}
+
+func TestRegistrarVanishedDevice(t *testing.T) {
+	b := hidtest.NewBackend()
+	info := teensyInfo
+	info.Path = "a"
+	b.Connect(info)
+	r := hid.NewRegistrar(b, nil, hid.LoadTemplates(t, hid.DefaultDefinitions)...)
+	hid.SetBackoff(r, time.Millisecond, 2*time.Millisecond, 3)
+	ev := make(events, 100)
+	r.OnEvent(func(e hid.Event) { ev <- e })
+
+	// Unplugged without a removal notification, so only writes notice
+	b.Disconnect("a")
+	r.SendPack(&hidtest.Pack{RevLight: 86})
+	r.Flush()
+	if e := ev.wait(t, hid.EventWriteFailed); e.Err != hidtest.ErrDisconnected {
+		t.Errorf("failed event = %+v", e)
+	}
+
+	// Plugged back in while reconnecting
+	dev := b.Connect(info)
+	ev.wait(t, hid.EventReconnected)
+	r.SendPack(&hidtest.Pack{RevLight: 86})
+	r.Flush()
+	if rep := dev.LastReport(); rep == nil || rep[1] != 0x07 {
+		t.Errorf("report after reconnecting = %x", rep)
+	}
+
+	// Never plugged back in, so forgotten until it's added again
+	b.Disconnect("a")
+	r.SendPack(&hidtest.Pack{RevLight: 100})
+	r.Flush()
+	if e := ev.wait(t, hid.EventGaveUp); e.Err == nil {
+		t.Errorf("gave up event = %+v", e)
+	}
+	dev = b.Connect(info)
+	r.Add(0)
+	ev.wait(t, hid.EventConnected)
+	if !dev.IsOpen() {
+		t.Error("device not reopened")
+	}
+}
+
+func TestRegistrarSlowDevice(t *testing.T) {
+	b := hidtest.NewBackend()
+	ai, bi := teensyInfo, teensyInfo
+	ai.Path, bi.Path = "a", "b"
+	slow, fast := b.Connect(ai), b.Connect(bi)
+	r := hid.NewRegistrar(b, nil, hid.LoadTemplates(t, hid.DefaultDefinitions)...)
+
+	// A stalled device holds up neither the others nor SendPack
+	slow.HoldWrites()
+	for i, revs := range []int{80, 86, 100} {
+		r.SendPack(&hidtest.Pack{RevLight: revs})
+		deadline := time.Now().Add(time.Second)
+		for len(fast.Reports()) != i+1 {
+			if time.Now().After(deadline) {
+				t.Fatalf("fast device reports = %x", fast.Reports())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	slow.ReleaseWrites()
+	r.Flush()
+
+	// The slow device skips to the latest report
+	if n := len(fast.Reports()); n != 3 {
+		t.Errorf("fast device wrote %d reports", n)
+	}
+	reports := slow.Reports()
+	if len(reports) == 0 || len(reports) > 2 || reports[len(reports)-1][1] != 0xff {
+		t.Errorf("slow device reports = %x", reports)
+	}
+
+	stats := r.Stats()
+	if len(stats) != 2 || stats[0].Path != "a" || stats[1].Path != "b" {
+		t.Fatalf("stats = %+v", stats)
+	}
+	st := stats[0]
+	if st.Reports != 3 || st.Writes != uint64(len(reports)) || st.Coalesced != 3-st.Writes || st.Failures != 0 {
+		t.Errorf("slow device stats = %+v", st)
+	}
+	if st.MaxLatency <= 0 || st.AvgLatency > st.MaxLatency {
+		t.Errorf("slow device latency = %+v", st)
+	}
+}
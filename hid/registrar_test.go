@@ -0,0 +1,78 @@
+package hid
+
+import "testing"
+
+type fakeWriter struct {
+	reports [][]byte
+}
+
+func (w *fakeWriter) Write(b []byte) (int, error) {
+	w.reports = append(w.reports, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+type fakePack struct {
+	revs       int
+	indicators Indicators
+}
+
+func (p *fakePack) GetGear() int              { return 3 }
+func (p *fakePack) GetRevLightPercent() int   { return p.revs }
+func (p *fakePack) GetSpeed() int             { return 100 }
+func (p *fakePack) GetIndicators() Indicators { return p.indicators }
+
+func TestMatch(t *testing.T) {
+	model := SimDashDevice{VendorID: 1, ProductID: 2, UsagePage: 3, Usage: 4}
+	generic := &reportDevice{SimDashDevice: &model}
+	bySerial := &reportDevice{SimDashDevice: &SimDashDevice{
+		VendorID: 1, ProductID: 2, UsagePage: 3, Usage: 4, Serial: "B",
+	}}
+	reg := &registrar{devices: []HIDPackSender{generic, bySerial}}
+
+	a := DeviceInfo{VendorID: 1, ProductID: 2, UsagePage: 3, Usage: 4, Serial: "A", Path: "/a"}
+	b := DeviceInfo{VendorID: 1, ProductID: 2, UsagePage: 3, Usage: 4, Serial: "B", Path: "/b"}
+	other := DeviceInfo{VendorID: 1, ProductID: 5, UsagePage: 3, Usage: 4}
+	if m := reg.match(&a); m != generic {
+		t.Errorf("match(A) = %v", m)
+	}
+	if m := reg.match(&b); m != bySerial {
+		t.Errorf("match(B) = %v", m)
+	}
+	if m := reg.match(&other); m != nil {
+		t.Errorf("match(other) = %v", m)
+	}
+
+	inst := generic.template().instance(&a)
+	if inst.Serial != "A" || inst.Path != "/a" || inst.VendorID != 1 || inst.device != nil {
+		t.Errorf("instance = %+v", inst)
+	}
+}
+
+func TestTeensyChannels(t *testing.T) {
+	tmpl := loadTemplates(t, DefaultDefinitions)[0]
+	revs := tmpl.Instance(&SimDashDevice{Serial: "A"}).(*reportDevice)
+	flags := tmpl.Instance(&SimDashDevice{Serial: "B", Channel: ChannelIndicators}).(*reportDevice)
+	var rw, fw fakeWriter
+	revs.setDevice(&rw)
+	flags.setDevice(&fw)
+
+	p := &fakePack{revs: 86, indicators: IndicatorShiftLight | IndicatorHandbrake | IndicatorOilWarning}
+	revs.SendPack(p)
+	flags.SendPack(p)
+	revs.flush()
+	flags.flush()
+
+	// Reports start with the zero report ID, and only the first eight
+	// indicators are shown
+	if len(rw.reports) != 1 || len(rw.reports[0]) != 65 || rw.reports[0][0] != 0 || rw.reports[0][1] != 0x07 {
+		t.Errorf("rev light reports = %x", rw.reports)
+	}
+	if len(fw.reports) != 1 || fw.reports[0][0] != 0 || fw.reports[0][1] != 0x05 {
+		t.Errorf("indicator reports = %x", fw.reports)
+	}
+	if &revs.snd[0] == &flags.snd[0] {
+		t.Error("instances share a report buffer")
+	}
+}
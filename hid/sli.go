@@ -0,0 +1,377 @@
+package hid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterDriver("sli-pro", newSLIPro)
+	RegisterDriver("sli-m", newSLIM)
+}
+
+// Leo Bodnar SLI-Pro and SLI-M USB IDs
+const (
+	sliVendorID     = 0x1dd2
+	sliProProductID = 0x0103
+	sliMProductID   = 0x1110
+)
+
+// Output reports.  The LED report sets every digit and LED at once, and the
+// brightness report sets the brightness of all of them.
+//
+//	byte  0      report type, sliReportLEDs
+//	byte  1      gear digit
+//	bytes 2-14   RPM LEDs, left to right, non-zero to light
+//	bytes 15-20  left panel digits
+//	bytes 21-26  right panel digits
+//	bytes 27-32  status LEDs, non-zero to light
+//
+// Digits are 7-segment patterns, segments a-g being bits 0-6 and the decimal
+// point bit 7.  The SLI-M has four digit panels, which show the first four
+// digits of each.
+const (
+	sliReportLEDs       = 0x01
+	sliReportBrightness = 0x02
+	sliReportSize       = 43
+
+	sliGear    = 1
+	sliRPM     = 2
+	sliLeft    = 15
+	sliRight   = 21
+	sliStatus  = 27
+	sliRPMLEDs = 13
+	sliDigits  = 6 // Digits per panel of the SLI-Pro
+	sliStatusN = 6
+)
+
+// The SLI-Pro input report carries its analogue inputs, where rotary switches
+// are connected, as little endian uint16 from sliInputAnalog
+const (
+	sliInputAnalog   = 9
+	sliInputChannels = 8
+)
+
+// sliViewLabel is how long the name of a view is shown after paging to it
+const sliViewLabel = time.Second
+
+// SLIOptions are the "options" of an SLI-Pro or SLI-M device definition:
+//
+//	{
+//	  "brightness": 200,
+//	  "rpm_range": [80, 97],
+//	  "status": ["shift_light", "pit_limiter", "abs", "traction_control", "handbrake", "oil_warning"],
+//	  "views": [
+//	    {"name": "SPd", "left": "speed", "right": "rpm"},
+//	    {"name": "LAP", "left": "lap", "right": "position"}
+//	  ],
+//	  "view_switch": 0,
+//	  "view_positions": 12
+//	}
+//
+// The SLI-Pro pages between views with the rotary switch on analogue input
+// ViewSwitch, each position showing the next view in turn.  Without it, or on
+// the SLI-M, the first view is shown.
+type SLIOptions struct {
+	Brightness    *int        `json:"brightness"` // 0-254, default 254
+	RPMRange      *[2]float64 `json:"rpm_range"`  // Rev light percent of the first and last RPM LEDs
+	Status        []Channel   `json:"status"`     // Channels lighting each status LED
+	Views         []SLIView   `json:"views"`
+	ViewSwitch    *int        `json:"view_switch"`    // Analogue input of the view rotary switch
+	ViewPositions int         `json:"view_positions"` // Positions of the view rotary switch, default 12
+}
+
+// SLIView is the channels shown on the left and right panels
+type SLIView struct {
+	Name  string  `json:"name"` // Shown on the left panel when paged to
+	Left  Channel `json:"left"`
+	Right Channel `json:"right"`
+}
+
+// defaultSLIOptions returns new options each time, as unmarshalling options
+// over them reuses their slices
+func defaultSLIOptions() SLIOptions {
+	return SLIOptions{
+		RPMRange: &[2]float64{80, 97},
+		Status: []Channel{
+			"shift_light", "pit_limiter", "abs",
+			"traction_control", "handbrake", "oil_warning",
+		},
+		Views: []SLIView{
+			{Name: "SPd", Left: ChannelSpeed, Right: ChannelRPM},
+			{Name: "LAP", Left: ChannelLap, Right: ChannelPosition},
+			{Name: "FUEL", Left: ChannelFuelPercent, Right: ChannelSpeed},
+		},
+		ViewPositions: 12,
+	}
+}
+
+// sli drives an SLI-Pro or SLI-M
+type sli struct {
+	opts       SLIOptions
+	digits     int // Digits per panel
+	rpmLevels  []float64
+	brightness byte
+
+	snd, last []byte
+	sent      bool
+	dimmed    bool // Whether brightness was set since opening
+
+	mu        sync.Mutex // Guards the view, which input reports change
+	view      int
+	viewSince time.Time
+	*SimDashDevice
+}
+
+func newSLIPro(def *Definition) (HIDPackSender, error) {
+	return newSLI(def, sliProProductID, sliDigits)
+}
+
+func newSLIM(def *Definition) (HIDPackSender, error) {
+	return newSLI(def, sliMProductID, 4)
+}
+
+func newSLI(def *Definition, productID uint16, digits int) (HIDPackSender, error) {
+	opts := defaultSLIOptions()
+	if len(def.Options) > 0 {
+		if err := json.Unmarshal(def.Options, &opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ViewPositions <= 0 {
+		opts.ViewPositions = defaultSLIOptions().ViewPositions
+	}
+	if opts.RPMRange == nil {
+		opts.RPMRange = defaultSLIOptions().RPMRange
+	}
+	if len(opts.Views) == 0 {
+		return nil, fmt.Errorf("no views")
+	}
+	if len(opts.Status) > sliStatusN {
+		return nil, fmt.Errorf("%d status channels for %d status LEDs", len(opts.Status), sliStatusN)
+	}
+	for _, c := range opts.Status {
+		if !c.Valid() {
+			return nil, fmt.Errorf("unknown status channel %q", c)
+		}
+	}
+	for _, v := range opts.Views {
+		if !v.Left.Valid() || !v.Right.Valid() {
+			return nil, fmt.Errorf("unknown channel in view %q", v.Name)
+		}
+	}
+	if s := opts.ViewSwitch; s != nil && (*s < 0 || *s >= sliInputChannels) {
+		return nil, fmt.Errorf("view switch %d isn't an analogue input", *s)
+	}
+
+	brightness := 254
+	if opts.Brightness != nil {
+		brightness = *opts.Brightness
+		if brightness < 0 || brightness > 254 {
+			return nil, fmt.Errorf("brightness %d isn't 0-254", brightness)
+		}
+	}
+
+	// Spread the RPM LEDs evenly over the range, as for an Output range
+	levels := make([]float64, sliRPMLEDs)
+	for i := range levels {
+		levels[i] = opts.RPMRange[0] + (opts.RPMRange[1]-opts.RPMRange[0])*float64(i)/float64(sliRPMLEDs-1)
+	}
+
+	dev := def.device()
+	if dev.VendorID == 0 && dev.ProductID == 0 {
+		dev.VendorID, dev.ProductID = sliVendorID, productID
+	}
+	s := &sli{
+		opts:          opts,
+		digits:        digits,
+		rpmLevels:     levels,
+		brightness:    byte(brightness),
+		SimDashDevice: dev,
+	}
+	return s.Instance(dev), nil
+}
+
+func (s *sli) Instance(d *SimDashDevice) HIDPackSender {
+	return &sli{
+		opts:          s.opts,
+		digits:        s.digits,
+		rpmLevels:     s.rpmLevels,
+		brightness:    s.brightness,
+		snd:           make([]byte, sliReportSize),
+		last:          make([]byte, sliReportSize),
+		SimDashDevice: d,
+	}
+}
+
+// setDevice also forgets what was sent, so a reopened device is sent it again
+func (s *sli) setDevice(dev io.WriteCloser) {
+	s.SimDashDevice.setDevice(dev)
+	s.sent, s.dimmed = false, false
+}
+
+// HandleInput pages between views with the view rotary switch
+func (s *sli) HandleInput(report []byte) {
+	if s.opts.ViewSwitch == nil {
+		return
+	}
+	offset := sliInputAnalog + 2*(*s.opts.ViewSwitch)
+	if offset+2 > len(report) {
+		return
+	}
+	v := binary.LittleEndian.Uint16(report[offset:])
+	position := int(v) * s.opts.ViewPositions / (math.MaxUint16 + 1)
+	view := position % len(s.opts.Views)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if view != s.view {
+		s.view, s.viewSince = view, time.Now()
+	}
+}
+
+// currentView and whether its name is being shown
+func (s *sli) currentView() (*SLIView, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &s.opts.Views[s.view], !s.viewSince.IsZero() && time.Since(s.viewSince) < sliViewLabel
+}
+
+// report computes the LED report for the telemetry
+func (s *sli) report(p TelemetryPack) []byte {
+	for i := range s.snd {
+		s.snd[i] = 0
+	}
+	s.snd[0] = sliReportLEDs
+
+	// Gear
+	switch g := p.GetGear(); {
+	case g < 0:
+		s.snd[sliGear] = sevenSegment('r')
+	case g == 0:
+		s.snd[sliGear] = sevenSegment('n')
+	case g <= 9:
+		s.snd[sliGear] = sevenSegment(byte('0' + g))
+	default:
+		s.snd[sliGear] = sevenSegment('-')
+	}
+
+	// RPM LEDs
+	revs := float64(p.GetRevLightPercent())
+	for i, level := range s.rpmLevels {
+		if revs >= level {
+			s.snd[sliRPM+i] = 1
+		}
+	}
+
+	// Panels
+	view, label := s.currentView()
+	if label {
+		s.panel(sliLeft, view.Name)
+	} else {
+		s.panel(sliLeft, s.format(view.Left, p))
+	}
+	s.panel(sliRight, s.format(view.Right, p))
+
+	// Status LEDs
+	for i, c := range s.opts.Status {
+		if v, ok := c.Value(p); ok && v != 0 {
+			s.snd[sliStatus+i] = 1
+		}
+	}
+	return s.snd
+}
+
+// format the channel's value to fit a panel, as dashes if it doesn't fit or
+// blank if it isn't reported
+func (s *sli) format(c Channel, p TelemetryPack) string {
+	v, ok := c.Value(p)
+	if !ok {
+		return ""
+	}
+	if c == ChannelStageProgress {
+		v *= 100
+	}
+	text := strconv.FormatInt(int64(math.Round(v)), 10)
+	if len(text) > s.digits {
+		text = ""
+		for len(text) < s.digits {
+			text += "-"
+		}
+	}
+	return text
+}
+
+// panel writes text right aligned to the panel starting at offset.  A '.'
+// lights the decimal point of the digit before it.
+func (s *sli) panel(offset int, text string) {
+	var digits []byte
+	for i := 0; i < len(text); i++ {
+		if text[i] == '.' && len(digits) > 0 {
+			digits[len(digits)-1] |= 0x80
+			continue
+		}
+		digits = append(digits, sevenSegment(text[i]))
+	}
+	if len(digits) > s.digits {
+		digits = digits[:s.digits]
+	}
+	copy(s.snd[offset+s.digits-len(digits):offset+s.digits], digits)
+}
+
+func (s *sli) SendPack(p TelemetryPack) {
+	// Brightness is set once per opening, and isn't replaced by LED reports
+	if !s.dimmed {
+		if _, err := s.WriteControl([]byte{sliReportBrightness, s.brightness}); err != nil {
+			return
+		}
+		s.dimmed = true
+	}
+
+	// Skip sending the report if it hasn't changed
+	report := s.report(p)
+	if s.sent && bytes.Equal(report, s.last) {
+		return
+	}
+
+	// Write failures are handled by the registrar
+	if _, err := s.Write(report); err != nil {
+		return
+	}
+	copy(s.last, report)
+	s.sent = true
+}
+
+// sevenSegmentFont has the segments lit for each character a 7-segment digit
+// can show recognizably, segments a-g being bits 0-6
+var sevenSegmentFont = map[byte]byte{
+	'0': 0x3f, '1': 0x06, '2': 0x5b, '3': 0x4f, '4': 0x66,
+	'5': 0x6d, '6': 0x7d, '7': 0x07, '8': 0x7f, '9': 0x6f,
+	'-': 0x40, '_': 0x08, ' ': 0x00,
+	'A': 0x77, 'b': 0x7c, 'C': 0x39, 'c': 0x58, 'd': 0x5e,
+	'E': 0x79, 'F': 0x71, 'G': 0x3d, 'H': 0x76, 'h': 0x74,
+	'I': 0x06, 'J': 0x1e, 'L': 0x38, 'n': 0x54, 'o': 0x5c,
+	'P': 0x73, 'q': 0x67, 'r': 0x50, 'S': 0x6d, 't': 0x78,
+	'U': 0x3e, 'u': 0x1c, 'y': 0x6e,
+}
+
+// sevenSegment pattern for c, trying the other case if it has no pattern
+func sevenSegment(c byte) byte {
+	if seg, ok := sevenSegmentFont[c]; ok {
+		return seg
+	}
+	switch {
+	case c >= 'a' && c <= 'z':
+		return sevenSegmentFont[c-'a'+'A']
+	case c >= 'A' && c <= 'Z':
+		return sevenSegmentFont[c-'A'+'a']
+	}
+	return 0
+}
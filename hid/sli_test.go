@@ -0,0 +1,104 @@
+package hid_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jake-dog/opensimdash/hid"
+	"github.com/jake-dog/opensimdash/hid/hidtest"
+)
+
+func TestSLIPro(t *testing.T) {
+	b := hidtest.NewBackend()
+	dev := b.Connect(hid.DeviceInfo{VendorID: 0x1dd2, ProductID: 0x0103})
+	r := hid.NewRegistrar(b, nil, hid.LoadTemplates(t, `{"devices": [{
+		"driver": "sli-pro",
+		"options": {
+			"brightness": 100,
+			"rpm_range": [80, 92],
+			"status": ["abs", "pit_limiter"],
+			"views": [
+				{"name": "SPd", "left": "speed", "right": "rpm"},
+				{"name": "LAP", "left": "lap", "right": "position"}
+			],
+			"view_switch": 1
+		}
+	}]}`)[0])
+
+	p := &hidtest.Pack{Gear: 3, RevLight: 85, Speed: 123, RPM: 7450, Lap: 4, Position: 12, Indicators: hid.IndicatorPitLimiter}
+	r.SendPack(p)
+	r.Flush()
+	reports := dev.Reports()
+	if len(reports) != 2 {
+		t.Fatalf("reports = %x", reports)
+	}
+	if string(reports[0]) != "\x02\x64" {
+		t.Errorf("brightness report = %x", reports[0])
+	}
+
+	want := make([]byte, 43)
+	want[0] = 0x01
+	want[1] = 0x4f                                     // 3
+	copy(want[2:], []byte{1, 1, 1, 1, 1, 1})           // 80 to 85 of 80 to 92
+	copy(want[15:], []byte{0, 0, 0, 0x06, 0x5b, 0x4f}) // 123
+	copy(want[21:], []byte{0, 0, 0x07, 0x66, 0x6d, 0x3f})
+	want[28] = 1 // Pit limiter
+	if string(reports[1]) != string(want) {
+		t.Errorf("LED report = %x, want %x", reports[1], want)
+	}
+
+	// Turning the view switch to its second position shows the next view,
+	// labelled at first
+	input := make([]byte, 32)
+	input[11], input[12] = 0x00, 0x18 // Analogue input 1, 0x1800 of 0xffff
+	dev.Input(input)
+	deadline := time.Now().Add(time.Second)
+	for {
+		r.SendPack(p)
+		r.Flush()
+		if rep := dev.LastReport(); rep[18] == 0x38 && rep[26] == 0x5b {
+			break // LAP and position 12
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("view not changed, report = %x", dev.LastReport())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+}
+
+func TestSLIM(t *testing.T) {
+	b := hidtest.NewBackend()
+	dev := b.Connect(hid.DeviceInfo{VendorID: 0x1dd2, ProductID: 0x1110})
+	r := hid.NewRegistrar(b, nil, hid.LoadTemplates(t, `{"devices": [{"driver": "sli-m"}]}`)[0])
+
+	// Four digit panels, so a five digit RPM doesn't fit
+	r.SendPack(&hidtest.Pack{Gear: -1, Speed: 88, RPM: 12000, MaxRPM: 13000})
+	r.Flush()
+	rep := dev.LastReport()
+	if rep == nil || rep[1] != 0x50 {
+		t.Fatalf("gear = %x", rep)
+	}
+	if left := rep[15:21]; string(left) != "\x00\x00\x7f\x7f\x00\x00" {
+		t.Errorf("left panel = %x", left)
+	}
+	if right := rep[21:27]; string(right) != "\x40\x40\x40\x40\x00\x00" {
+		t.Errorf("right panel = %x", right)
+	}
+}
+
+func TestSLIOptionErrors(t *testing.T) {
+	for _, opts := range []string{
+		`{"views": []}`,
+		`{"views": [{"left": "boost", "right": "rpm"}]}`,
+		`{"status": ["abs", "abs", "abs", "abs", "abs", "abs", "abs"]}`,
+		`{"brightness": 255}`,
+		`{"view_switch": 8}`,
+	} {
+		_, err := hid.LoadDefinitions(strings.NewReader(`{"devices": [{"driver": "sli-pro", "options": ` + opts + `}]}`))
+		if err == nil {
+			t.Errorf("loaded %s", opts)
+		}
+	}
+}
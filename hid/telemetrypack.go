@@ -8,3 +8,144 @@ type TelemetryPack interface {
 	GetRevLightPercent() int
 	GetSpeed() int
 }
+
+// EnginePack is optionally implemented by a TelemetryPack which reports engine
+// speed in RPM.  Values which the game doesn't send are zero.
+type EnginePack interface {
+	GetRPM() int
+	GetMaxRPM() int
+	GetIdleRPM() int
+}
+
+// StagePack is optionally implemented by a TelemetryPack from point-to-point
+// (rally) games which report progress through a stage.
+type StagePack interface {
+	GetStageProgress() float32 // 0.0 at the start line, 1.0 at the finish
+	GetStageDistance() float32 // Meters driven since the start line
+	GetStageLength() float32   // Meters
+	GetStageTime() float32     // Seconds since the start line
+}
+
+// SplitPack is optionally implemented by a TelemetryPack from point-to-point
+// games which time the stage at split points.
+type SplitPack interface {
+	// GetSplits are the stage times at the splits passed so far this stage,
+	// in seconds.  The slice may be reused between packets.
+	GetSplits() []float32
+}
+
+// LapPack is optionally implemented by a TelemetryPack which reports lap
+// counts and lap times.  Times are in seconds and zero when not yet set.
+type LapPack interface {
+	GetLap() int
+	GetLapTime() float32
+	GetLastLapTime() float32
+	GetBestLapTime() float32
+}
+
+// Standing is a single row of a leaderboard
+type Standing struct {
+	Position    int
+	CarIndex    int
+	RaceNumber  int
+	Driver      string
+	Laps        int
+	GapToLeader float32 // Seconds behind the leader
+	GapAhead    float32 // Seconds behind the car in front
+	LastLapTime float32
+	BestLapTime float32
+	InPit       bool
+}
+
+// PositionPack is optionally implemented by a TelemetryPack which reports the
+// race position of the player's (or focused) car, zero if unknown.
+type PositionPack interface {
+	GetPosition() int
+}
+
+// StandingsPack is optionally implemented by a TelemetryPack which knows the
+// position of every car in the session.
+type StandingsPack interface {
+	PositionPack
+
+	// GetStandings ordered by position.  The slice is reused between packets so
+	// it must not be retained.
+	GetStandings() []Standing
+
+	// GetCarCount is the number of cars GetStandings would return, without the
+	// cost of building and sorting them
+	GetCarCount() int
+}
+
+// FuelPack is optionally implemented by a TelemetryPack which reports fuel.
+// Units are whatever the game uses, so only the ratio is meaningful.
+type FuelPack interface {
+	GetFuel() float32
+	GetFuelCapacity() float32
+}
+
+// TyrePack is optionally implemented by a TelemetryPack which reports tyre and
+// brake temperatures in centigrade.  Wheels are ordered front left, front
+// right, rear left, rear right.
+type TyrePack interface {
+	GetTyreTemps() [4]float32
+	GetBrakeTemps() [4]float32
+}
+
+// Indicators is a bitmask of dashboard warning lights
+type Indicators uint32
+
+// Dashboard warning lights
+const (
+	IndicatorShiftLight Indicators = 1 << iota
+	IndicatorFullBeam
+	IndicatorHandbrake
+	IndicatorPitLimiter
+	IndicatorTractionControl
+	IndicatorABS
+	IndicatorLeftSignal
+	IndicatorRightSignal
+	IndicatorOilWarning
+	IndicatorBattery
+)
+
+// IndicatorPack is optionally implemented by a TelemetryPack which reports
+// which dashboard warning lights are lit.
+type IndicatorPack interface {
+	GetIndicators() Indicators
+}
+
+// NamePack is optionally implemented by a TelemetryPack which can name the
+// stage or track and the car, empty while unknown.
+type NamePack interface {
+	GetStageName() string
+	GetCarName() string
+}
+
+// Capabilities of a TelemetryPack, ie. which of the optional packs it reports
+const (
+	CapEngine uint32 = 1 << iota
+	CapStage
+	CapLap
+	CapPosition
+	CapFuel
+	CapTyre
+	CapIndicator
+	CapName
+	CapStandings
+	CapSplits
+)
+
+// CapsPack is implemented by a TelemetryPack which implements every optional
+// pack, but only reports some of them, like the model received over a bridge.
+type CapsPack interface {
+	// Has reports whether all of the capabilities are reported
+	Has(caps uint32) bool
+}
+
+// Reports is whether p reports the optional packs of caps, if it implements
+// them.  Only a CapsPack implements packs it doesn't report.
+func Reports(p TelemetryPack, caps uint32) bool {
+	c, ok := p.(CapsPack)
+	return !ok || c.Has(caps)
+}
@@ -0,0 +1,232 @@
+package hid
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateWindow is how long write rates are averaged over
+const rateWindow = time.Second
+
+// Stats of the reports sent to a device since it was first connected
+type Stats struct {
+	Device string `json:"device"`
+	Path   string `json:"path"`
+	Serial string `json:"serial"`
+
+	Reports   uint64 `json:"reports"`   // Reports sent by the driver
+	Writes    uint64 `json:"writes"`    // Reports written to the device
+	Coalesced uint64 `json:"coalesced"` // Reports replaced by a newer one before being written
+	Failures  uint64 `json:"failures"`  // Failed writes
+
+	// WriteRate is writes per second, over about the last second
+	WriteRate float64 `json:"write_rate"`
+
+	// Latency from the driver sending a report until it was written, for the
+	// last write, on average and at worst
+	Latency    time.Duration `json:"latency"`
+	AvgLatency time.Duration `json:"avg_latency"`
+	MaxLatency time.Duration `json:"max_latency"`
+}
+
+// deviceStats are shared by the writers of a device across reconnections
+type deviceStats struct {
+	mu    sync.Mutex
+	stats Stats
+	total time.Duration // Latency of every write, for the average
+
+	windowStart  time.Time
+	windowWrites int
+}
+
+func (s *deviceStats) get() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.stats
+	if st.Writes > 0 {
+		st.AvgLatency = s.total / time.Duration(st.Writes)
+	}
+	// Writes stopping altogether should show as a falling rate
+	if elapsed := time.Since(s.windowStart); elapsed > 2*rateWindow {
+		st.WriteRate = 0
+	}
+	return st
+}
+
+func (s *deviceStats) written(latency time.Duration, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Writes++
+	s.stats.Latency = latency
+	s.total += latency
+	if latency > s.stats.MaxLatency {
+		s.stats.MaxLatency = latency
+	}
+
+	s.windowWrites++
+	if s.windowStart.IsZero() {
+		s.windowStart = now
+	} else if elapsed := now.Sub(s.windowStart); elapsed >= rateWindow {
+		s.stats.WriteRate = float64(s.windowWrites) / elapsed.Seconds()
+		s.windowStart, s.windowWrites = now, 0
+	}
+}
+
+// writer writes reports to a device from its own goroutine, so that a slow
+// device holds up neither other devices nor the registrar.  Only the latest
+// report is kept, so a device which can't keep up skips to the newest one
+// rather than falling further behind.
+type writer struct {
+	dev    io.Writer
+	stats  *deviceStats
+	failed func() // Called once, from a new goroutine, when a write fails
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending [2]slot // Control and telemetry reports, written in that order
+	writing bool
+	stopped bool
+	err     error         // First write failure
+	done    chan struct{} // Closed once run returns
+}
+
+// slot holds the latest report of a kind waiting to be written
+type slot struct {
+	report []byte
+	queued time.Time // When the report was sent
+	has    bool      // Whether there's a report waiting
+}
+
+const (
+	slotControl = iota
+	slotTelemetry
+)
+
+func newWriter(dev io.Writer, stats *deviceStats, failed func()) *writer {
+	w := &writer{dev: dev, stats: stats, failed: failed, done: make(chan struct{})}
+	w.cond = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+// Write queues a copy of the report, replacing any report not yet written.
+// It returns the first failure of an earlier write.
+func (w *writer) Write(p []byte) (int, error) {
+	return w.queue(slotTelemetry, p)
+}
+
+// WriteControl queues a copy of a control report, such as a brightness
+// setting, which is written ahead of and never replaced by telemetry reports
+func (w *writer) WriteControl(p []byte) (int, error) {
+	return w.queue(slotControl, p)
+}
+
+func (w *writer) queue(kind int, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+	sl := &w.pending[kind]
+	w.stats.mu.Lock()
+	w.stats.stats.Reports++
+	if sl.has {
+		w.stats.stats.Coalesced++
+	}
+	w.stats.mu.Unlock()
+
+	sl.report = append(sl.report[:0], p...)
+	sl.queued = time.Now()
+	sl.has = true
+	w.cond.Broadcast()
+	return len(p), nil
+}
+
+// next is the slot to write next, or nil if none are waiting
+func (w *writer) next() *slot {
+	for i := range w.pending {
+		if w.pending[i].has {
+			return &w.pending[i]
+		}
+	}
+	return nil
+}
+
+func (w *writer) run() {
+	var report []byte
+	defer close(w.done)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for {
+		sl := w.next()
+		for sl == nil && !w.stopped {
+			w.cond.Wait()
+			sl = w.next()
+		}
+		if w.stopped {
+			return
+		}
+
+		// Swap buffers so the next report can be queued while writing
+		report, sl.report = sl.report, report[:0]
+		queued := sl.queued
+		sl.has, w.writing = false, true
+		w.mu.Unlock()
+
+		_, err := w.dev.Write(report)
+		now := time.Now()
+
+		w.mu.Lock()
+		w.writing = false
+		if !w.stopped {
+			if err != nil {
+				w.stats.mu.Lock()
+				w.stats.stats.Failures++
+				w.stats.mu.Unlock()
+				if w.err == nil {
+					w.err = err
+					if w.failed != nil {
+						go w.failed()
+					}
+				}
+			} else {
+				w.stats.written(now.Sub(queued), now)
+			}
+		}
+		w.cond.Broadcast()
+	}
+}
+
+// error is the first write failure, if any
+func (w *writer) error() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// flush waits until the queued reports are written
+func (w *writer) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for (w.next() != nil || w.writing) && !w.stopped && w.err == nil {
+		w.cond.Wait()
+	}
+}
+
+// stop the writer, discarding any report not yet written.  It waits for a
+// write in progress to return, so that the device can be closed afterwards;
+// hidapi frees the device on closing, even while it's being written.
+func (w *writer) stop() {
+	w.mu.Lock()
+	w.stopped = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+
+	<-w.done
+}
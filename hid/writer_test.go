@@ -0,0 +1,42 @@
+package hid
+
+import (
+	"testing"
+	"time"
+)
+
+// heldWriter blocks each write until it's released
+type heldWriter struct {
+	started, release chan struct{}
+}
+
+func (w *heldWriter) Write(p []byte) (int, error) {
+	w.started <- struct{}{}
+	<-w.release
+	return len(p), nil
+}
+
+func TestWriterStopWaits(t *testing.T) {
+	dev := &heldWriter{started: make(chan struct{}), release: make(chan struct{})}
+	w := newWriter(dev, &deviceStats{}, nil)
+	w.Write([]byte{0, 1})
+	<-dev.started
+
+	// The device mustn't be closed while it's still being written
+	stopped := make(chan struct{})
+	go func() {
+		w.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("stop returned during a write")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(dev.release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop didn't return after the write")
+	}
+}
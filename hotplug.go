@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+// USB device arrival and removal is published to subscribers by a platform
+// specific source: a message only window on Windows (winusb.go) and the kernel
+// uevent netlink socket on Linux (hotplug_linux.go).
+
+const (
+	// Used only for clients listening for USB device events
+	addUSBDevice = iota
+	removeUSBDevice
+)
+
+// Keep track of who is publishing
+type publisher struct {
+	mu          sync.Mutex
+	subscribers []UsbDeviceNotifier
+}
+
+var pub = &publisher{}
+
+func (p *publisher) addSubscriber(sub UsbDeviceNotifier) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subscribers = append(p.subscribers, sub)
+}
+
+func (p *publisher) notify(method int, lParam uintptr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, sub := range p.subscribers {
+		switch method {
+		case addUSBDevice:
+			sub.Add(lParam)
+		case removeUSBDevice:
+			sub.Remove(lParam)
+		}
+	}
+}
+
+// AddSubscriber to the list of USB device notification subscribers.
+func AddSubscriber(sub UsbDeviceNotifier) {
+	pub.addSubscriber(sub)
+}
+
+// UsbDeviceNotifier is an interface for a resource to be notified of USB adds
+// and removals
+type UsbDeviceNotifier interface {
+	Add(uintptr)    // Called on DBT_DEVICEARRIVAL, or a Linux add uevent
+	Remove(uintptr) // Called on DBT_DEVICEREMOVECOMPLETE, or a Linux remove uevent
+}
+
+// ueventSettle is how long to wait after the last of a burst of uevents before
+// notifying, so that udev has time to create the device nodes and apply their
+// permissions
+const ueventSettle = 500 * time.Millisecond
+
+// errUeventsLost is returned by a ueventReader when the kernel dropped uevents
+// because they weren't read fast enough, such as when a hub is plugged in
+var errUeventsLost = errors.New("uevents lost")
+
+// ueventReader reads kernel uevents, one per Read, such as from a netlink
+// socket.  It's an interface so that watchUevents can be fed fake events.
+type ueventReader interface {
+	Read(b []byte) (int, error)
+}
+
+// uevent is a parsed kernel uevent, eg.
+//
+//	add@/devices/.../hidraw/hidraw3\0ACTION=add\0SUBSYSTEM=hidraw\0DEVNAME=hidraw3\0...
+type uevent struct {
+	Action    string
+	Subsystem string
+	DevType   string
+	DevName   string
+}
+
+// parseUevent parses the NUL separated KEY=VALUE pairs of a kernel uevent.
+// ok is false for messages which aren't kernel uevents, such as those sent
+// by udev itself.
+func parseUevent(b []byte) (e uevent, ok bool) {
+	fields := bytes.Split(b, []byte{0})
+	if len(fields) < 2 || bytes.IndexByte(fields[0], '@') < 0 {
+		return e, false
+	}
+	for _, f := range fields[1:] {
+		i := bytes.IndexByte(f, '=')
+		if i < 0 {
+			continue
+		}
+		v := string(f[i+1:])
+		switch string(f[:i]) {
+		case "ACTION":
+			e.Action = v
+		case "SUBSYSTEM":
+			e.Subsystem = v
+		case "DEVTYPE":
+			e.DevType = v
+		case "DEVNAME":
+			e.DevName = v
+		}
+	}
+	return e, e.Action != ""
+}
+
+// method is the publisher method for the uevent, or -1 if it isn't a hidraw
+// node or USB device being added or removed
+func (e *uevent) method() int {
+	if e.Subsystem != "hidraw" && !(e.Subsystem == "usb" && e.DevType == "usb_device") {
+		return -1
+	}
+	switch e.Action {
+	case "add":
+		return addUSBDevice
+	case "remove":
+		return removeUSBDevice
+	}
+	return -1
+}
+
+// watchUevents reads uevents from r until it fails, notifying once hidraw or
+// USB devices have been added or removed and no more uevents have arrived for
+// settle.  Plugging in a device raises a burst of uevents, which are coalesced
+// into a single notification of each method.  Lost uevents are taken to be
+// both, so that every device is enumerated again.
+func watchUevents(r ueventReader, settle time.Duration, notify func(method int)) error {
+	methods := make(chan int)
+	errs := make(chan error, 1)
+	go func() {
+		b := make([]byte, 8192)
+		for {
+			n, err := r.Read(b)
+			if err == errUeventsLost {
+				methods <- removeUSBDevice
+				methods <- addUSBDevice
+				continue
+			} else if err != nil {
+				errs <- err
+				return
+			}
+			e, ok := parseUevent(b[:n])
+			if !ok {
+				continue
+			}
+			if m := e.method(); m >= 0 {
+				methods <- m
+			}
+		}
+	}()
+
+	var added, removed bool
+	flush := func() {
+		if removed {
+			notify(removeUSBDevice)
+		}
+		if added {
+			notify(addUSBDevice)
+		}
+		added, removed = false, false
+	}
+	settled := time.NewTimer(settle)
+	settled.Stop()
+	defer settled.Stop()
+	for {
+		select {
+		case m := <-methods:
+			if m == addUSBDevice {
+				added = true
+			} else {
+				removed = true
+			}
+			if !settled.Stop() {
+				select {
+				case <-settled.C:
+				default:
+				}
+			}
+			settled.Reset(settle)
+		case <-settled.C:
+			flush()
+		case err := <-errs:
+			flush()
+			return err
+		}
+	}
+}
+
+// poller re-enumerates devices at an interval for platforms, or situations,
+// without native hotplug notifications.  A device only counts as connected or
+// disconnected once it has been so for debounce consecutive polls, so devices
+// which bounce during enumeration don't cause spurious notifications.
+type poller struct {
+	enumerate func() []string
+	debounce  int
+
+	known   map[string]bool // Devices confirmed connected
+	pending map[string]int  // Polls a device has differed from known
+}
+
+func newPoller(enumerate func() []string, debounce int) *poller {
+	if debounce < 1 {
+		debounce = 1
+	}
+	p := &poller{
+		enumerate: enumerate,
+		debounce:  debounce,
+		known:     make(map[string]bool),
+		pending:   make(map[string]int),
+	}
+	// Devices present at startup were already added by the registrar
+	for _, d := range enumerate() {
+		p.known[d] = true
+	}
+	return p
+}
+
+// poll enumerates devices once, and returns whether any were confirmed added
+// or removed
+func (p *poller) poll() (added, removed bool) {
+	seen := make(map[string]bool)
+	for _, d := range p.enumerate() {
+		seen[d] = true
+	}
+
+	// Devices which differ from known must keep differing to be confirmed
+	for d := range p.pending {
+		if seen[d] == p.known[d] {
+			delete(p.pending, d)
+		}
+	}
+	for d := range seen {
+		if !p.known[d] {
+			p.pending[d]++
+		}
+	}
+	for d := range p.known {
+		if !seen[d] {
+			p.pending[d]++
+		}
+	}
+
+	for d, n := range p.pending {
+		if n < p.debounce {
+			continue
+		}
+		delete(p.pending, d)
+		if seen[d] {
+			p.known[d] = true
+			added = true
+		} else {
+			delete(p.known, d)
+			removed = true
+		}
+	}
+	return added, removed
+}
+
+// run polls every interval forever, notifying of confirmed changes
+func (p *poller) run(interval time.Duration, notify func(method int)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for range t.C {
+		added, removed := p.poll()
+		if removed {
+			notify(removeUSBDevice)
+		}
+		if added {
+			notify(addUSBDevice)
+		}
+	}
+}
+
+// startHotplug publishes device changes from native notifications, falling
+// back to polling every interval if they're unavailable or poll is set.
+func startHotplug(poll bool, interval time.Duration, debounce int) {
+	var once sync.Once
+	fallback := func(err error) {
+		once.Do(func() {
+			if err != nil {
+				logger.Printf("USB hotplug notifications unavailable, polling every %v: %v", interval, err)
+			}
+			p := newPoller(hid.DevicePaths, debounce)
+			go p.run(interval, func(method int) {
+				pub.notify(method, 0)
+			})
+		})
+	}
+	if poll {
+		fallback(nil)
+		return
+	}
+	nativeHotplug(fallback)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// netlink is a NETLINK_KOBJECT_UEVENT socket subscribed to kernel uevents
+type netlink struct {
+	fd int
+}
+
+func openNetlink() (*netlink, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Pid:    0, // Let the kernel assign a port ID
+		Groups: 1, // Kernel uevents, as opposed to udev's
+	}
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	return &netlink{fd: fd}, nil
+}
+
+func (n *netlink) Read(b []byte) (int, error) {
+	for {
+		c, _, err := syscall.Recvfrom(n.fd, b, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.ENOBUFS {
+			return 0, errUeventsLost
+		}
+		if err != nil {
+			return 0, os.NewSyscallError("recvfrom", err)
+		}
+		return c, nil
+	}
+}
+
+func (n *netlink) Close() error {
+	return syscall.Close(n.fd)
+}
+
+// nativeHotplug publishes kernel uevents, calling fallback if the netlink
+// socket can't be opened or fails.
+func nativeHotplug(fallback func(error)) {
+	go func() {
+		nl, err := openNetlink()
+		if err != nil {
+			fallback(err)
+			return
+		}
+		defer nl.Close()
+		err = watchUevents(nl, ueventSettle, func(method int) {
+			pub.notify(method, 0)
+		})
+		fallback(err)
+	}()
+}
@@ -0,0 +1,14 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+// nativeHotplug isn't available, so always falls back to polling
+func nativeHotplug(fallback func(error)) {
+	fallback(errors.New("no native USB hotplug on " + runtime.GOOS))
+}
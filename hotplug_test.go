@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeUevents returns one event per Read, then an error.  An empty event is
+// read as lost uevents.
+type fakeUevents []string
+
+var errNoEvents = errors.New("no more events")
+
+func (f *fakeUevents) Read(b []byte) (int, error) {
+	if len(*f) == 0 {
+		return 0, errNoEvents
+	}
+	n := copy(b, (*f)[0])
+	*f = (*f)[1:]
+	if n == 0 {
+		return 0, errUeventsLost
+	}
+	return n, nil
+}
+
+// chanUevents returns events as they're sent, and an error once closed
+type chanUevents chan string
+
+func (c chanUevents) Read(b []byte) (int, error) {
+	e, ok := <-c
+	if !ok {
+		return 0, errNoEvents
+	}
+	return copy(b, e), nil
+}
+
+func event(fields ...string) string {
+	return strings.Join(fields, "\x00") + "\x00"
+}
+
+type recorder struct {
+	adds, removes int
+}
+
+func (r *recorder) Add(uintptr)    { r.adds++ }
+func (r *recorder) Remove(uintptr) { r.removes++ }
+
+func TestWatchUevents(t *testing.T) {
+	events := fakeUevents{
+		event("add@/devices/pci0000:00/usb1/1-2/1-2:1.0/0003:16C0:0480.0001/hidraw/hidraw3",
+			"ACTION=add", "DEVPATH=/devices/pci0000:00/usb1/1-2/1-2:1.0/0003:16C0:0480.0001/hidraw/hidraw3",
+			"SUBSYSTEM=hidraw", "DEVNAME=hidraw3", "SEQNUM=4711"),
+		event("add@/devices/pci0000:00/usb1/1-2", "ACTION=add", "SUBSYSTEM=usb", "DEVTYPE=usb_device"),
+		event("add@/devices/pci0000:00/usb1/1-2/1-2:1.0", "ACTION=add", "SUBSYSTEM=usb", "DEVTYPE=usb_interface"),
+		event("add@/devices/virtual/net/veth0", "ACTION=add", "SUBSYSTEM=net"),
+		event("change@/devices/virtual/hidraw/hidraw3", "ACTION=change", "SUBSYSTEM=hidraw"),
+		"libudev\x00\xfe\xed\xca\xfe" + event("ACTION=add", "SUBSYSTEM=hidraw"),
+		event("remove@/devices/pci0000:00/usb1/1-2", "ACTION=remove", "SUBSYSTEM=usb", "DEVTYPE=usb_device"),
+	}
+
+	r := &recorder{}
+	p := &publisher{}
+	p.addSubscriber(r)
+	err := watchUevents(&events, time.Hour, func(method int) {
+		p.notify(method, 0)
+	})
+	if err != errNoEvents {
+		t.Errorf("watchUevents = %v", err)
+	}
+	if r.adds != 1 || r.removes != 1 {
+		t.Errorf("adds = %d, removes = %d", r.adds, r.removes)
+	}
+}
+
+func TestWatchUeventsLost(t *testing.T) {
+	events := fakeUevents{""}
+	var methods []int
+	watchUevents(&events, time.Hour, func(method int) {
+		methods = append(methods, method)
+	})
+	if len(methods) != 2 || methods[0] != removeUSBDevice || methods[1] != addUSBDevice {
+		t.Errorf("methods = %v", methods)
+	}
+}
+
+func TestWatchUeventsSettle(t *testing.T) {
+	events := make(chanUevents)
+	methods := make(chan int, 4)
+	done := make(chan error)
+	go func() {
+		done <- watchUevents(events, 20*time.Millisecond, func(method int) {
+			methods <- method
+		})
+	}()
+
+	// A burst of uevents is a single notification once they've settled
+	for i := 0; i < 3; i++ {
+		events <- event("add@/devices/virtual/hidraw/hidraw3", "ACTION=add", "SUBSYSTEM=hidraw")
+	}
+	select {
+	case m := <-methods:
+		if m != addUSBDevice {
+			t.Errorf("method = %d", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not notified")
+	}
+	close(events)
+	<-done
+	if len(methods) != 0 {
+		t.Errorf("%d more notifications", len(methods))
+	}
+}
+
+func TestParseUevent(t *testing.T) {
+	e, ok := parseUevent([]byte(event("add@/x", "ACTION=add", "SUBSYSTEM=hidraw", "DEVNAME=hidraw0")))
+	if !ok || e.Action != "add" || e.Subsystem != "hidraw" || e.DevName != "hidraw0" {
+		t.Errorf("parseUevent = %+v, %t", e, ok)
+	}
+	if _, ok := parseUevent([]byte("garbage")); ok {
+		t.Error("parsed garbage")
+	}
+}
+
+// fakeEnumerate returns each set of devices in turn, repeating the last
+type fakeEnumerate [][]string
+
+func (f *fakeEnumerate) enumerate() []string {
+	d := (*f)[0]
+	if len(*f) > 1 {
+		*f = (*f)[1:]
+	}
+	return d
+}
+
+func TestPoller(t *testing.T) {
+	polls := fakeEnumerate{
+		{"a"},      // Startup
+		{"a", "b"}, // b connects
+		{"a", "b"}, // b confirmed
+		{"a", "b"},
+		{"b"},      // a bounces
+		{"a", "b"}, // a reconnected before confirmed
+		{"a"},      // b disconnects
+		{"a"},      // b confirmed
+	}
+	p := newPoller(polls.enumerate, 2)
+
+	want := []struct{ added, removed bool }{
+		{false, false},
+		{true, false},
+		{false, false},
+		{false, false},
+		{false, false},
+		{false, false},
+		{false, true},
+	}
+	for i, w := range want {
+		if added, removed := p.poll(); added != w.added || removed != w.removed {
+			t.Errorf("poll %d = %t, %t, want %t, %t", i+1, added, removed, w.added, w.removed)
+		}
+	}
+}
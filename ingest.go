@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Remote relays push raw game datagrams to an Ingest over TCP or a websocket.
+//
+// Over TCP every frame is a big endian uint16 length followed by that many
+// bytes.  The first frame is the shared token, to which the server replies
+// with a single byte: 1 if accepted, 0 if not, after which it hangs up.  Every
+// following frame is one game datagram.
+//
+// Over a websocket the token is sent as "Authorization: Bearer <token>" or as
+// the "token" query parameter, and every binary message is one game datagram.
+//
+// Relays may disconnect and reconnect at any time, and several may push at
+// once; their datagrams are interleaved in the order they arrive.
+
+const (
+	// DefaultIngestAddress is used by NewIngest when the address is empty
+	DefaultIngestAddress = ":20778"
+
+	// IngestPath the websocket endpoint is registered on
+	IngestPath = "/ingest"
+
+	// Largest datagram which can be framed
+	ingestMaxDatagram = 65535
+
+	// Datagrams buffered between relays and Read
+	ingestBuffers = 8
+
+	// Relays must send their token within ingestAuthTimeout of connecting
+	ingestAuthTimeout = 5 * time.Second
+
+	// TCP keepalives notice relays which vanished behind NAT
+	ingestKeepAlive = 10 * time.Second
+)
+
+// Errors returned by an Ingest
+var (
+	ErrIngestClosed = errors.New("ingest: closed")
+	ErrIngestToken  = errors.New("ingest: token required")
+	errIngestFrame  = errors.New("ingest: frame too large")
+)
+
+// Ingest is a telemetry source which receives datagrams from remote relays.
+// Like Telemetry, each Read returns a single datagram.
+type Ingest struct {
+	token   []byte
+	ln      net.Listener
+	packets chan []byte
+	free    chan []byte
+	done    chan struct{}
+	once    sync.Once
+
+	connsmu sync.Mutex
+	conns   map[io.Closer]struct{}
+}
+
+// NewIngest listens for relays on the TCP address, DefaultIngestAddress if
+// empty.  Token is required.  The Ingest is also an http.Handler which accepts
+// websocket relays, and should be registered on IngestPath.
+func NewIngest(address, token string) (*Ingest, error) {
+	if token == "" {
+		return nil, ErrIngestToken
+	}
+	if address == "" {
+		address = DefaultIngestAddress
+	}
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	in := &Ingest{
+		token:   []byte(token),
+		ln:      ln,
+		packets: make(chan []byte, ingestBuffers),
+		free:    make(chan []byte, ingestBuffers),
+		done:    make(chan struct{}),
+		conns:   make(map[io.Closer]struct{}),
+	}
+	for i := 0; i < ingestBuffers; i++ {
+		in.free <- make([]byte, ingestMaxDatagram)
+	}
+	go in.accept()
+	return in, nil
+}
+
+// Addr the relays connect to over TCP
+func (in *Ingest) Addr() net.Addr {
+	return in.ln.Addr()
+}
+
+// Read the next datagram from any relay, blocking until one arrives.  As for
+// UDP, datagrams longer than b are truncated.
+func (in *Ingest) Read(b []byte) (int, error) {
+	select {
+	case p := <-in.packets:
+		n := copy(b, p)
+		in.free <- p[:cap(p)]
+		return n, nil
+	case <-in.done:
+		return 0, ErrIngestClosed
+	}
+}
+
+// DecodePacket from the next datagram, using the optional buffer.  The same
+// buffer rules apply as for Telemetry.DecodePacket.
+func (in *Ingest) DecodePacket(d Decodable, buf []byte) error {
+	return decodePacket(in, d, buf)
+}
+
+// Close the listener and disconnect every relay
+func (in *Ingest) Close() error {
+	err := ErrIngestClosed
+	in.once.Do(func() {
+		close(in.done)
+		err = in.ln.Close()
+
+		in.connsmu.Lock()
+		defer in.connsmu.Unlock()
+		for c := range in.conns {
+			c.Close()
+		}
+	})
+	return err
+}
+
+func (in *Ingest) track(c io.Closer) bool {
+	in.connsmu.Lock()
+	defer in.connsmu.Unlock()
+	select {
+	case <-in.done:
+		c.Close()
+		return false
+	default:
+	}
+	in.conns[c] = struct{}{}
+	return true
+}
+
+func (in *Ingest) untrack(c io.Closer) {
+	in.connsmu.Lock()
+	delete(in.conns, c)
+	in.connsmu.Unlock()
+	c.Close()
+}
+
+func (in *Ingest) authorized(token []byte) bool {
+	return subtle.ConstantTimeCompare(token, in.token) == 1
+}
+
+// buffer waits for a free datagram buffer.  ok is false once closed.
+func (in *Ingest) buffer() (b []byte, ok bool) {
+	select {
+	case b = <-in.free:
+		return b, true
+	case <-in.done:
+		return nil, false
+	}
+}
+
+// push a datagram to Read, or return its buffer if closed
+func (in *Ingest) push(b []byte) bool {
+	select {
+	case in.packets <- b:
+		return true
+	case <-in.done:
+		in.free <- b[:cap(b)]
+		return false
+	}
+}
+
+func (in *Ingest) accept() {
+	for {
+		conn, err := in.ln.Accept()
+		if err != nil {
+			select {
+			case <-in.done:
+				return
+			default:
+			}
+			if e, ok := err.(net.Error); ok && e.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			logger.Println(err)
+			return
+		}
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetKeepAlive(true)
+			tcp.SetKeepAlivePeriod(ingestKeepAlive)
+		}
+		if in.track(conn) {
+			go in.serveTCP(conn)
+		}
+	}
+}
+
+func (in *Ingest) serveTCP(conn net.Conn) {
+	defer in.untrack(conn)
+	r := bufio.NewReader(conn)
+
+	var token [256]byte
+	conn.SetReadDeadline(time.Now().Add(ingestAuthTimeout))
+	n, err := readFrame(r, token[:])
+	if err != nil || !in.authorized(token[:n]) {
+		conn.Write([]byte{0})
+		logger.Println("Relay rejected", conn.RemoteAddr())
+		return
+	}
+	if _, err := conn.Write([]byte{1}); err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	logger.Println("Relay connected", conn.RemoteAddr())
+
+	for {
+		b, ok := in.buffer()
+		if !ok {
+			return
+		}
+		n, err := readFrame(r, b)
+		if err != nil {
+			in.free <- b
+			logger.Println("Relay disconnected", conn.RemoteAddr(), err)
+			return
+		}
+		if !in.push(b[:n]) {
+			return
+		}
+	}
+}
+
+// readFrame reads a length prefixed frame into b
+func readFrame(r io.Reader, b []byte) (int, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[:]))
+	if n > len(b) {
+		return 0, errIngestFrame
+	}
+	return io.ReadFull(r, b[:n])
+}
+
+// ServeHTTP accepts a websocket relay
+func (in *Ingest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if !in.authorized([]byte(token)) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	u := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	ws, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Println(err)
+		return
+	}
+	if !in.track(ws) {
+		return
+	}
+	defer in.untrack(ws)
+	ws.SetReadLimit(ingestMaxDatagram)
+	logger.Println("Relay connected", ws.RemoteAddr())
+
+	for {
+		kind, msg, err := ws.NextReader()
+		if err != nil {
+			logger.Println("Relay disconnected", ws.RemoteAddr(), err)
+			return
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		b, ok := in.buffer()
+		if !ok {
+			return
+		}
+		n, err := io.ReadFull(msg, b)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			in.free <- b
+			logger.Println("Relay disconnected", ws.RemoteAddr(), err)
+			return
+		}
+		if n == 0 {
+			in.free <- b
+			continue
+		}
+		if !in.push(b[:n]) {
+			return
+		}
+	}
+}
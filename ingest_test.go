@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func writeFrame(w io.Writer, b []byte) error {
+	var hdr [2]byte
+	binary.BigEndian.PutUint16(hdr[:], uint16(len(b)))
+	_, err := w.Write(append(hdr[:], b...))
+	return err
+}
+
+// dialRelay connects to in over TCP and sends token, returning the reply
+func dialRelay(t *testing.T, in *Ingest, token string) (net.Conn, byte) {
+	conn, err := net.Dial("tcp", in.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFrame(conn, []byte(token)); err != nil {
+		t.Fatal(err)
+	}
+	var reply [1]byte
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		t.Fatal(err)
+	}
+	return conn, reply[0]
+}
+
+func readDatagram(t *testing.T, in *Ingest, want []byte) {
+	b := make([]byte, 1500)
+	done := make(chan int)
+	go func() {
+		n, _ := in.Read(b)
+		done <- n
+	}()
+	select {
+	case n := <-done:
+		if !bytes.Equal(b[:n], want) {
+			t.Errorf("Read %q, want %q", b[:n], want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %q", want)
+	}
+}
+
+func TestIngestTCP(t *testing.T) {
+	if _, err := NewIngest("127.0.0.1:0", ""); err != ErrIngestToken {
+		t.Errorf("NewIngest without token = %v", err)
+	}
+	in, err := NewIngest("127.0.0.1:0", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	conn, reply := dialRelay(t, in, "wrong")
+	if reply != 0 {
+		t.Error("wrong token accepted")
+	}
+	conn.Close()
+
+	// Relays can reconnect and keep pushing
+	for _, msg := range []string{"first", "second"} {
+		conn, reply := dialRelay(t, in, "secret")
+		if reply != 1 {
+			t.Fatal("token rejected")
+		}
+		writeFrame(conn, []byte(msg))
+		readDatagram(t, in, []byte(msg))
+		conn.Close()
+	}
+
+	in.Close()
+	if _, err := in.Read(make([]byte, 10)); err != ErrIngestClosed {
+		t.Errorf("Read after Close = %v", err)
+	}
+}
+
+func TestIngestWebSocket(t *testing.T) {
+	in, err := NewIngest("127.0.0.1:0", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	srv := httptest.NewServer(in)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url+"?token=wrong", nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Error("wrong token accepted")
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.WriteMessage(websocket.TextMessage, []byte("ignored"))
+	ws.WriteMessage(websocket.BinaryMessage, []byte("datagram"))
+	readDatagram(t, in, []byte("datagram"))
+}
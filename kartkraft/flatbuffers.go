@@ -0,0 +1,82 @@
+package kartkraft
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// table is a minimal, read only FlatBuffers table.  Unlike generated code
+// every access is bounds checked, since frames arrive from the network and a
+// malformed one mustn't panic.  Absent or out of range fields read as zero.
+type table struct {
+	b   []byte
+	pos int
+}
+
+// root returns the root table of a buffer, checking its file identifier
+func root(b []byte, ident string) (table, bool) {
+	if len(b) < 8 || string(b[4:8]) != ident {
+		return table{}, false
+	}
+	t := table{b: b, pos: int(binary.LittleEndian.Uint32(b))}
+	return t, t.valid()
+}
+
+func (t table) valid() bool {
+	if t.pos < 0 || t.pos+4 > len(t.b) {
+		return false
+	}
+	vt := t.vtable()
+	return vt >= 0 && vt+4 <= len(t.b)
+}
+
+func (t table) vtable() int {
+	return t.pos - int(int32(binary.LittleEndian.Uint32(t.b[t.pos:])))
+}
+
+// field returns the absolute position of a field which is size bytes long, or
+// zero if it isn't present.
+func (t table) field(slot, size int) int {
+	vt := t.vtable()
+	o := 4 + 2*slot
+	if o+2 > int(binary.LittleEndian.Uint16(t.b[vt:])) || vt+o+2 > len(t.b) {
+		return 0
+	}
+	off := int(binary.LittleEndian.Uint16(t.b[vt+o:]))
+	if off == 0 || t.pos+off+size > len(t.b) {
+		return 0
+	}
+	return t.pos + off
+}
+
+func (t table) float32(slot int) float32 {
+	if p := t.field(slot, 4); p != 0 {
+		return math.Float32frombits(binary.LittleEndian.Uint32(t.b[p:]))
+	}
+	return 0
+}
+
+func (t table) int32(slot int) int32 {
+	if p := t.field(slot, 4); p != 0 {
+		return int32(binary.LittleEndian.Uint32(t.b[p:]))
+	}
+	return 0
+}
+
+func (t table) int8(slot int) int8 {
+	if p := t.field(slot, 1); p != 0 {
+		return int8(t.b[p])
+	}
+	return 0
+}
+
+// table follows the offset to a sub-table.  ok is false if it isn't present
+// or is malformed.
+func (t table) table(slot int) (table, bool) {
+	p := t.field(slot, 4)
+	if p == 0 {
+		return table{}, false
+	}
+	sub := table{b: t.b, pos: p + int(binary.LittleEndian.Uint32(t.b[p:]))}
+	return sub, sub.valid()
+}
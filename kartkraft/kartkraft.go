@@ -0,0 +1,299 @@
+// Package kartkraft decodes the FlatBuffers telemetry frames sent by KartKraft.
+//
+// The frames follow Frame.fbs from the KartKraft telemetry SDK, of which only
+// the tables and fields below are read:
+//
+//	table Motion {
+//	  positionX:float; positionY:float; positionZ:float;
+//	  pitch:float; yaw:float; roll:float;
+//	  accelerationX:float; accelerationY:float; accelerationZ:float;
+//	  velocityX:float; velocityY:float; velocityZ:float;
+//	  tractionLoss:float;
+//	}
+//	table Dashboard {
+//	  speed:float; rpm:float; steer:float; throttle:float; brake:float;
+//	  gear:byte; pos:int; bestLap:float; currentLap:float; lastLap:float;
+//	  lapCount:int;
+//	}
+//	table VehicleConfig {
+//	  rpmLimit:float; rpmMax:float; gearMax:int;
+//	}
+//	table Session {
+//	  totalLaps:int; timeRemaining:float;
+//	}
+//	table Frame {
+//	  timestamp:float; motion:Motion; dash:Dashboard; session:Session;
+//	  vehicleConfig:VehicleConfig;
+//	}
+//	root_type Frame;
+//	file_identifier "KKFB";
+package kartkraft
+
+const (
+	// DefaultPort KartKraft sends to, set in the game's telemetry settings
+	DefaultPort = 5000
+
+	// MaxFrameSize is larger than any frame the game sends
+	MaxFrameSize = 1024
+
+	// Identifier of a Frame buffer
+	Identifier = "KKFB"
+
+	// Speed is sent in meters per second, so convert to MPH
+	mslashs float32 = 2.23694
+)
+
+// Field slots, in schema order
+const (
+	frameTimestamp = iota
+	frameMotion
+	frameDash
+	frameSession
+	frameVehicleConfig
+)
+
+const (
+	dashSpeed = iota
+	dashRPM
+	dashSteer
+	dashThrottle
+	dashBrake
+	dashGear
+	dashPos
+	dashBestLap
+	dashCurrentLap
+	dashLastLap
+	dashLapCount
+)
+
+const (
+	configRPMLimit = iota
+	configRPMMax
+	configGearMax
+)
+
+const (
+	sessionTotalLaps = iota
+	sessionTimeRemaining
+)
+
+// Motion of the kart in world space
+type Motion struct {
+	PositionX     float32
+	PositionY     float32
+	PositionZ     float32
+	Pitch         float32
+	Yaw           float32
+	Roll          float32
+	AccelerationX float32
+	AccelerationY float32
+	AccelerationZ float32
+	VelocityX     float32
+	VelocityY     float32
+	VelocityZ     float32
+	TractionLoss  float32
+}
+
+// Dashboard values.  Lap times are in seconds.
+type Dashboard struct {
+	Speed      float32 // Meters per second
+	RPM        float32
+	Steer      float32
+	Throttle   float32
+	Brake      float32
+	Gear       int8 // Always zero for direct drive karts
+	Pos        int32
+	BestLap    float32
+	CurrentLap float32
+	LastLap    float32
+	LapCount   int32
+}
+
+// VehicleConfig is the kart's engine and gearbox
+type VehicleConfig struct {
+	RPMLimit float32
+	RPMMax   float32
+	GearMax  int32 // One for direct drive karts, zero until it's known
+}
+
+// Session is the current session
+type Session struct {
+	TotalLaps     int32
+	TimeRemaining float32 // Seconds
+}
+
+// ShiftLights is the RPM band, as fractions of the rev limit, over which shift
+// lights are lit.  Karts have no gears so there's no shift point; instead the
+// lights show how close the engine is to the top of its power band.
+type ShiftLights struct {
+	Start float32
+	End   float32
+}
+
+// DefaultShiftLights suit typical 125cc and KA100 engines, which make their
+// power in the last few thousand RPM before the limiter.
+var DefaultShiftLights = ShiftLights{Start: 0.80, End: 0.98}
+
+// Frame is a decoded KartKraft frame.  Tables missing from a frame keep their
+// previous values, since the game may send them less often.
+type Frame struct {
+	Timestamp     float32
+	Motion        Motion
+	Dash          Dashboard
+	Session       Session
+	VehicleConfig VehicleConfig
+
+	// ShiftLights band, DefaultShiftLights if zero
+	ShiftLights ShiftLights
+
+	// Invalid counts datagrams which weren't KartKraft frames
+	Invalid uint64
+
+	maxSeen float32
+}
+
+// Size of the largest frame
+func (f *Frame) Size() int {
+	return MaxFrameSize
+}
+
+// Decode a Frame.  Datagrams without the KKFB identifier, or with a malformed
+// root table, are counted in Invalid and otherwise ignored.
+func (f *Frame) Decode(b []byte) {
+	frame, ok := root(b, Identifier)
+	if !ok {
+		f.Invalid++
+		return
+	}
+	f.Timestamp = frame.float32(frameTimestamp)
+
+	if t, ok := frame.table(frameMotion); ok {
+		m := &f.Motion
+		m.PositionX = t.float32(0)
+		m.PositionY = t.float32(1)
+		m.PositionZ = t.float32(2)
+		m.Pitch = t.float32(3)
+		m.Yaw = t.float32(4)
+		m.Roll = t.float32(5)
+		m.AccelerationX = t.float32(6)
+		m.AccelerationY = t.float32(7)
+		m.AccelerationZ = t.float32(8)
+		m.VelocityX = t.float32(9)
+		m.VelocityY = t.float32(10)
+		m.VelocityZ = t.float32(11)
+		m.TractionLoss = t.float32(12)
+	}
+
+	if t, ok := frame.table(frameDash); ok {
+		d := &f.Dash
+		d.Speed = t.float32(dashSpeed)
+		d.RPM = t.float32(dashRPM)
+		d.Steer = t.float32(dashSteer)
+		d.Throttle = t.float32(dashThrottle)
+		d.Brake = t.float32(dashBrake)
+		d.Gear = t.int8(dashGear)
+		d.Pos = t.int32(dashPos)
+		d.BestLap = t.float32(dashBestLap)
+		d.CurrentLap = t.float32(dashCurrentLap)
+		d.LastLap = t.float32(dashLastLap)
+		d.LapCount = t.int32(dashLapCount)
+
+		if d.RPM > f.maxSeen {
+			f.maxSeen = d.RPM
+		}
+	}
+
+	if t, ok := frame.table(frameSession); ok {
+		f.Session.TotalLaps = t.int32(sessionTotalLaps)
+		f.Session.TimeRemaining = t.float32(sessionTimeRemaining)
+	}
+
+	if t, ok := frame.table(frameVehicleConfig); ok {
+		f.VehicleConfig.RPMLimit = t.float32(configRPMLimit)
+		f.VehicleConfig.RPMMax = t.float32(configRPMMax)
+		f.VehicleConfig.GearMax = t.int32(configGearMax)
+	}
+}
+
+// GetGear returns the gear of shifter karts.  Direct drive karts have no
+// gearbox, so they always report first gear rather than neutral.  Until the
+// VehicleConfig is received GearMax is zero, and the gear is returned as is.
+func (f *Frame) GetGear() int {
+	if f.VehicleConfig.GearMax == 1 {
+		return 1
+	}
+	return int(f.Dash.Gear)
+}
+
+// GetRevLightPercent is 80% at the start of the ShiftLights band and 100% at
+// its end, which is where devices light their LEDs, and scales linearly with
+// RPM below the band.
+func (f *Frame) GetRevLightPercent() int {
+	limit := f.rpmLimit()
+	if limit <= 0 {
+		return 0
+	}
+	s := f.shiftLights()
+	start, end := s.Start*limit, s.End*limit
+	rpm := f.Dash.RPM
+	if rpm < start {
+		return int(80 * rpm / start)
+	}
+	return int(80 + 20*(rpm-start)/(end-start))
+}
+
+func (f *Frame) shiftLights() ShiftLights {
+	if f.ShiftLights.Start <= 0 || f.ShiftLights.End <= f.ShiftLights.Start {
+		return DefaultShiftLights
+	}
+	return f.ShiftLights
+}
+
+func (f *Frame) rpmLimit() float32 {
+	if f.VehicleConfig.RPMLimit > 0 {
+		return f.VehicleConfig.RPMLimit
+	}
+	if f.VehicleConfig.RPMMax > 0 {
+		return f.VehicleConfig.RPMMax
+	}
+	return f.maxSeen
+}
+
+func (f *Frame) GetSpeed() int {
+	return int(f.Dash.Speed * mslashs)
+}
+
+func (f *Frame) GetRPM() int {
+	return int(f.Dash.RPM)
+}
+
+// GetMaxRPM is the rev limit, or the highest RPM seen if the game hasn't sent
+// the vehicle config.
+func (f *Frame) GetMaxRPM() int {
+	return int(f.rpmLimit())
+}
+
+// GetIdleRPM is always zero since KartKraft doesn't send it
+func (f *Frame) GetIdleRPM() int {
+	return 0
+}
+
+func (f *Frame) GetLap() int {
+	return int(f.Dash.LapCount)
+}
+
+func (f *Frame) GetLapTime() float32 {
+	return f.Dash.CurrentLap
+}
+
+func (f *Frame) GetLastLapTime() float32 {
+	return f.Dash.LastLap
+}
+
+func (f *Frame) GetBestLapTime() float32 {
+	return f.Dash.BestLap
+}
+
+func (f *Frame) GetPosition() int {
+	return int(f.Dash.Pos)
+}
@@ -0,0 +1,129 @@
+package kartkraft
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// builder writes FlatBuffers tables front to back.  Each table is its vtable
+// followed by the table itself, with every field four bytes wide.
+type builder struct {
+	b    []byte
+	refs map[int]*int // position of a uoffset field to its target table
+}
+
+type value struct {
+	slot int
+	u32  uint32
+	ref  *int
+}
+
+func f32(slot int, v float32) value { return value{slot: slot, u32: math.Float32bits(v)} }
+func i32(slot int, v int32) value   { return value{slot: slot, u32: uint32(v)} }
+func ref(slot int, t *int) value    { return value{slot: slot, ref: t} }
+
+func (bl *builder) table(values ...value) int {
+	slots := 0
+	for _, v := range values {
+		if v.slot+1 > slots {
+			slots = v.slot + 1
+		}
+	}
+	vt := len(bl.b)
+	vtsize := 4 + 2*slots
+	bl.b = append(bl.b, make([]byte, vtsize)...)
+	if vtsize%4 != 0 {
+		bl.b = append(bl.b, 0, 0)
+	}
+	t := len(bl.b)
+	binary.LittleEndian.PutUint16(bl.b[vt:], uint16(vtsize))
+	binary.LittleEndian.PutUint16(bl.b[vt+2:], uint16(4+4*len(values)))
+	bl.b = append(bl.b, make([]byte, 4+4*len(values))...)
+	binary.LittleEndian.PutUint32(bl.b[t:], uint32(t-vt))
+	for i, v := range values {
+		off := 4 + 4*i
+		binary.LittleEndian.PutUint16(bl.b[vt+4+2*v.slot:], uint16(off))
+		binary.LittleEndian.PutUint32(bl.b[t+off:], v.u32)
+		if v.ref != nil {
+			bl.refs[t+off] = v.ref
+		}
+	}
+	return t
+}
+
+func (bl *builder) finish(root int) []byte {
+	for pos, t := range bl.refs {
+		binary.LittleEndian.PutUint32(bl.b[pos:], uint32(*t-pos))
+	}
+	binary.LittleEndian.PutUint32(bl.b, uint32(root))
+	return bl.b
+}
+
+func frame(rpm float32, config bool) []byte {
+	bl := &builder{b: []byte("\x00\x00\x00\x00" + Identifier), refs: map[int]*int{}}
+	var dash, cfg int
+	values := []value{f32(frameTimestamp, 12.5), ref(frameDash, &dash)}
+	if config {
+		values = append(values, ref(frameVehicleConfig, &cfg))
+	}
+	root := bl.table(values...)
+	dash = bl.table(f32(dashSpeed, 20), f32(dashRPM, rpm), i32(dashPos, 3), f32(dashLastLap, 48.25), i32(dashLapCount, 4))
+	if config {
+		cfg = bl.table(f32(configRPMLimit, 16000), i32(configGearMax, 1))
+	}
+	return bl.finish(root)
+}
+
+func TestDecode(t *testing.T) {
+	var f Frame
+	f.Decode(frame(8000, false))
+	if f.Invalid != 0 || f.Timestamp != 12.5 {
+		t.Fatalf("Invalid=%d Timestamp=%f", f.Invalid, f.Timestamp)
+	}
+	if f.GetSpeed() != 44 || f.GetPosition() != 3 || f.GetLap() != 4 || f.GetLastLapTime() != 48.25 {
+		t.Errorf("Speed=%d Position=%d Lap=%d Last=%f", f.GetSpeed(), f.GetPosition(), f.GetLap(), f.GetLastLapTime())
+	}
+	if f.GetMaxRPM() != 8000 {
+		t.Errorf("MaxRPM = %d without config", f.GetMaxRPM())
+	}
+	if f.Dash.Gear = 3; f.GetGear() != 3 {
+		t.Errorf("Gear = %d without config", f.GetGear())
+	}
+
+	for _, tc := range []struct {
+		rpm  float32
+		want int
+	}{
+		{6400, 40},
+		{12800, 80},
+		{14240, 90},
+		{15680, 100},
+	} {
+		f.Decode(frame(tc.rpm, true))
+		if f.GetRevLightPercent() != tc.want {
+			t.Errorf("%f RPM: Rev = %d, want %d", tc.rpm, f.GetRevLightPercent(), tc.want)
+		}
+	}
+	if f.GetGear() != 1 {
+		t.Errorf("Gear = %d for direct drive", f.GetGear())
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	good := frame(8000, true)
+	var f Frame
+	for i := 0; i < len(good); i++ {
+		f.Decode(good[:i])
+	}
+	for i := range good {
+		b := append([]byte(nil), good...)
+		b[i] ^= 0xff
+		f.Decode(b)
+	}
+	f.Invalid = 0
+	f.Decode([]byte("\x08\x00\x00\x00XXXX\xfc\xff\xff\xff"))
+	if f.Invalid != 1 {
+		t.Errorf("Invalid = %d", f.Invalid)
+	}
+}
@@ -1,18 +1,48 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"runtime"
+	"strings"
+	"time"
 
-	"github.com/jake-dog/opensimdash/codemasters"
+	"github.com/jake-dog/opensimdash/bridge"
 	"github.com/jake-dog/opensimdash/hid"
 )
 
 var logger = log.New(os.Stdout, "", log.LstdFlags|log.LUTC|log.Lshortfile)
 
+var (
+	ingestAddress   = flag.String("ingest", "", "receive telemetry from remote relays on this TCP address, and over a websocket at "+IngestPath)
+	ingestToken     = flag.String("ingest-token", "", "shared token remote relays must send")
+	source          = flag.String("source", "udp", "read telemetry from udp, udp:ADDRESS, stdin, file:PATH, fifo:PATH or pcap:PATH")
+	framing         = flag.String("framing", "length", "datagram framing of stdin, file and fifo sources: length, fixed or fixed:SIZE")
+	hotplugPoll     = flag.Bool("hotplug-poll", false, "poll for USB devices instead of using native hotplug notifications")
+	hotplugInterval = flag.Duration("hotplug-interval", 2*time.Second, "how often to poll for USB devices when polling")
+	hotplugDebounce = flag.Int("hotplug-debounce", 2, "polls a device must be connected or disconnected for before it counts")
+	bridgeFrom      = flag.String("bridge", "", "receive the telemetry model from the opensimdash bridge at this address")
+	bridgeListen    = flag.String("bridge-listen", "", "forward the telemetry model to bridge receivers on this TCP address")
+	schemaFile      = flag.String("schema", "", "decode telemetry described by this schema file, instead of that of -game")
+)
+
 func main() {
+	flag.Parse()
+
+	// Convert a capture instead of running the dash
+	if *pcapExport != "" {
+		n, err := exportCapture(strings.TrimPrefix(*source, "pcap:"), *pcapExport)
+		if err != nil {
+			logger.Println(err)
+			os.Exit(-1)
+		}
+		logger.Printf("Exported %d datagrams to %s", n, *pcapExport)
+		return
+	}
+
 	// We're doing a lot of system calls here so minimum three system threads
 	runtime.GOMAXPROCS(3)
 
@@ -20,12 +50,57 @@ func main() {
 	go http.ListenAndServe(":8080", nil)
 
 	// Handle USB device add/remove
+	if err := hid.SetBackend(*hidBackend); err != nil {
+		logger.Println(err)
+		os.Exit(-1)
+	}
+	if err := registerDevices(*hidDevices); err != nil {
+		logger.Println(err)
+		os.Exit(-1)
+	}
+	if err := assignChannels(*hidChannels); err != nil {
+		logger.Println(err)
+		os.Exit(-1)
+	}
 	r := hid.Registrar(logger)
-	AddSubscriber(r) // Register for Windows WM_DEVICECHANGE events
+	http.Handle("/hid/stats", hidStats(r))
+	AddSubscriber(r) // Register for WM_DEVICECHANGE or Linux uevent hotplug events
+	startHotplug(*hotplugPoll, *hotplugInterval, *hotplugDebounce)
 
-	// Create a new UDP connection to read telemetry
-	// TODO this all needs to be configurable/optional/etc.
-	s, err := NewTelemetry("") // Defaults to ":20777"
+	// Forward telemetry to other opensimdash instances
+	var b *bridge.Server
+	if *bridgeListen != "" {
+		var err error
+		if b, err = bridge.NewServer(*bridgeListen, logger); err != nil {
+			logger.Println(err)
+			os.Exit(-1)
+		}
+	}
+
+	// Read telemetry from the game, relays, recordings or another instance
+	var s Source
+	var p Pack
+	var g game
+	var err error
+	name := *gameName
+	if *dirtDatabase != "" {
+		if err := loadDirtDatabase(*dirtDatabase); err != nil {
+			logger.Println(err)
+			os.Exit(-1)
+		}
+	}
+	switch {
+	case *bridgeFrom != "":
+		s, p = bridge.NewClient(*bridgeFrom, logger), &bridge.Pack{}
+	case *schemaFile != "":
+		name = *schemaFile
+		g, p, err = openSchema(*schemaFile)
+	default:
+		g, p, err = openGame(*gameName)
+	}
+	if err == nil && s == nil {
+		s, err = openSource(name, g, p)
+	}
 	if err != nil {
 		logger.Println(err)
 		os.Exit(-1)
@@ -33,11 +108,10 @@ func main() {
 
 	// Loop receive packet from UDP client, and ship them off to HID and WebSocket
 	// TODO this all needs to be configurable/optional/etc.
-	rcv := make([]byte, codemasters.DirtPacketSize) // Maybe 1500 (standard frame)
-	p := &codemasters.DirtPacket{}                  // TODO oh well obviously...
+	rcv := make([]byte, p.Size()) // Maybe 1500 (standard frame)
 	for {
 		// Retrieve a packet
-		if err := s.DecodePacket(p, rcv); err != nil {
+		if err := decodePacket(s, p, rcv); err != nil {
 			logger.Println(err)
 			break // TODO probably need better than this for error handling...
 		}
@@ -47,5 +121,36 @@ func main() {
 
 		// Send data to any connected USB HID devices
 		r.SendPack(p)
+
+		// Send data to bridge receivers
+		if b != nil {
+			b.SendPack(p)
+		}
+	}
+}
+
+// openSource of the game's telemetry chosen by the flags: relays, the game
+// itself over UDP, a capture, or a stream
+func openSource(name string, g game, p Pack) (Source, error) {
+	udp := *source == "udp" || strings.HasPrefix(*source, "udp:")
+	switch {
+	case g.live && (*ingestAddress != "" || !udp):
+		return nil, fmt.Errorf("%s telemetry can only be read from the game", name)
+	case *ingestAddress != "":
+		in, err := NewIngest(*ingestAddress, *ingestToken)
+		if err != nil {
+			return nil, err
+		}
+		http.Handle(IngestPath, in)
+		return in, nil
+	case udp:
+		return g.listen(name, strings.TrimPrefix(strings.TrimPrefix(*source, "udp"), ":"), p)
+	case strings.HasPrefix(*source, "pcap:"):
+		return openReplay(strings.TrimPrefix(*source, "pcap:"))
+	}
+	size, err := ParseFraming(*framing, p.Size())
+	if err != nil {
+		return nil, err
 	}
+	return OpenStream(*source, size)
 }
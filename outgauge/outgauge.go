@@ -0,0 +1,200 @@
+// Package outgauge decodes the OutGauge and OutSim protocols created by Live
+// for Speed, which are also sent by BeamNG.drive.
+package outgauge
+
+// https://en.lfsmanual.net/wiki/InSim.txt (OutGauge and OutSim sections)
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+const (
+	// OutGaugeSize without the optional ID
+	OutGaugeSize = 92
+
+	// OutGaugeIDSize with the optional ID, set by "OutGauge ID" in cfg.txt
+	OutGaugeIDSize = 96
+
+	// Speed is sent in meters per second, so convert to MPH
+	mslashs float32 = 2.23694
+)
+
+// OutGauge flags
+const (
+	FlagShift = 1 << 0  // Key
+	FlagCtrl  = 1 << 1  // Key
+	FlagTurbo = 1 << 13 // Show turbo gauge
+	FlagKM    = 1 << 14 // User prefers KM, otherwise MILES
+	FlagBar   = 1 << 15 // User prefers BAR, otherwise PSI
+)
+
+// Dash lights (DL_), bit positions in DashLights and ShowLights
+const (
+	DLShift     = 1 << 0  // Shift light
+	DLFullBeam  = 1 << 1  // Full beam
+	DLHandbrake = 1 << 2  // Handbrake
+	DLPitSpeed  = 1 << 3  // Pit speed limiter
+	DLTC        = 1 << 4  // TC active or switched off
+	DLSignalL   = 1 << 5  // Left turn signal
+	DLSignalR   = 1 << 6  // Right turn signal
+	DLSignalAny = 1 << 7  // Shared turn signal
+	DLOilWarn   = 1 << 8  // Oil pressure warning
+	DLBattery   = 1 << 9  // Battery warning
+	DLABS       = 1 << 10 // ABS active or switched off
+)
+
+// dashLights maps DL_ flags onto the telemetry model's indicators
+var dashLights = [...]struct {
+	dl  uint32
+	ind hid.Indicators
+}{
+	{DLShift, hid.IndicatorShiftLight},
+	{DLFullBeam, hid.IndicatorFullBeam},
+	{DLHandbrake, hid.IndicatorHandbrake},
+	{DLPitSpeed, hid.IndicatorPitLimiter},
+	{DLTC, hid.IndicatorTractionControl},
+	{DLSignalL, hid.IndicatorLeftSignal},
+	{DLSignalR, hid.IndicatorRightSignal},
+	{DLSignalAny, hid.IndicatorLeftSignal | hid.IndicatorRightSignal},
+	{DLOilWarn, hid.IndicatorOilWarning},
+	{DLBattery, hid.IndicatorBattery},
+	{DLABS, hid.IndicatorABS},
+}
+
+// OutGauge is the dashboard packet.  MaxRPM isn't sent, so it can be set by
+// the user, otherwise it's learnt from the RPM, see hid.PeakRPM.
+type OutGauge struct {
+	Time        uint32 // Milliseconds
+	Car         [4]byte
+	Flags       uint16
+	Gear        uint8 // 0 = reverse, 1 = neutral, 2 = first
+	PLID        uint8
+	Speed       float32 // Meters per second
+	RPM         float32
+	Turbo       float32 // Bar
+	EngTemp     float32 // Centigrade
+	Fuel        float32 // 0.0 - 1.0
+	OilPressure float32 // Bar
+	OilTemp     float32 // Centigrade
+	DashLights  uint32  // Dash lights available
+	ShowLights  uint32  // Dash lights currently switched on
+	Throttle    float32
+	Brake       float32
+	Clutch      float32
+	Display1    [16]byte
+	Display2    [16]byte
+	ID          int32 // Only set if the packet has an ID
+
+	MaxRPM float32
+
+	peak hid.PeakRPM
+}
+
+// Size of the packet with the optional ID
+func (p *OutGauge) Size() int {
+	return OutGaugeIDSize
+}
+
+// Decode an OutGauge packet with or without the ID.  Shorter datagrams are
+// ignored.
+func (p *OutGauge) Decode(b []byte) {
+	if len(b) < OutGaugeSize {
+		return
+	}
+	_ = b[OutGaugeSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	p.Time = binary.LittleEndian.Uint32(b[0:4])
+	copy(p.Car[:], b[4:8])
+	p.Flags = binary.LittleEndian.Uint16(b[8:10])
+	p.Gear = b[10]
+	p.PLID = b[11]
+	p.Speed = float32At(b, 12)
+	p.RPM = float32At(b, 16)
+	p.Turbo = float32At(b, 20)
+	p.EngTemp = float32At(b, 24)
+	p.Fuel = float32At(b, 28)
+	p.OilPressure = float32At(b, 32)
+	p.OilTemp = float32At(b, 36)
+	p.DashLights = binary.LittleEndian.Uint32(b[40:44])
+	p.ShowLights = binary.LittleEndian.Uint32(b[44:48])
+	p.Throttle = float32At(b, 48)
+	p.Brake = float32At(b, 52)
+	p.Clutch = float32At(b, 56)
+	copy(p.Display1[:], b[60:76])
+	copy(p.Display2[:], b[76:92])
+	p.ID = 0
+	if len(b) >= OutGaugeIDSize {
+		p.ID = int32(binary.LittleEndian.Uint32(b[92:96]))
+	}
+
+	p.peak.Update(p.RPM)
+}
+
+// CarName is the short name of the car, eg. "XRT"
+func (p *OutGauge) CarName() string {
+	return cstring(p.Car[:])
+}
+
+// GetGear returns -1 for reverse and 0 for neutral
+func (p *OutGauge) GetGear() int {
+	return int(p.Gear) - 1
+}
+
+func (p *OutGauge) GetRevLightPercent() int {
+	return p.peak.Percent(p.RPM, p.MaxRPM)
+}
+
+func (p *OutGauge) GetSpeed() int {
+	return int(p.Speed * mslashs)
+}
+
+func (p *OutGauge) GetRPM() int {
+	return int(p.RPM)
+}
+
+// GetMaxRPM is either the user supplied MaxRPM or the learnt maximum, which is
+// zero until it's known
+func (p *OutGauge) GetMaxRPM() int {
+	return int(p.peak.Max(p.MaxRPM))
+}
+
+// GetIdleRPM is always zero since OutGauge doesn't send it
+func (p *OutGauge) GetIdleRPM() int {
+	return 0
+}
+
+// GetFuel as a fraction of the tank
+func (p *OutGauge) GetFuel() float32 {
+	return p.Fuel
+}
+
+// GetFuelCapacity is always one since Fuel is already a fraction
+func (p *OutGauge) GetFuelCapacity() float32 {
+	return 1
+}
+
+// GetIndicators maps the dash lights which are switched on
+func (p *OutGauge) GetIndicators() (ind hid.Indicators) {
+	lit := p.ShowLights & p.DashLights
+	for _, l := range dashLights {
+		if lit&l.dl != 0 {
+			ind |= l.ind
+		}
+	}
+	return ind
+}
+
+func float32At(b []byte, i int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4]))
+}
+
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,63 @@
+package outgauge
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+func put(b []byte, off int, f float32) {
+	binary.LittleEndian.PutUint32(b[off:], math.Float32bits(f))
+}
+
+func TestOutGauge(t *testing.T) {
+	b := make([]byte, OutGaugeIDSize)
+	copy(b[4:], "XRT")
+	b[10] = 0 // reverse
+	put(b, 12, 20)
+	put(b, 16, 3000)
+	put(b, 28, 0.5)
+	binary.LittleEndian.PutUint32(b[40:], DLShift|DLHandbrake|DLSignalAny|DLABS)
+	binary.LittleEndian.PutUint32(b[44:], DLShift|DLSignalAny|DLOilWarn)
+	binary.LittleEndian.PutUint32(b[92:], 7)
+
+	var p OutGauge
+	p.Decode(b[:OutGaugeSize])
+	if p.ID != 0 || p.CarName() != "XRT" || p.GetGear() != -1 || p.GetSpeed() != 44 {
+		t.Errorf("ID=%d Car=%q Gear=%d Speed=%d", p.ID, p.CarName(), p.GetGear(), p.GetSpeed())
+	}
+	if p.GetRevLightPercent() != 0 {
+		t.Errorf("Rev = %d before the maximum is known", p.GetRevLightPercent())
+	}
+	want := hid.IndicatorShiftLight | hid.IndicatorLeftSignal | hid.IndicatorRightSignal
+	if ind := p.GetIndicators(); ind != want {
+		t.Errorf("Indicators = %b, want %b", ind, want)
+	}
+
+	p.MaxRPM = 6000
+	p.Decode(b)
+	if p.ID != 7 || p.GetRevLightPercent() != 50 || p.GetFuel() != 0.5 {
+		t.Errorf("ID=%d Rev=%d Fuel=%f", p.ID, p.GetRevLightPercent(), p.GetFuel())
+	}
+
+	p.Decode(b[:OutGaugeSize-1])
+	if p.ID != 7 {
+		t.Error("short packet decoded")
+	}
+}
+
+func TestOutSim(t *testing.T) {
+	b := make([]byte, OutSimSize)
+	put(b, 16, 1.5)
+	binary.LittleEndian.PutUint32(b[52:], 3*positionScale)
+	z := int32(-positionScale / 2)
+	binary.LittleEndian.PutUint32(b[60:], uint32(z))
+
+	var p OutSim
+	p.Decode(b)
+	if x, _, z := p.Position(); x != 3 || z != -0.5 || p.Heading != 1.5 {
+		t.Errorf("x=%f z=%f Heading=%f", x, z, p.Heading)
+	}
+}
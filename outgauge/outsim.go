@@ -0,0 +1,64 @@
+package outgauge
+
+import "encoding/binary"
+
+const (
+	// OutSimSize without the optional ID
+	OutSimSize = 64
+
+	// OutSimIDSize with the optional ID, set by "OutSim ID" in cfg.txt
+	OutSimIDSize = 68
+
+	// Positions are sent in meters * 65536
+	positionScale = 65536
+)
+
+// OutSim is the motion packet sent by Live for Speed.  It isn't a
+// TelemetryPack since it has nothing to show on a dashboard, but it can be
+// decoded from the same Telemetry connection.
+type OutSim struct {
+	Time    uint32     // Milliseconds
+	AngVel  [3]float32 // Radians per second
+	Heading float32    // Radians, anticlockwise from above (Z)
+	Pitch   float32    // Radians, anticlockwise from right (X)
+	Roll    float32    // Radians, anticlockwise from front (Y)
+	Accel   [3]float32 // Meters per second squared
+	Vel     [3]float32 // Meters per second
+	Pos     [3]int32   // Meters * 65536
+	ID      int32      // Only set if the packet has an ID
+}
+
+// Size of the packet with the optional ID
+func (p *OutSim) Size() int {
+	return OutSimIDSize
+}
+
+// Decode an OutSim packet with or without the ID.  Shorter datagrams are
+// ignored.
+func (p *OutSim) Decode(b []byte) {
+	if len(b) < OutSimSize {
+		return
+	}
+	_ = b[OutSimSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	p.Time = binary.LittleEndian.Uint32(b[0:4])
+	for i := 0; i < 3; i++ {
+		p.AngVel[i] = float32At(b, 4+4*i)
+		p.Accel[i] = float32At(b, 28+4*i)
+		p.Vel[i] = float32At(b, 40+4*i)
+		p.Pos[i] = int32(binary.LittleEndian.Uint32(b[52+4*i:]))
+	}
+	p.Heading = float32At(b, 16)
+	p.Pitch = float32At(b, 20)
+	p.Roll = float32At(b, 24)
+	p.ID = 0
+	if len(b) >= OutSimIDSize {
+		p.ID = int32(binary.LittleEndian.Uint32(b[64:68]))
+	}
+}
+
+// Position in meters
+func (p *OutSim) Position() (x, y, z float64) {
+	return float64(p.Pos[0]) / positionScale,
+		float64(p.Pos[1]) / positionScale,
+		float64(p.Pos[2]) / positionScale
+}
@@ -0,0 +1,414 @@
+// Package pcap reads UDP telemetry from pcap and pcapng capture files, such as
+// those saved by Wireshark or tcpdump, without libpcap.
+package pcap
+
+// https://www.tcpdump.org/manpages/pcap-savefile.5.txt
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html
+// https://www.tcpdump.org/linktypes.html
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// Capture file magic numbers
+const (
+	magicMicro  = 0xa1b2c3d4
+	magicNano   = 0xa1b23c4d
+	magicNG     = 0x0a0d0d0a // Section header block type
+	magicNGByte = 0x1a2b3c4d // Section header byte order magic
+)
+
+// pcapng block types
+const (
+	blockInterface = 0x00000001
+	blockPacket    = 0x00000002 // Obsolete
+	blockSimple    = 0x00000003
+	blockEnhanced  = 0x00000006
+)
+
+// Link types
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkRawAlt1  = 12
+	linkRawAlt2  = 14
+	linkLoop     = 108
+	linkSLL      = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+	linkSLL2     = 276
+)
+
+// Largest block or record which is read, anything larger is a corrupt file
+const maxRecord = 1 << 24
+
+// ErrFormat is returned for files which aren't pcap or pcapng
+var ErrFormat = errors.New("pcap: unknown file format")
+
+// Datagram is a UDP datagram from a capture.  Payload is only valid until the
+// next call to Next.
+type Datagram struct {
+	Time    time.Time
+	Src     net.UDPAddr
+	Dst     net.UDPAddr
+	Payload []byte
+}
+
+// Filter selects datagrams by port and address.  Zero values match anything.
+type Filter struct {
+	Port int    // Source or destination port
+	Host net.IP // Source or destination address
+}
+
+// Match reports whether the datagram passes the filter
+func (f *Filter) Match(d *Datagram) bool {
+	if f.Port != 0 && d.Src.Port != f.Port && d.Dst.Port != f.Port {
+		return false
+	}
+	if f.Host != nil && !f.Host.Equal(d.Src.IP) && !f.Host.Equal(d.Dst.IP) {
+		return false
+	}
+	return true
+}
+
+type iface struct {
+	link int
+	unit time.Duration // Timestamp resolution, or zero for fractions
+	frac uint64        // Timestamp units per second when unit is zero
+}
+
+// Reader reads UDP datagrams from a pcap or pcapng file.  Packets which aren't
+// UDP, or are IP fragments, are skipped.
+type Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	ng    bool
+	ifs   []iface // pcap files have a single interface
+	buf   []byte
+	d     Datagram
+}
+
+// NewReader detects whether r is a pcap or pcapng file and reads its header
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{r: bufio.NewReaderSize(r, 64*1024)}
+	hdr, err := pr.r.Peek(4)
+	if err != nil {
+		return nil, ErrFormat
+	}
+	switch {
+	case binary.LittleEndian.Uint32(hdr) == magicNG:
+		pr.ng = true
+		return pr, nil
+	case binary.LittleEndian.Uint32(hdr) == magicMicro || binary.LittleEndian.Uint32(hdr) == magicNano:
+		pr.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr) == magicMicro || binary.BigEndian.Uint32(hdr) == magicNano:
+		pr.order = binary.BigEndian
+	default:
+		return nil, ErrFormat
+	}
+
+	var gh [24]byte
+	if _, err := io.ReadFull(pr.r, gh[:]); err != nil {
+		return nil, err
+	}
+	unit := time.Microsecond
+	if pr.order.Uint32(gh[0:]) == magicNano {
+		unit = time.Nanosecond
+	}
+	pr.ifs = []iface{{link: int(pr.order.Uint32(gh[20:]) & 0xffff), unit: unit}}
+	return pr, nil
+}
+
+// Next returns the next UDP datagram, or io.EOF at the end of the file
+func (pr *Reader) Next() (*Datagram, error) {
+	for {
+		var ok bool
+		var err error
+		if pr.ng {
+			ok, err = pr.nextBlock()
+		} else {
+			ok, err = pr.nextRecord()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &pr.d, nil
+		}
+	}
+}
+
+// NextMatch returns the next UDP datagram which passes the filter
+func (pr *Reader) NextMatch(f *Filter) (*Datagram, error) {
+	for {
+		d, err := pr.Next()
+		if err != nil || f == nil || f.Match(d) {
+			return d, err
+		}
+	}
+}
+
+func (pr *Reader) read(n int) ([]byte, error) {
+	if n < 0 || n > maxRecord {
+		return nil, fmt.Errorf("pcap: record of %d bytes", n)
+	}
+	if cap(pr.buf) < n {
+		pr.buf = make([]byte, n)
+	}
+	b := pr.buf[:n]
+	if _, err := io.ReadFull(pr.r, b); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			// Captures cut short, eg. by killing tcpdump, just end early
+			err = io.EOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+func (pr *Reader) nextRecord() (bool, error) {
+	hdr, err := pr.read(16)
+	if err != nil {
+		return false, err
+	}
+	sec, sub := pr.order.Uint32(hdr[0:]), pr.order.Uint32(hdr[4:])
+	b, err := pr.read(int(pr.order.Uint32(hdr[8:])))
+	if err != nil {
+		return false, err
+	}
+	t := time.Unix(int64(sec), int64(sub)*int64(pr.ifs[0].unit))
+	return pr.decode(pr.ifs[0].link, t, b), nil
+}
+
+func (pr *Reader) nextBlock() (bool, error) {
+	hdr, err := pr.read(8)
+	if err != nil {
+		return false, err
+	}
+	typ := binary.LittleEndian.Uint32(hdr)
+	if typ == magicNG {
+		return false, pr.section(hdr)
+	}
+	if pr.order == nil {
+		return false, ErrFormat
+	}
+	typ = pr.order.Uint32(hdr)
+	body, err := pr.read(int(pr.order.Uint32(hdr[4:])) - 8)
+	if err != nil {
+		return false, err
+	}
+	if len(body) < 4 {
+		return false, fmt.Errorf("pcap: block of %d bytes", len(body)+8)
+	}
+	body = body[:len(body)-4] // Trailing length
+
+	switch typ {
+	case blockInterface:
+		if len(body) < 8 {
+			return false, nil
+		}
+		ifc := iface{link: int(pr.order.Uint16(body)), unit: time.Microsecond}
+		pr.options(body[8:], func(code uint16, v []byte) {
+			if code == 9 && len(v) == 1 { // if_tsresol
+				ifc.unit, ifc.frac = tsresol(v[0])
+			}
+		})
+		pr.ifs = append(pr.ifs, ifc)
+	case blockEnhanced, blockPacket:
+		if len(body) < 20 {
+			return false, nil
+		}
+		var id uint32
+		if typ == blockEnhanced {
+			id = pr.order.Uint32(body)
+		} else {
+			id = uint32(pr.order.Uint16(body))
+		}
+		if int(id) >= len(pr.ifs) {
+			return false, nil
+		}
+		ifc := pr.ifs[id]
+		ts := uint64(pr.order.Uint32(body[4:]))<<32 | uint64(pr.order.Uint32(body[8:]))
+		n := int(pr.order.Uint32(body[12:]))
+		if n > len(body)-20 {
+			n = len(body) - 20
+		}
+		return pr.decode(ifc.link, ifc.time(ts), body[20:20+n]), nil
+	case blockSimple:
+		if len(body) < 4 || len(pr.ifs) == 0 {
+			return false, nil
+		}
+		n := int(pr.order.Uint32(body))
+		if n > len(body)-4 {
+			n = len(body) - 4
+		}
+		// Simple packets have no timestamp
+		return pr.decode(pr.ifs[0].link, time.Time{}, body[4:4+n]), nil
+	}
+	return false, nil
+}
+
+// section starts a new section, whose byte order and interfaces replace the
+// previous section's.
+func (pr *Reader) section(hdr []byte) error {
+	var bom [4]byte
+	if _, err := io.ReadFull(pr.r, bom[:]); err != nil {
+		return err
+	}
+	switch {
+	case binary.LittleEndian.Uint32(bom[:]) == magicNGByte:
+		pr.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(bom[:]) == magicNGByte:
+		pr.order = binary.BigEndian
+	default:
+		return ErrFormat
+	}
+	pr.ifs = pr.ifs[:0]
+	_, err := pr.read(int(pr.order.Uint32(hdr[4:])) - 12)
+	return err
+}
+
+func (pr *Reader) options(b []byte, fn func(code uint16, v []byte)) {
+	for len(b) >= 4 {
+		code, n := pr.order.Uint16(b), int(pr.order.Uint16(b[2:]))
+		if code == 0 || 4+n > len(b) {
+			return
+		}
+		fn(code, b[4:4+n])
+		if n = 4 + (n+3)&^3; n > len(b) {
+			return // The last option's padding is missing
+		}
+		b = b[n:]
+	}
+}
+
+// tsresol is either a power of ten, or of two if the top bit is set
+func tsresol(v byte) (time.Duration, uint64) {
+	if v&0x80 == 0 {
+		if v <= 9 {
+			return time.Duration(math.Pow10(9 - int(v))), 0
+		}
+		return 0, uint64(math.Pow10(int(v)))
+	}
+	return 0, 1 << (v & 0x7f)
+}
+
+func (ifc *iface) time(ts uint64) time.Time {
+	if ifc.unit != 0 {
+		per := uint64(time.Second / ifc.unit)
+		return time.Unix(int64(ts/per), int64(ts%per)*int64(ifc.unit))
+	}
+	if ifc.frac == 0 {
+		return time.Time{}
+	}
+	sec := ts / ifc.frac
+	nsec := float64(ts%ifc.frac) * 1e9 / float64(ifc.frac)
+	return time.Unix(int64(sec), int64(nsec))
+}
+
+// decode the link layer, IP and UDP headers into pr.d
+func (pr *Reader) decode(link int, t time.Time, b []byte) bool {
+	switch link {
+	case linkEthernet:
+		if len(b) < 14 {
+			return false
+		}
+		proto := binary.BigEndian.Uint16(b[12:])
+		b = b[14:]
+		for (proto == 0x8100 || proto == 0x88a8) && len(b) >= 4 { // VLAN tags
+			proto, b = binary.BigEndian.Uint16(b[2:]), b[4:]
+		}
+		if proto != 0x0800 && proto != 0x86dd {
+			return false
+		}
+	case linkNull, linkLoop:
+		if len(b) < 4 {
+			return false
+		}
+		b = b[4:] // Address family, in the capturing host's byte order
+	case linkSLL:
+		if len(b) < 16 {
+			return false
+		}
+		b = b[16:]
+	case linkSLL2:
+		if len(b) < 20 {
+			return false
+		}
+		b = b[20:]
+	case linkRaw, linkRawAlt1, linkRawAlt2, linkIPv4, linkIPv6:
+	default:
+		return false
+	}
+	pr.d.Time = t
+	return pr.ip(b)
+}
+
+func (pr *Reader) ip(b []byte) bool {
+	if len(b) < 1 {
+		return false
+	}
+	switch b[0] >> 4 {
+	case 4:
+		if len(b) < 20 {
+			return false
+		}
+		ihl := int(b[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(b[2:]))
+		frag := binary.BigEndian.Uint16(b[6:])
+		if ihl < 20 || total < ihl || ihl > len(b) || b[9] != 17 || frag&0x3fff != 0 {
+			return false // Not UDP, or a fragment
+		}
+		if total < len(b) {
+			b = b[:total] // Ethernet padding
+		}
+		pr.d.Src.IP, pr.d.Dst.IP = b[12:16], b[16:20]
+		return pr.udp(b[ihl:])
+	case 6:
+		if len(b) < 40 {
+			return false
+		}
+		next := b[6]
+		if n := 40 + int(binary.BigEndian.Uint16(b[4:])); n < len(b) {
+			b = b[:n]
+		}
+		pr.d.Src.IP, pr.d.Dst.IP = b[8:24], b[24:40]
+		b = b[40:]
+		for next == 0 || next == 43 || next == 60 { // Extension headers
+			if len(b) < 8 || len(b) < 8+int(b[1])*8 {
+				return false
+			}
+			next, b = b[0], b[8+int(b[1])*8:]
+		}
+		if next != 17 {
+			return false // Not UDP, or a fragment
+		}
+		return pr.udp(b)
+	}
+	return false
+}
+
+func (pr *Reader) udp(b []byte) bool {
+	if len(b) < 8 {
+		return false
+	}
+	pr.d.Src.Port = int(binary.BigEndian.Uint16(b[0:]))
+	pr.d.Dst.Port = int(binary.BigEndian.Uint16(b[2:]))
+	n := int(binary.BigEndian.Uint16(b[4:]))
+	if n < 8 {
+		return false
+	}
+	if n > len(b) {
+		n = len(b) // Truncated by the snap length
+	}
+	pr.d.Payload = b[8:n]
+	return true
+}
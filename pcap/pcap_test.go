@@ -0,0 +1,257 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func udp(src, dst int, payload string) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(b[0:], uint16(src))
+	binary.BigEndian.PutUint16(b[2:], uint16(dst))
+	binary.BigEndian.PutUint16(b[4:], uint16(8+len(payload)))
+	return append(b, payload...)
+}
+
+func ipv4(proto byte, frag uint16, src, dst string, payload []byte) []byte {
+	b := make([]byte, 20, 20+len(payload))
+	b[0] = 0x45
+	binary.BigEndian.PutUint16(b[2:], uint16(20+len(payload)))
+	binary.BigEndian.PutUint16(b[6:], frag)
+	b[9] = proto
+	copy(b[12:], net.ParseIP(src).To4())
+	copy(b[16:], net.ParseIP(dst).To4())
+	return append(b, payload...)
+}
+
+func ipv6(src, dst string, payload []byte) []byte {
+	b := make([]byte, 40, 40+len(payload))
+	b[0] = 0x60
+	binary.BigEndian.PutUint16(b[4:], uint16(len(payload)))
+	b[6] = 17
+	copy(b[8:], net.ParseIP(src))
+	copy(b[24:], net.ParseIP(dst))
+	return append(b, payload...)
+}
+
+func ethernet(ip []byte) []byte {
+	b := make([]byte, 18) // VLAN tagged
+	binary.BigEndian.PutUint16(b[12:], 0x8100)
+	binary.BigEndian.PutUint16(b[16:], 0x0800)
+	b = append(b, ip...)
+	return append(b, 0, 0, 0, 0) // Padding
+}
+
+func pcapFile(order binary.ByteOrder, magic uint32, link int, packets ...[]byte) []byte {
+	var buf bytes.Buffer
+	hdr := make([]byte, 24)
+	order.PutUint32(hdr[0:], magic)
+	order.PutUint16(hdr[4:], 2)
+	order.PutUint16(hdr[6:], 4)
+	order.PutUint32(hdr[16:], 65535)
+	order.PutUint32(hdr[20:], uint32(link))
+	buf.Write(hdr)
+	for i, p := range packets {
+		rec := make([]byte, 16)
+		order.PutUint32(rec[0:], 1000)
+		order.PutUint32(rec[4:], uint32(500*i))
+		order.PutUint32(rec[8:], uint32(len(p)))
+		order.PutUint32(rec[12:], uint32(len(p)))
+		buf.Write(rec)
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+func block(typ uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	b := make([]byte, 8, 12+len(body))
+	binary.LittleEndian.PutUint32(b[0:], typ)
+	binary.LittleEndian.PutUint32(b[4:], uint32(12+len(body)))
+	b = append(b, body...)
+	return append(b, b[4:8]...)
+}
+
+func pcapngFile(packets ...[]byte) []byte {
+	var buf bytes.Buffer
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], magicNGByte)
+	binary.LittleEndian.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	buf.Write(block(magicNG, shb))
+
+	// Linux cooked capture with nanosecond timestamps
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:], linkSLL)
+	idb = append(idb, 9, 0, 1, 0, 9, 0, 0, 0, 0, 0, 0, 0) // if_tsresol = 9, end of options
+	buf.Write(block(blockInterface, idb))
+
+	for i, p := range packets {
+		sll := append(make([]byte, 16), p...)
+		ts := uint64(2000)*1e9 + uint64(i)*1e6
+		epb := make([]byte, 20)
+		binary.LittleEndian.PutUint32(epb[4:], uint32(ts>>32))
+		binary.LittleEndian.PutUint32(epb[8:], uint32(ts))
+		binary.LittleEndian.PutUint32(epb[12:], uint32(len(sll)))
+		binary.LittleEndian.PutUint32(epb[16:], uint32(len(sll)))
+		buf.Write(block(blockEnhanced, append(epb, sll...)))
+	}
+	buf.Write(block(0x0BAD, []byte("custom block")))
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, b []byte, f Filter) (payloads []string, times []time.Time) {
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		d, err := r.NextMatch(&f)
+		if err == io.EOF {
+			return payloads, times
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		payloads = append(payloads, string(d.Payload))
+		times = append(times, d.Time)
+	}
+}
+
+func TestPcap(t *testing.T) {
+	b := pcapFile(binary.LittleEndian, magicMicro, linkEthernet,
+		ethernet(ipv4(17, 0, "10.0.0.2", "10.0.0.1", udp(50000, 20777, "dirt"))),
+		ethernet(ipv4(6, 0, "10.0.0.2", "10.0.0.1", udp(50000, 20777, "tcp"))),
+		ethernet(ipv4(17, 0x2000, "10.0.0.2", "10.0.0.1", udp(50000, 20777, "fragment"))),
+		ethernet(ipv4(17, 0, "10.0.0.3", "10.0.0.1", udp(50000, 5606, "pcars"))),
+		ethernet(ipv4(17, 0, "10.0.0.2", "10.0.0.1", udp(50000, 20777, "rally"))),
+	)
+	payloads, times := readAll(t, b, Filter{Port: 20777})
+	if len(payloads) != 2 || payloads[0] != "dirt" || payloads[1] != "rally" {
+		t.Errorf("payloads = %q", payloads)
+	}
+	if want := time.Unix(1000, 2000*int64(time.Microsecond)); !times[1].Equal(want) {
+		t.Errorf("time = %v, want %v", times[1], want)
+	}
+
+	payloads, _ = readAll(t, b, Filter{Host: net.ParseIP("10.0.0.3")})
+	if len(payloads) != 1 || payloads[0] != "pcars" {
+		t.Errorf("payloads = %q", payloads)
+	}
+
+	// Big endian, nanosecond, raw IPv6
+	b = pcapFile(binary.BigEndian, magicNano, linkRaw, ipv6("::1", "::2", udp(1, 2, "six")))
+	payloads, times = readAll(t, b, Filter{})
+	if len(payloads) != 1 || payloads[0] != "six" || !times[0].Equal(time.Unix(1000, 0)) {
+		t.Errorf("payloads = %q at %v", payloads, times)
+	}
+
+	// Truncated captures end early
+	payloads, _ = readAll(t, b[:len(b)-3], Filter{})
+	if len(payloads) != 0 {
+		t.Errorf("payloads = %q", payloads)
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture"))); err != ErrFormat {
+		t.Errorf("NewReader = %v", err)
+	}
+}
+
+func TestPcapng(t *testing.T) {
+	b := pcapngFile(
+		ipv4(17, 0, "10.0.0.2", "10.0.0.1", udp(50000, 20777, "one")),
+		ipv6("::1", "::2", udp(50000, 20777, "two")),
+	)
+	payloads, times := readAll(t, b, Filter{Port: 20777})
+	if len(payloads) != 2 || payloads[0] != "one" || payloads[1] != "two" {
+		t.Errorf("payloads = %q", payloads)
+	}
+	if want := time.Unix(2000, int64(time.Millisecond)); !times[1].Equal(want) {
+		t.Errorf("time = %v, want %v", times[1], want)
+	}
+}
+
+// drain reads b until the first error, which mustn't be a panic
+func drain(b []byte) {
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	for {
+		if _, err := r.Next(); err != nil {
+			return
+		}
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	// An IPv4 header longer than the packet
+	ip := ipv4(17, 0, "10.0.0.2", "10.0.0.1", udp(50000, 20777, "dirt"))
+	ip[0] = 0x4f
+	binary.BigEndian.PutUint16(ip[2:], 0xffff)
+	if payloads, _ := readAll(t, pcapFile(binary.LittleEndian, magicMicro, linkRaw, ip), Filter{}); len(payloads) != 0 {
+		t.Errorf("payloads = %q", payloads)
+	}
+
+	// An interface option missing its padding at the end of the block
+	idb := make([]byte, 8+8+5+4)
+	binary.LittleEndian.PutUint32(idb[0:], blockInterface)
+	binary.LittleEndian.PutUint32(idb[4:], uint32(len(idb)))
+	copy(idb[16:], []byte{9, 0, 1, 0, 9})
+	drain(append(pcapngFile(), idb...))
+
+	// Every truncation and corrupted byte of both formats
+	for _, good := range [][]byte{
+		pcapFile(binary.LittleEndian, magicMicro, linkEthernet, ethernet(ipv4(17, 0, "10.0.0.2", "10.0.0.1", udp(50000, 20777, "dirt")))),
+		pcapngFile(ipv4(17, 0, "10.0.0.2", "10.0.0.1", udp(50000, 20777, "one")), ipv6("::1", "::2", udp(50000, 20777, "two"))),
+	} {
+		for i := range good {
+			drain(good[:i])
+			b := append([]byte(nil), good...)
+			b[i] ^= 0xff
+			drain(b)
+		}
+	}
+}
+
+func TestExportReplay(t *testing.T) {
+	b := pcapngFile(
+		ipv4(17, 0, "10.0.0.2", "10.0.0.1", udp(50000, 20777, "one")),
+		ipv4(17, 0, "10.0.0.2", "10.0.0.1", udp(50000, 20777, "two")),
+	)
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if n, err := Export(&out, r, Filter{}); err != nil || n != 2 {
+		t.Fatalf("Export = %d, %v", n, err)
+	}
+	if want := "\x00\x03one\x00\x03two"; out.String() != want {
+		t.Errorf("Export wrote %q, want %q", out.String(), want)
+	}
+
+	rp, err := NewReplay(bytes.NewReader(b), Filter{Port: 20777})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	buf := make([]byte, 2)
+	for _, want := range []string{"on", "tw"} {
+		n, err := rp.Read(buf)
+		if err != nil || string(buf[:n]) != want {
+			t.Errorf("Read = %q, %v, want %q", buf[:n], err, want)
+		}
+	}
+	if d := time.Since(start); d < time.Millisecond {
+		t.Errorf("replayed in %v, captured 1ms apart", d)
+	}
+	if _, err := rp.Read(buf); err != io.EOF {
+		t.Errorf("Read at end = %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// Replay is a telemetry source which reads datagrams from a capture, waiting
+// between them as long as they were apart when captured.  Like opensimdash's
+// Telemetry, each Read returns a single datagram.
+type Replay struct {
+	r      *Reader
+	c      io.Closer
+	filter Filter
+
+	// Speed the capture is replayed at; 1 is real time and zero or less is as
+	// fast as possible
+	Speed float64
+
+	first time.Time // Capture time of the first datagram
+	start time.Time // Wall time the first datagram was replayed
+}
+
+// NewReplay replays the datagrams from r which pass the filter at real time.
+// r is closed by Close if it's an io.Closer.
+func NewReplay(r io.Reader, filter Filter) (*Replay, error) {
+	pr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	rp := &Replay{r: pr, filter: filter, Speed: 1}
+	rp.c, _ = r.(io.Closer)
+	return rp, nil
+}
+
+// Read the next datagram, truncated to the length of b as for UDP.  io.EOF is
+// returned at the end of the capture.
+func (rp *Replay) Read(b []byte) (int, error) {
+	d, err := rp.r.NextMatch(&rp.filter)
+	if err != nil {
+		return 0, err
+	}
+	if rp.Speed > 0 && !d.Time.IsZero() {
+		if rp.first.IsZero() {
+			rp.first, rp.start = d.Time, time.Now()
+		} else if offset := time.Duration(float64(d.Time.Sub(rp.first)) / rp.Speed); offset > 0 {
+			time.Sleep(time.Until(rp.start.Add(offset)))
+		}
+	}
+	return copy(b, d.Payload), nil
+}
+
+// Close the capture
+func (rp *Replay) Close() error {
+	if rp.c != nil {
+		return rp.c.Close()
+	}
+	return nil
+}
+
+// Export writes the datagrams from r which pass the filter to w, each prefixed
+// with its length as a big endian uint16.  This is the framing opensimdash
+// reads from stdin, files and named pipes.  It returns the number of datagrams
+// written.
+//
+// The framing has no timestamps, so the capture times are dropped and an
+// exported file is read as fast as it can be decoded.  Only a Replay of the
+// capture itself keeps the datagrams' timing.
+func Export(w io.Writer, r *Reader, filter Filter) (int, error) {
+	var hdr [2]byte
+	count := 0
+	for {
+		d, err := r.NextMatch(&filter)
+		if err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+		binary.BigEndian.PutUint16(hdr[:], uint16(len(d.Payload)))
+		if _, err := w.Write(hdr[:]); err != nil {
+			return count, err
+		}
+		if _, err := w.Write(d.Payload); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
@@ -0,0 +1,255 @@
+package pcars2
+
+// Layouts follow SMS_UDP_Definitions.hpp (UDP protocol version 2, "Project
+// CARS 2" in the game's settings).  Every packet starts with a PacketBase.
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Packet types (EUDPStreamerPacketHandlerType)
+const (
+	CarPhysics              = 0
+	RaceDefinition          = 1
+	Participants            = 2
+	Timings                 = 3
+	GameState               = 4
+	WeatherState            = 5 // Not sent by the game
+	VehicleNames            = 6 // Not sent by the game
+	TimeStats               = 7
+	ParticipantVehicleNames = 8
+
+	numPacketTypes = 9
+)
+
+// Sizes of each packet type
+const (
+	HeaderSize                  = 12
+	TelemetrySize               = 559
+	RaceDefinitionSize          = 308
+	ParticipantsSize            = 1136
+	TimingsSize                 = 1063
+	GameStateSize               = 24
+	TimeStatsSize               = 1040
+	ParticipantVehicleNamesSize = 1164
+	VehicleClassNamesSize       = 1452 // Also ParticipantVehicleNames, ignored
+
+	// MaxParticipants in timings and time stats, which aren't split
+	MaxParticipants = 32
+
+	// Participant and vehicle names are split into packets of 16
+	participantsPerPacket = 16
+)
+
+// Header is the PacketBase at the start of every packet
+type Header struct {
+	PacketNumber         uint32 // Counter of every packet sent
+	CategoryPacketNumber uint32 // Counter of packets of this type
+	PartialPacketIndex   uint8  // 1 based index of this part
+	PartialPacketNumber  uint8  // Number of parts
+	PacketType           uint8
+	PacketVersion        uint8
+}
+
+func (h *Header) decode(b []byte) {
+	_ = b[HeaderSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	h.PacketNumber = binary.LittleEndian.Uint32(b[0:4])
+	h.CategoryPacketNumber = binary.LittleEndian.Uint32(b[4:8])
+	h.PartialPacketIndex = b[8]
+	h.PartialPacketNumber = b[9]
+	h.PacketType = b[10]
+	h.PacketVersion = b[11]
+}
+
+// Telemetry is the car physics packet for the viewed participant
+type Telemetry struct {
+	ViewedParticipantIndex int8
+	CarFlags               uint8
+	OilTempCelsius         int16
+	WaterTempCelsius       int16
+	FuelCapacity           uint8 // Liters
+	Brake                  uint8
+	Throttle               uint8
+	Clutch                 uint8
+	FuelLevel              float32 // 0.0 - 1.0
+	Speed                  float32 // Meters per second
+	RPM                    uint16
+	MaxRPM                 uint16
+	Steering               int8
+	Gear                   int8 // -1 reverse, 0 neutral
+	NumGears               uint8
+	BoostAmount            uint8
+	OdometerKM             float32
+	TyreTemp               [4]uint8 // Centigrade
+	TyreWear               [4]uint8
+	BrakeTempCelsius       [4]int16
+	EngineSpeed            float32 // Radians per second
+	EngineTorque           float32
+}
+
+// Car flags
+const (
+	CarHeadlight       = 1 << 0
+	CarEngineActive    = 1 << 1
+	CarEngineWarning   = 1 << 2
+	CarSpeedLimiter    = 1 << 3
+	CarABS             = 1 << 4
+	CarHandbrake       = 1 << 5
+	CarTractionControl = 1 << 6
+)
+
+func (t *Telemetry) decode(b []byte) {
+	_ = b[TelemetrySize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	t.ViewedParticipantIndex = int8(b[12])
+	t.CarFlags = b[17]
+	t.OilTempCelsius = int16(binary.LittleEndian.Uint16(b[18:20]))
+	t.WaterTempCelsius = int16(binary.LittleEndian.Uint16(b[22:24]))
+	t.FuelCapacity = b[28]
+	t.Brake = b[29]
+	t.Throttle = b[30]
+	t.Clutch = b[31]
+	t.FuelLevel = float32At(b, 32)
+	t.Speed = float32At(b, 36)
+	t.RPM = binary.LittleEndian.Uint16(b[40:42])
+	t.MaxRPM = binary.LittleEndian.Uint16(b[42:44])
+	t.Steering = int8(b[44])
+
+	// Low nibble is the gear where 15 is reverse, high nibble is gear count
+	t.Gear = int8(b[45] & 0x0f)
+	if t.Gear == 15 {
+		t.Gear = -1
+	}
+	t.NumGears = b[45] >> 4
+
+	t.BoostAmount = b[46]
+	t.OdometerKM = float32At(b, 48)
+	for i := 0; i < 4; i++ {
+		t.TyreTemp[i] = b[176+i]
+		t.TyreWear[i] = b[196+i]
+		t.BrakeTempCelsius[i] = int16(binary.LittleEndian.Uint16(b[208+2*i:]))
+	}
+	t.EngineSpeed = float32At(b, 360)
+	t.EngineTorque = float32At(b, 364)
+}
+
+// Race is the race definition packet
+type Race struct {
+	WorldFastestLapTime    float32
+	PersonalFastestLapTime float32
+	TrackLength            float32
+	TrackLocation          string
+	TrackVariation         string
+	LapsTimeInEvent        uint16 // Laps, or minutes if TimedSession
+	TimedSession           bool
+	EnforcedPitStopLap     int8
+}
+
+func (r *Race) decode(b []byte) {
+	_ = b[RaceDefinitionSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	r.WorldFastestLapTime = float32At(b, 12)
+	r.PersonalFastestLapTime = float32At(b, 16)
+	r.TrackLength = float32At(b, 44)
+	setString(&r.TrackLocation, b[48:112])
+	setString(&r.TrackVariation, b[112:176])
+	laps := binary.LittleEndian.Uint16(b[304:306])
+	r.LapsTimeInEvent = laps & 0x7fff
+	r.TimedSession = laps&0x8000 != 0
+	r.EnforcedPitStopLap = int8(b[306])
+}
+
+// Game is the game state packet
+type Game struct {
+	BuildVersion       uint16
+	GameState          uint8 // Low nibble of mGameState
+	SessionState       uint8 // High nibble of mGameState
+	AmbientTemperature int8
+	TrackTemperature   int8
+	RainDensity        uint8
+	SnowDensity        uint8
+}
+
+func (g *Game) decode(b []byte) {
+	_ = b[GameStateSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	g.BuildVersion = binary.LittleEndian.Uint16(b[12:14])
+	g.GameState = b[14] & 0x0f
+	g.SessionState = b[14] >> 4
+	g.AmbientTemperature = int8(b[15])
+	g.TrackTemperature = int8(b[16])
+	g.RainDensity = b[17]
+	g.SnowDensity = b[18]
+}
+
+// Participant combines everything the game sends about a single car
+type Participant struct {
+	Name         string
+	VehicleIndex uint16
+	VehicleName  string
+	VehicleClass uint32
+
+	// From timings
+	Active          bool
+	Position        uint8
+	Sector          uint8
+	HighestFlag     uint8
+	PitMode         uint8
+	RaceState       uint8
+	CurrentLap      uint8
+	LapDistance     uint16 // Meters
+	CurrentTime     float32
+	CurrentSector   float32
+	MPParticipantID uint16
+
+	// From time stats
+	FastestLapTime float32
+	LastLapTime    float32
+}
+
+// Timing offsets of each participant's sParticipantInfo
+const (
+	timingsParticipantOffset = 33
+	timingsParticipantSize   = 32
+	statsParticipantOffset   = 16
+	statsParticipantSize     = 32
+	vehicleNameOffset        = 12
+	vehicleNameSize          = 72
+)
+
+func (p *Participant) decodeTiming(b []byte) {
+	_ = b[timingsParticipantSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	p.LapDistance = binary.LittleEndian.Uint16(b[12:14])
+	p.Active = b[14]&0x80 != 0
+	p.Position = b[14] & 0x7f
+	p.Sector = b[15] & 0x07
+	p.HighestFlag = b[16]
+	p.PitMode = b[17]
+	p.VehicleIndex = binary.LittleEndian.Uint16(b[18:20])
+	p.RaceState = b[20]
+	p.CurrentLap = b[21]
+	p.CurrentTime = float32At(b, 22)
+	p.CurrentSector = float32At(b, 26)
+	p.MPParticipantID = binary.LittleEndian.Uint16(b[30:32])
+}
+
+func (p *Participant) decodeStats(b []byte) {
+	_ = b[statsParticipantSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	p.FastestLapTime = float32At(b, 0)
+	p.LastLapTime = float32At(b, 4)
+}
+
+// setString converts a nul terminated string, only allocating if it changed
+func setString(s *string, b []byte) {
+	for i, c := range b {
+		if c == 0 {
+			b = b[:i]
+			break
+		}
+	}
+	if string(b) != *s {
+		*s = string(b)
+	}
+}
+
+func float32At(b []byte, i int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4]))
+}
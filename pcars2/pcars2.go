@@ -0,0 +1,340 @@
+// Package pcars2 decodes the UDP protocol of Slightly Mad Studios games, which
+// includes Project CARS 2 and Automobilista 2.  The game sends several packet
+// types, some of them split in parts, which are combined into a single State.
+package pcars2
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+// DefaultPort the game sends to
+const DefaultPort = 5606
+
+// Speed is sent in meters per second, so convert to MPH
+const mslashs float32 = 2.23694
+
+// Stats counts the packets which were not applied to the State
+type Stats struct {
+	OutOfOrder uint64 // Older than the last packet of the same type
+	Unknown    uint64 // Unknown type, or a size which doesn't match the type
+	Incomplete uint64 // Multi-part packets abandoned before all parts arrived
+}
+
+type category struct {
+	seen    bool
+	number  uint32 // CategoryPacketNumber of the last packet
+	version uint8
+	parts   uint8 // Bitmask of the parts received for number
+}
+
+// State is the combination of every packet received from the game.  It
+// implements Decodable so it can be used with Telemetry.DecodePacket.
+type State struct {
+	Header       Header // Header of the last packet
+	Telemetry    Telemetry
+	Race         Race
+	Game         Game
+	Participants [MaxParticipants]Participant
+
+	NumParticipants  int
+	LocalParticipant int // Index of the player, -1 when spectating
+
+	// Split times to the cars ahead/behind the player, from timings
+	SplitTimeAhead  float32
+	SplitTimeBehind float32
+
+	Stats Stats
+
+	categories [numPacketTypes]category
+	names      [MaxParticipants]string // Staged until every part arrives
+	vehicles   [MaxParticipants]string
+	classes    [MaxParticipants]uint32
+	order      []*Participant
+	standings  []hid.Standing
+}
+
+// Size of the largest packet the game sends
+func (s *State) Size() int {
+	return VehicleClassNamesSize
+}
+
+// Decode any of the game's packets into the State
+func (s *State) Decode(b []byte) {
+	if len(b) < HeaderSize {
+		s.Stats.Unknown++
+		return
+	}
+	var h Header
+	h.decode(b)
+	if int(h.PacketType) >= numPacketTypes || !validSize(h.PacketType, len(b)) {
+		s.Stats.Unknown++
+		return
+	}
+	if !s.sequence(&h) {
+		return
+	}
+	s.Header = h
+
+	switch h.PacketType {
+	case CarPhysics:
+		s.Telemetry.decode(b)
+	case RaceDefinition:
+		s.Race.decode(b)
+	case GameState:
+		s.Game.decode(b)
+	case Timings:
+		s.decodeTimings(b)
+	case TimeStats:
+		for i := range s.Participants {
+			off := statsParticipantOffset + i*statsParticipantSize
+			s.Participants[i].decodeStats(b[off : off+statsParticipantSize])
+		}
+	case Participants:
+		for i := 0; i < participantsPerPacket; i++ {
+			idx := int(binary.LittleEndian.Uint16(b[1104+2*i:]))
+			if idx < MaxParticipants {
+				setString(&s.names[idx], b[16+64*i:80+64*i])
+			}
+		}
+		s.complete(&h)
+	case ParticipantVehicleNames:
+		if len(b) != ParticipantVehicleNamesSize {
+			return // Vehicle class names aren't needed
+		}
+		for i := 0; i < participantsPerPacket; i++ {
+			v := b[vehicleNameOffset+i*vehicleNameSize:]
+			idx := int(binary.LittleEndian.Uint16(v[0:2]))
+			if idx < MaxParticipants {
+				s.classes[idx] = binary.LittleEndian.Uint32(v[4:8])
+				setString(&s.vehicles[idx], v[8:72])
+			}
+		}
+		s.complete(&h)
+	}
+}
+
+func validSize(t uint8, n int) bool {
+	switch t {
+	case CarPhysics:
+		return n == TelemetrySize
+	case RaceDefinition:
+		return n == RaceDefinitionSize
+	case Participants:
+		return n == ParticipantsSize
+	case Timings:
+		return n == TimingsSize
+	case GameState:
+		return n == GameStateSize
+	case TimeStats:
+		return n == TimeStatsSize
+	case ParticipantVehicleNames:
+		return n == ParticipantVehicleNamesSize || n == VehicleClassNamesSize
+	}
+	return false
+}
+
+// sequence drops packets older than the last packet of the same type, and
+// tracks which parts of a multi-part packet have arrived.  A new version of a
+// packet type starts its sequence over, since the game restarted.
+func (s *State) sequence(h *Header) bool {
+	c := &s.categories[h.PacketType]
+	if c.seen && c.version == h.PacketVersion {
+		// Compare as signed so the counter can wrap around
+		switch d := int32(h.CategoryPacketNumber - c.number); {
+		case d < 0:
+			s.Stats.OutOfOrder++
+			return false
+		case d > 0:
+			if c.parts != 0 {
+				s.Stats.Incomplete++
+			}
+			c.parts = 0
+		}
+	} else {
+		c.parts = 0
+	}
+	c.seen = true
+	c.number = h.CategoryPacketNumber
+	c.version = h.PacketVersion
+	if h.PartialPacketIndex > 0 && h.PartialPacketIndex <= 8 {
+		c.parts |= 1 << (h.PartialPacketIndex - 1)
+	}
+	return true
+}
+
+// complete copies staged names to the participants once every part of the
+// current multi-part packet has arrived.
+func (s *State) complete(h *Header) {
+	c := &s.categories[h.PacketType]
+	n := h.PartialPacketNumber
+	if n == 0 || n > 8 || c.parts != 1<<n-1 {
+		return
+	}
+	c.parts = 0
+	for i := range s.Participants {
+		p := &s.Participants[i]
+		switch h.PacketType {
+		case Participants:
+			p.Name = s.names[i]
+		case ParticipantVehicleNames:
+			p.VehicleName = s.vehicles[i]
+			p.VehicleClass = s.classes[i]
+		}
+	}
+}
+
+func (s *State) decodeTimings(b []byte) {
+	s.NumParticipants = int(int8(b[12]))
+	if s.NumParticipants > MaxParticipants {
+		s.NumParticipants = MaxParticipants
+	}
+	s.SplitTimeAhead = float32At(b, 21)
+	s.SplitTimeBehind = float32At(b, 25)
+	for i := range s.Participants {
+		off := timingsParticipantOffset + i*timingsParticipantSize
+		s.Participants[i].decodeTiming(b[off : off+timingsParticipantSize])
+	}
+	s.LocalParticipant = int(int16(binary.LittleEndian.Uint16(b[1057:1059])))
+	if s.LocalParticipant >= MaxParticipants {
+		s.LocalParticipant = -1
+	}
+}
+
+func (s *State) local() *Participant {
+	if s.LocalParticipant < 0 || s.LocalParticipant >= MaxParticipants {
+		return nil
+	}
+	return &s.Participants[s.LocalParticipant]
+}
+
+func (s *State) GetGear() int {
+	return int(s.Telemetry.Gear)
+}
+
+func (s *State) GetRevLightPercent() int {
+	if s.Telemetry.MaxRPM == 0 {
+		return 0
+	}
+	return int(100 * uint32(s.Telemetry.RPM) / uint32(s.Telemetry.MaxRPM))
+}
+
+func (s *State) GetSpeed() int {
+	return int(s.Telemetry.Speed * mslashs)
+}
+
+func (s *State) GetRPM() int {
+	return int(s.Telemetry.RPM)
+}
+
+func (s *State) GetMaxRPM() int {
+	return int(s.Telemetry.MaxRPM)
+}
+
+// GetIdleRPM is always zero since the game doesn't send it
+func (s *State) GetIdleRPM() int {
+	return 0
+}
+
+// GetFuel in liters
+func (s *State) GetFuel() float32 {
+	return s.Telemetry.FuelLevel * float32(s.Telemetry.FuelCapacity)
+}
+
+func (s *State) GetFuelCapacity() float32 {
+	return float32(s.Telemetry.FuelCapacity)
+}
+
+func (s *State) GetTyreTemps() (t [4]float32) {
+	for i, v := range s.Telemetry.TyreTemp {
+		t[i] = float32(v)
+	}
+	return t
+}
+
+func (s *State) GetBrakeTemps() (t [4]float32) {
+	for i, v := range s.Telemetry.BrakeTempCelsius {
+		t[i] = float32(v)
+	}
+	return t
+}
+
+func (s *State) GetLap() int {
+	if p := s.local(); p != nil {
+		return int(p.CurrentLap)
+	}
+	return 0
+}
+
+func (s *State) GetLapTime() float32 {
+	if p := s.local(); p != nil {
+		return p.CurrentTime
+	}
+	return 0
+}
+
+func (s *State) GetLastLapTime() float32 {
+	if p := s.local(); p != nil {
+		return p.LastLapTime
+	}
+	return 0
+}
+
+func (s *State) GetBestLapTime() float32 {
+	if p := s.local(); p != nil {
+		return p.FastestLapTime
+	}
+	return 0
+}
+
+func (s *State) GetPosition() int {
+	if p := s.local(); p != nil {
+		return int(p.Position)
+	}
+	return 0
+}
+
+func (s *State) GetCarCount() int {
+	var n int
+	for i := range s.Participants {
+		if p := &s.Participants[i]; p.Active && p.Position > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// GetStandings of the active participants.  The game only sends split times
+// for the player, so gaps are only filled in for the player's car.
+func (s *State) GetStandings() []hid.Standing {
+	s.order = s.order[:0]
+	for i := range s.Participants {
+		if p := &s.Participants[i]; p.Active && p.Position > 0 {
+			s.order = append(s.order, p)
+		}
+	}
+	sort.Slice(s.order, func(i, j int) bool {
+		return s.order[i].Position < s.order[j].Position
+	})
+
+	local := s.local()
+	s.standings = s.standings[:0]
+	for _, p := range s.order {
+		st := hid.Standing{
+			Position:    int(p.Position),
+			CarIndex:    int(p.VehicleIndex),
+			Driver:      p.Name,
+			Laps:        int(p.CurrentLap),
+			LastLapTime: p.LastLapTime,
+			BestLapTime: p.FastestLapTime,
+			InPit:       p.PitMode != 0,
+		}
+		if p == local && s.SplitTimeAhead > 0 {
+			st.GapAhead = s.SplitTimeAhead
+		}
+		s.standings = append(s.standings, st)
+	}
+	return s.standings
+}
@@ -0,0 +1,96 @@
+package pcars2
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func packet(size int, t, part, parts uint8, category uint32) []byte {
+	b := make([]byte, size)
+	binary.LittleEndian.PutUint32(b[4:8], category)
+	b[8], b[9], b[10], b[11] = part, parts, t, 1
+	return b
+}
+
+func participants(part uint8, category uint32, first int, name string) []byte {
+	b := packet(ParticipantsSize, Participants, part, 2, category)
+	for i := 0; i < participantsPerPacket; i++ {
+		binary.LittleEndian.PutUint16(b[1104+2*i:], uint16(first+i))
+	}
+	copy(b[16:], name)
+	return b
+}
+
+func TestTelemetry(t *testing.T) {
+	b := packet(TelemetrySize, CarPhysics, 1, 1, 1)
+	b[28] = 60
+	binary.LittleEndian.PutUint32(b[32:], math.Float32bits(0.5))
+	binary.LittleEndian.PutUint32(b[36:], math.Float32bits(10))
+	binary.LittleEndian.PutUint16(b[40:], 7200)
+	binary.LittleEndian.PutUint16(b[42:], 8000)
+	b[45] = 6<<4 | 3
+	b[176] = 85
+
+	s := &State{}
+	s.Decode(b)
+	if s.GetGear() != 3 || s.Telemetry.NumGears != 6 || s.GetSpeed() != 22 || s.GetRevLightPercent() != 90 {
+		t.Errorf("Gear=%d Gears=%d Speed=%d Rev=%d", s.GetGear(), s.Telemetry.NumGears, s.GetSpeed(), s.GetRevLightPercent())
+	}
+	if s.GetFuel() != 30 || s.GetTyreTemps()[0] != 85 {
+		t.Errorf("Fuel=%f Tyre=%v", s.GetFuel(), s.GetTyreTemps())
+	}
+
+	b[45] = 6<<4 | 15
+	s.Decode(b[:100])
+	if s.Stats.Unknown != 1 {
+		t.Error("Short packet was not dropped")
+	}
+	binary.LittleEndian.PutUint32(b[4:8], 2)
+	s.Decode(b)
+	if s.GetGear() != -1 {
+		t.Errorf("Reverse gear = %d", s.GetGear())
+	}
+}
+
+func TestReassembly(t *testing.T) {
+	s := &State{}
+
+	// Only the first part arrives, so nothing is committed
+	s.Decode(participants(1, 1, 0, "first"))
+	if s.Participants[0].Name != "" {
+		t.Error("Incomplete participants were committed")
+	}
+
+	// A newer packet abandons the first, and parts can arrive in any order
+	s.Decode(participants(2, 2, 16, "second"))
+	s.Decode(participants(1, 2, 0, "third"))
+	if s.Stats.Incomplete != 1 {
+		t.Errorf("Incomplete = %d", s.Stats.Incomplete)
+	}
+	if s.Participants[0].Name != "third" || s.Participants[16].Name != "second" {
+		t.Errorf("Names = %q, %q", s.Participants[0].Name, s.Participants[16].Name)
+	}
+
+	// Older packets are dropped
+	s.Decode(participants(1, 1, 0, "old"))
+	if s.Stats.OutOfOrder != 1 || s.Participants[0].Name != "third" {
+		t.Errorf("OutOfOrder = %d, Name = %q", s.Stats.OutOfOrder, s.Participants[0].Name)
+	}
+}
+
+func TestStandings(t *testing.T) {
+	b := packet(TimingsSize, Timings, 1, 1, 1)
+	b[12] = 2
+	binary.LittleEndian.PutUint32(b[21:], math.Float32bits(1.5))
+	b[timingsParticipantOffset+14] = 0x80 | 2
+	b[timingsParticipantOffset+timingsParticipantSize+14] = 0x80 | 1
+	binary.LittleEndian.PutUint16(b[1057:], 0)
+
+	s := &State{}
+	s.Decode(b)
+	st := s.GetStandings()
+	if len(st) != 2 || s.GetCarCount() != 2 || s.GetPosition() != 2 || st[1].GapAhead != 1.5 || st[0].GapAhead != 0 {
+		t.Errorf("Position=%d Standings=%+v", s.GetPosition(), st)
+	}
+}
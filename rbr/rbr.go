@@ -0,0 +1,359 @@
+// Package rbr decodes the UDP telemetry sent by the NGP plugin for Richard
+// Burns Rally.
+package rbr
+
+// Layout from RBR.Telemetry.h, distributed with the NGP plugin
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+const (
+	// PacketSize of the TelemetryData structure
+	PacketSize = 664
+
+	// DefaultPort NGP sends to, set by udpTelemetryAddress in RichardBurnsRally.ini
+	DefaultPort = 6776
+
+	// Speed is sent in kilometers per hour, so convert to MPH
+	kmslashh float32 = 0.621371
+
+	// Splits timed along each stage, see GetSplits
+	numSplits = 2
+)
+
+// Sizes of the nested structures
+const (
+	stageSize      = 20
+	controlSize    = 32
+	motionSize     = 24
+	engineSize     = 16
+	suspensionSize = 32
+	carSize        = 224
+	wheelSize      = 96
+)
+
+// Stage is the progress through the current stage
+type Stage struct {
+	Index             int32
+	Progress          float32 // Meters driven along the drive line
+	RaceTime          float32 // Seconds, including penalties
+	DriveLineLocation float32
+	DistanceToEnd     float32 // Meters
+}
+
+// Control is the driver's inputs
+type Control struct {
+	Steering          float32
+	Throttle          float32
+	Brake             float32
+	Handbrake         float32
+	Clutch            float32
+	Gear              int32 // 0 = reverse, 1 = neutral, 2 = first
+	FootbrakePressure float32
+	HandbrakePressure float32
+}
+
+// Motion along and around the car's axes
+type Motion struct {
+	Surge float32
+	Sway  float32
+	Heave float32
+	Roll  float32
+	Pitch float32
+	Yaw   float32
+}
+
+// Engine temperatures are in Kelvin
+type Engine struct {
+	RPM                        float32
+	RadiatorCoolantTemperature float32
+	EngineCoolantTemperature   float32
+	EngineTemperature          float32
+}
+
+// Damper state of a single corner
+type Damper struct {
+	Damage         float32
+	PistonVelocity float32
+}
+
+// Suspension state of a single corner
+type Suspension struct {
+	SpringDeflection     float32
+	RollbarForce         float32
+	SpringForce          float32
+	DamperForce          float32
+	StrutForce           float32
+	HelperSpringIsActive int32
+	Damper               Damper
+}
+
+// Car state.  Suspension is ordered front left, front right, rear left, rear
+// right.
+type Car struct {
+	Index         int32
+	Speed         float32 // Kilometers per hour
+	PositionX     float32
+	PositionY     float32
+	PositionZ     float32
+	Roll          float32
+	Pitch         float32
+	Yaw           float32
+	Velocities    Motion
+	Accelerations Motion
+	Engine        Engine
+	Suspension    [4]Suspension
+}
+
+// TyreSegment is one of the eight segments around a tyre's circumference
+type TyreSegment struct {
+	Temperature float32
+	Wear        float32
+}
+
+// Tyre temperatures are in Kelvin
+type Tyre struct {
+	Pressure           float32
+	Temperature        float32
+	CarcassTemperature float32
+	TreadTemperature   float32
+	CurrentSegment     uint32
+	Segments           [8]TyreSegment
+}
+
+// BrakeDisk temperatures are in Kelvin
+type BrakeDisk struct {
+	LayerTemperature float32
+	Temperature      float32
+	Wear             float32
+}
+
+// Wheel is the brake disk and tyre of a single corner
+type Wheel struct {
+	BrakeDisk BrakeDisk
+	Tyre      Tyre
+}
+
+// Packet is the TelemetryData sent by NGP every simulation step.  Wheels are
+// ordered front left, front right, rear left, rear right.  MaxRPM isn't sent,
+// so it can be set by the user, otherwise it's learnt from the RPM, see
+// hid.PeakRPM.
+type Packet struct {
+	TotalSteps uint32
+	Stage      Stage
+	Control    Control
+	Car        Car
+	Wheels     [4]Wheel
+
+	MaxRPM float32
+
+	peak   hid.PeakRPM
+	splits [numSplits]float32 // Stage times at the splits passed
+	passed int
+}
+
+// Size of the packet
+func (p *Packet) Size() int {
+	return PacketSize
+}
+
+// Decode a little endian TelemetryData without allocations.  Datagrams shorter
+// than PacketSize are ignored.
+func (p *Packet) Decode(b []byte) {
+	if len(b) < PacketSize {
+		return
+	}
+	_ = b[PacketSize-1] // bounds check hint to compiler; see golang.org/issue/14808
+	p.TotalSteps = binary.LittleEndian.Uint32(b[0:4])
+	p.Stage.decode(b[4 : 4+stageSize])
+	p.Control.decode(b[24 : 24+controlSize])
+	p.Car.decode(b[56 : 56+carSize])
+	for i := range p.Wheels {
+		off := 56 + carSize + i*wheelSize
+		p.Wheels[i].decode(b[off : off+wheelSize])
+	}
+
+	p.peak.Update(p.Car.Engine.RPM)
+	p.split()
+}
+
+// split times the splits passed since the last packet.  A stage time which
+// went backwards is a new or restarted stage.
+func (p *Packet) split() {
+	if p.passed > 0 && p.Stage.RaceTime < p.splits[p.passed-1] {
+		p.passed = 0
+	}
+	length := p.GetStageLength()
+	for p.passed < numSplits && length > 0 && p.Stage.Progress >= length*float32(p.passed+1)/(numSplits+1) {
+		p.splits[p.passed] = p.Stage.RaceTime
+		p.passed++
+	}
+}
+
+func (s *Stage) decode(b []byte) {
+	_ = b[stageSize-1]
+	s.Index = int32(binary.LittleEndian.Uint32(b[0:4]))
+	s.Progress = float32At(b, 4)
+	s.RaceTime = float32At(b, 8)
+	s.DriveLineLocation = float32At(b, 12)
+	s.DistanceToEnd = float32At(b, 16)
+}
+
+func (c *Control) decode(b []byte) {
+	_ = b[controlSize-1]
+	c.Steering = float32At(b, 0)
+	c.Throttle = float32At(b, 4)
+	c.Brake = float32At(b, 8)
+	c.Handbrake = float32At(b, 12)
+	c.Clutch = float32At(b, 16)
+	c.Gear = int32(binary.LittleEndian.Uint32(b[20:24]))
+	c.FootbrakePressure = float32At(b, 24)
+	c.HandbrakePressure = float32At(b, 28)
+}
+
+func (m *Motion) decode(b []byte) {
+	_ = b[motionSize-1]
+	m.Surge = float32At(b, 0)
+	m.Sway = float32At(b, 4)
+	m.Heave = float32At(b, 8)
+	m.Roll = float32At(b, 12)
+	m.Pitch = float32At(b, 16)
+	m.Yaw = float32At(b, 20)
+}
+
+func (s *Suspension) decode(b []byte) {
+	_ = b[suspensionSize-1]
+	s.SpringDeflection = float32At(b, 0)
+	s.RollbarForce = float32At(b, 4)
+	s.SpringForce = float32At(b, 8)
+	s.DamperForce = float32At(b, 12)
+	s.StrutForce = float32At(b, 16)
+	s.HelperSpringIsActive = int32(binary.LittleEndian.Uint32(b[20:24]))
+	s.Damper.Damage = float32At(b, 24)
+	s.Damper.PistonVelocity = float32At(b, 28)
+}
+
+func (c *Car) decode(b []byte) {
+	_ = b[carSize-1]
+	c.Index = int32(binary.LittleEndian.Uint32(b[0:4]))
+	c.Speed = float32At(b, 4)
+	c.PositionX = float32At(b, 8)
+	c.PositionY = float32At(b, 12)
+	c.PositionZ = float32At(b, 16)
+	c.Roll = float32At(b, 20)
+	c.Pitch = float32At(b, 24)
+	c.Yaw = float32At(b, 28)
+	c.Velocities.decode(b[32 : 32+motionSize])
+	c.Accelerations.decode(b[56 : 56+motionSize])
+	c.Engine.RPM = float32At(b, 80)
+	c.Engine.RadiatorCoolantTemperature = float32At(b, 84)
+	c.Engine.EngineCoolantTemperature = float32At(b, 88)
+	c.Engine.EngineTemperature = float32At(b, 92)
+	for i := range c.Suspension {
+		off := 80 + engineSize + i*suspensionSize
+		c.Suspension[i].decode(b[off : off+suspensionSize])
+	}
+}
+
+func (w *Wheel) decode(b []byte) {
+	_ = b[wheelSize-1]
+	w.BrakeDisk.LayerTemperature = float32At(b, 0)
+	w.BrakeDisk.Temperature = float32At(b, 4)
+	w.BrakeDisk.Wear = float32At(b, 8)
+	t := &w.Tyre
+	t.Pressure = float32At(b, 12)
+	t.Temperature = float32At(b, 16)
+	t.CarcassTemperature = float32At(b, 20)
+	t.TreadTemperature = float32At(b, 24)
+	t.CurrentSegment = binary.LittleEndian.Uint32(b[28:32])
+	for i := range t.Segments {
+		t.Segments[i].Temperature = float32At(b, 32+8*i)
+		t.Segments[i].Wear = float32At(b, 36+8*i)
+	}
+}
+
+// GetGear returns -1 for reverse and 0 for neutral
+func (p *Packet) GetGear() int {
+	return int(p.Control.Gear) - 1
+}
+
+func (p *Packet) GetRevLightPercent() int {
+	return p.peak.Percent(p.Car.Engine.RPM, p.MaxRPM)
+}
+
+func (p *Packet) GetSpeed() int {
+	return int(p.Car.Speed * kmslashh)
+}
+
+func (p *Packet) GetRPM() int {
+	return int(p.Car.Engine.RPM)
+}
+
+// GetMaxRPM is either the user supplied MaxRPM or the learnt maximum, which is
+// zero until it's known
+func (p *Packet) GetMaxRPM() int {
+	return int(p.peak.Max(p.MaxRPM))
+}
+
+// GetIdleRPM is always zero since NGP doesn't send it
+func (p *Packet) GetIdleRPM() int {
+	return 0
+}
+
+func (p *Packet) GetStageProgress() float32 {
+	length := p.GetStageLength()
+	if length <= 0 {
+		return 0
+	}
+	return p.Stage.Progress / length
+}
+
+func (p *Packet) GetStageDistance() float32 {
+	return p.Stage.Progress
+}
+
+// GetStageLength is the distance driven plus the distance remaining
+func (p *Packet) GetStageLength() float32 {
+	return p.Stage.Progress + p.Stage.DistanceToEnd
+}
+
+func (p *Packet) GetStageTime() float32 {
+	return p.Stage.RaceTime
+}
+
+// GetSplits are the stage times at the splits passed so far.  NGP doesn't send
+// where the stage's own splits are, so the stage is split into thirds.
+func (p *Packet) GetSplits() []float32 {
+	return p.splits[:p.passed]
+}
+
+// GetTyreTemps converts tread temperatures to Celsius
+func (p *Packet) GetTyreTemps() (t [4]float32) {
+	for i := range p.Wheels {
+		t[i] = celsius(p.Wheels[i].Tyre.TreadTemperature)
+	}
+	return t
+}
+
+// GetBrakeTemps converts brake disk temperatures to Celsius
+func (p *Packet) GetBrakeTemps() (t [4]float32) {
+	for i := range p.Wheels {
+		t[i] = celsius(p.Wheels[i].BrakeDisk.Temperature)
+	}
+	return t
+}
+
+func celsius(k float32) float32 {
+	if k == 0 {
+		return 0
+	}
+	return k - 273.15
+}
+
+func float32At(b []byte, i int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(b[i : i+4]))
+}
@@ -0,0 +1,76 @@
+package rbr
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func put(b []byte, off int, f float32) {
+	binary.LittleEndian.PutUint32(b[off:], math.Float32bits(f))
+}
+
+func TestDecode(t *testing.T) {
+	b := make([]byte, PacketSize)
+	binary.LittleEndian.PutUint32(b[0:], 42)
+	put(b, 8, 1500)   // stage progress
+	put(b, 12, 61.5)  // race time
+	put(b, 20, 4500)  // distance to end
+	b[44] = 3         // second gear
+	put(b, 60, 100)   // speed
+	put(b, 136, 6000) // rpm
+	put(b, 280+96+4, 573.15)
+	put(b, 280+96+24, 353.15)
+	put(b, 280+3*96+36+7*8, 0.25) // rear right last segment wear
+
+	var p Packet
+	p.Decode(b)
+	if p.TotalSteps != 42 || p.GetGear() != 2 || p.GetSpeed() != 62 || p.GetRPM() != 6000 {
+		t.Errorf("Steps=%d Gear=%d Speed=%d RPM=%d", p.TotalSteps, p.GetGear(), p.GetSpeed(), p.GetRPM())
+	}
+	if p.GetStageLength() != 6000 || p.GetStageProgress() != 0.25 || p.GetStageTime() != 61.5 {
+		t.Errorf("Length=%f Progress=%f Time=%f", p.GetStageLength(), p.GetStageProgress(), p.GetStageTime())
+	}
+	if bt := p.GetBrakeTemps(); bt[1] < 299.9 || bt[1] > 300.1 || bt[0] != 0 {
+		t.Errorf("Brakes = %v", bt)
+	}
+	if tt := p.GetTyreTemps(); tt[1] < 79.9 || tt[1] > 80.1 {
+		t.Errorf("Tyres = %v", tt)
+	}
+	if w := p.Wheels[3].Tyre.Segments[7].Wear; w != 0.25 {
+		t.Errorf("Wear = %f", w)
+	}
+
+	p.Decode(b[:PacketSize-1])
+	p.MaxRPM = 8000
+	if p.GetRevLightPercent() != 75 {
+		t.Errorf("Rev = %d", p.GetRevLightPercent())
+	}
+}
+
+func TestSplits(t *testing.T) {
+	b := make([]byte, PacketSize)
+	var p Packet
+	stage := func(progress, time float32) []float32 {
+		put(b, 8, progress)
+		put(b, 12, time)
+		put(b, 20, 6000-progress)
+		p.Decode(b)
+		return p.GetSplits()
+	}
+
+	if s := stage(1000, 30); len(s) != 0 {
+		t.Errorf("splits = %v before the first", s)
+	}
+	if s := stage(2100, 62); len(s) != 1 || s[0] != 62 {
+		t.Errorf("splits = %v after the first", s)
+	}
+	if s := stage(6000, 190); len(s) != 2 || s[1] != 190 {
+		t.Errorf("splits = %v at the finish", s)
+	}
+
+	// A restarted stage starts its splits again
+	if s := stage(10, 1); len(s) != 0 {
+		t.Errorf("splits = %v after a restart", s)
+	}
+}
@@ -0,0 +1,460 @@
+// Package schema decodes telemetry from any game which sends fixed layout
+// binary packets, using a JSON schema in place of a hand-written Decode.
+//
+// A schema lists one or more packets.  Each packet has the fields to decode and
+// optionally header values which must match for the packet to be chosen:
+//
+//	{
+//	  "name": "Homebrew Sim",
+//	  "endian": "little",
+//	  "port": 20800,
+//	  "packets": [{
+//	    "id": "car",
+//	    "match": [{"offset": 0, "type": "u8", "value": 2}],
+//	    "fields": [
+//	      {"offset": 4, "type": "f32", "channel": "rpm"},
+//	      {"offset": 8, "type": "u8", "channel": "gear", "bias": -1},
+//	      {"offset": 12, "type": "u16", "endian": "big", "scale": 0.1, "channel": "speed"}
+//	    ]
+//	  }]
+//	}
+//
+// Values are decoded as value*scale + bias.  Fields mapped to one of the
+// Channel constants drive the TelemetryPack getters, and any other channel name
+// can still be read with Value.
+package schema
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Channels understood by the telemetry model, after scale and bias are applied
+const (
+	ChannelGear          = "gear"  // -1 = reverse, 0 = neutral
+	ChannelSpeed         = "speed" // Meters per second
+	ChannelRPM           = "rpm"
+	ChannelMaxRPM        = "max_rpm"
+	ChannelIdleRPM       = "idle_rpm"
+	ChannelRevLight      = "rev_light"      // Percent, otherwise computed from rpm and max_rpm
+	ChannelStageProgress = "stage_progress" // 0.0 - 1.0
+	ChannelStageDistance = "stage_distance" // Meters
+	ChannelStageLength   = "stage_length"   // Meters
+	ChannelStageTime     = "stage_time"     // Seconds
+	ChannelLap           = "lap"
+	ChannelLapTime       = "lap_time"      // Seconds
+	ChannelLastLapTime   = "last_lap_time" // Seconds
+	ChannelBestLapTime   = "best_lap_time" // Seconds
+	ChannelPosition      = "position"
+	ChannelFuel          = "fuel"
+	ChannelFuelCapacity  = "fuel_capacity"
+)
+
+// Wheel channels are ordered front left, front right, rear left, rear right
+var (
+	ChannelTyreTemps  = [4]string{"tyre_temp_fl", "tyre_temp_fr", "tyre_temp_rl", "tyre_temp_rr"}     // Celsius
+	ChannelBrakeTemps = [4]string{"brake_temp_fl", "brake_temp_fr", "brake_temp_rl", "brake_temp_rr"} // Celsius
+)
+
+// Speed is in meters per second, so convert to MPH
+const mslashs = 2.23694
+
+// Schema is a parsed schema file
+type Schema struct {
+	Name    string         `json:"name"`
+	Endian  string         `json:"endian"` // "little" (default) or "big"
+	Port    int            `json:"port"`   // UDP port the game sends to by default, if any
+	Packets []PacketSchema `json:"packets"`
+}
+
+// PacketSchema is a single packet layout.  Size defaults to the end of the
+// last field or match.
+type PacketSchema struct {
+	ID     string  `json:"id"`
+	Size   int     `json:"size"`
+	Match  []Match `json:"match"`
+	Fields []Field `json:"fields"`
+}
+
+// Match is a header value which must be present for a packet to be decoded
+type Match struct {
+	Offset int     `json:"offset"`
+	Type   string  `json:"type"`
+	Endian string  `json:"endian"`
+	Value  float64 `json:"value"`
+}
+
+// Field is a single value in a packet.  Scale defaults to one.
+type Field struct {
+	Offset  int      `json:"offset"`
+	Type    string   `json:"type"` // u8, i8, u16, i16, u32, i32, u64, i64, f32 or f64
+	Endian  string   `json:"endian"`
+	Scale   *float64 `json:"scale"`
+	Bias    float64  `json:"bias"`
+	Channel string   `json:"channel"`
+}
+
+type kind uint8
+
+const (
+	kindU8 kind = iota + 1
+	kindI8
+	kindU16
+	kindI16
+	kindU32
+	kindI32
+	kindU64
+	kindI64
+	kindF32
+	kindF64
+)
+
+var kinds = map[string]kind{
+	"u8": kindU8, "i8": kindI8,
+	"u16": kindU16, "i16": kindI16,
+	"u32": kindU32, "i32": kindI32,
+	"u64": kindU64, "i64": kindI64,
+	"f32": kindF32, "f64": kindF64,
+}
+
+func (k kind) size() int {
+	switch k {
+	case kindU8, kindI8:
+		return 1
+	case kindU16, kindI16:
+		return 2
+	case kindU32, kindI32, kindF32:
+		return 4
+	}
+	return 8
+}
+
+type value struct {
+	offset int
+	kind   kind
+	order  binary.ByteOrder
+}
+
+func (v *value) decode(b []byte) float64 {
+	b = b[v.offset:]
+	switch v.kind {
+	case kindU8:
+		return float64(b[0])
+	case kindI8:
+		return float64(int8(b[0]))
+	case kindU16:
+		return float64(v.order.Uint16(b))
+	case kindI16:
+		return float64(int16(v.order.Uint16(b)))
+	case kindU32:
+		return float64(v.order.Uint32(b))
+	case kindI32:
+		return float64(int32(v.order.Uint32(b)))
+	case kindU64:
+		return float64(v.order.Uint64(b))
+	case kindI64:
+		return float64(int64(v.order.Uint64(b)))
+	case kindF32:
+		return float64(math.Float32frombits(v.order.Uint32(b)))
+	case kindF64:
+		return math.Float64frombits(v.order.Uint64(b))
+	}
+	return 0
+}
+
+type match struct {
+	value
+	want float64
+}
+
+type field struct {
+	value
+	scale, bias float64
+	slot        int
+}
+
+type layout struct {
+	id      string
+	size    int
+	matches []match
+	fields  []field
+}
+
+// Packet decodes any of the packets described by a schema.  Channels not
+// present in the schema read as zero.
+type Packet struct {
+	// ID of the last decoded packet
+	ID string
+
+	name    string
+	port    int
+	ids     []string
+	slots   map[string]int
+	values  []float64
+	set     []bool
+	layouts []layout
+	size    int
+}
+
+// Load reads a JSON schema and returns a Packet which can decode the datagrams
+// it describes.
+func Load(r io.Reader) (*Packet, error) {
+	var s Schema
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("schema: %v", err)
+	}
+	return New(&s)
+}
+
+// New is the same as Load for an already parsed schema
+func New(s *Schema) (*Packet, error) {
+	def, err := byteOrder(s.Endian, binary.LittleEndian)
+	if err != nil {
+		return nil, fmt.Errorf("schema %q: %v", s.Name, err)
+	}
+	if len(s.Packets) == 0 {
+		return nil, fmt.Errorf("schema %q: no packets", s.Name)
+	}
+
+	p := &Packet{name: s.Name, port: s.Port, slots: make(map[string]int)}
+	for i := range s.Packets {
+		ps := &s.Packets[i]
+		l := layout{id: ps.ID, size: ps.Size}
+		end := 0
+		for _, m := range ps.Match {
+			v, err := newValue(m.Offset, m.Type, m.Endian, def)
+			if err != nil {
+				return nil, fmt.Errorf("schema %q packet %q match: %v", s.Name, ps.ID, err)
+			}
+			if e := v.offset + v.kind.size(); e > end {
+				end = e
+			}
+			l.matches = append(l.matches, match{value: v, want: m.Value})
+		}
+		for _, f := range ps.Fields {
+			if f.Channel == "" {
+				return nil, fmt.Errorf("schema %q packet %q: field at %d has no channel", s.Name, ps.ID, f.Offset)
+			}
+			v, err := newValue(f.Offset, f.Type, f.Endian, def)
+			if err != nil {
+				return nil, fmt.Errorf("schema %q packet %q channel %q: %v", s.Name, ps.ID, f.Channel, err)
+			}
+			if e := v.offset + v.kind.size(); e > end {
+				end = e
+			}
+			slot, ok := p.slots[f.Channel]
+			if !ok {
+				slot = len(p.ids)
+				p.slots[f.Channel] = slot
+				p.ids = append(p.ids, f.Channel)
+			}
+			scale := 1.0
+			if f.Scale != nil {
+				scale = *f.Scale
+			}
+			l.fields = append(l.fields, field{value: v, scale: scale, bias: f.Bias, slot: slot})
+		}
+		if l.size == 0 {
+			l.size = end
+		} else if end > l.size {
+			return nil, fmt.Errorf("schema %q packet %q: fields end at %d beyond size %d", s.Name, ps.ID, end, l.size)
+		}
+		if l.size > p.size {
+			p.size = l.size
+		}
+		p.layouts = append(p.layouts, l)
+	}
+	p.values = make([]float64, len(p.ids))
+	p.set = make([]bool, len(p.ids))
+	return p, nil
+}
+
+func newValue(offset int, typ, endian string, def binary.ByteOrder) (value, error) {
+	k, ok := kinds[typ]
+	if !ok {
+		return value{}, fmt.Errorf("unknown type %q", typ)
+	}
+	if offset < 0 {
+		return value{}, fmt.Errorf("negative offset %d", offset)
+	}
+	order, err := byteOrder(endian, def)
+	if err != nil {
+		return value{}, err
+	}
+	return value{offset: offset, kind: k, order: order}, nil
+}
+
+func byteOrder(endian string, def binary.ByteOrder) (binary.ByteOrder, error) {
+	switch endian {
+	case "":
+		return def, nil
+	case "little":
+		return binary.LittleEndian, nil
+	case "big":
+		return binary.BigEndian, nil
+	}
+	return nil, fmt.Errorf("unknown endian %q", endian)
+}
+
+// Name of the schema
+func (p *Packet) Name() string {
+	return p.name
+}
+
+// Port the game sends to by default, or zero if the schema doesn't say
+func (p *Packet) Port() int {
+	return p.port
+}
+
+// Size of the largest packet in the schema
+func (p *Packet) Size() int {
+	return p.size
+}
+
+// Decode a datagram with the first packet layout whose matches are all equal
+// and which fits in the datagram.  Datagrams which don't match any packet are
+// ignored.
+func (p *Packet) Decode(b []byte) {
+next:
+	for i := range p.layouts {
+		l := &p.layouts[i]
+		if len(b) < l.size {
+			continue
+		}
+		for j := range l.matches {
+			if l.matches[j].decode(b) != l.matches[j].want {
+				continue next
+			}
+		}
+		p.ID = l.id
+		for j := range l.fields {
+			f := &l.fields[j]
+			p.values[f.slot] = f.decode(b)*f.scale + f.bias
+			p.set[f.slot] = true
+		}
+		return
+	}
+}
+
+// Channels in the order they first appear in the schema
+func (p *Packet) Channels() []string {
+	return p.ids
+}
+
+// Value of a channel from the most recently decoded packets.  ok is false if
+// the channel isn't in the schema or hasn't been decoded yet.
+func (p *Packet) Value(channel string) (float64, bool) {
+	slot, ok := p.slots[channel]
+	if !ok || !p.set[slot] {
+		return 0, false
+	}
+	return p.values[slot], true
+}
+
+func (p *Packet) value(channel string) float64 {
+	v, _ := p.Value(channel)
+	return v
+}
+
+func (p *Packet) GetGear() int {
+	return int(p.value(ChannelGear))
+}
+
+// GetRevLightPercent uses the rev_light channel when the schema has one,
+// otherwise rpm is compared against max_rpm.
+func (p *Packet) GetRevLightPercent() int {
+	if v, ok := p.Value(ChannelRevLight); ok {
+		return int(v)
+	}
+	max := p.value(ChannelMaxRPM)
+	if max <= 0 {
+		return 0
+	}
+	return int(100 * p.value(ChannelRPM) / max)
+}
+
+func (p *Packet) GetSpeed() int {
+	return int(p.value(ChannelSpeed) * mslashs)
+}
+
+func (p *Packet) GetRPM() int {
+	return int(p.value(ChannelRPM))
+}
+
+func (p *Packet) GetMaxRPM() int {
+	return int(p.value(ChannelMaxRPM))
+}
+
+func (p *Packet) GetIdleRPM() int {
+	return int(p.value(ChannelIdleRPM))
+}
+
+// GetStageProgress uses the stage_progress channel when the schema has one,
+// otherwise stage_distance is compared against stage_length.
+func (p *Packet) GetStageProgress() float32 {
+	if v, ok := p.Value(ChannelStageProgress); ok {
+		return float32(v)
+	}
+	length := p.value(ChannelStageLength)
+	if length <= 0 {
+		return 0
+	}
+	return float32(p.value(ChannelStageDistance) / length)
+}
+
+func (p *Packet) GetStageDistance() float32 {
+	return float32(p.value(ChannelStageDistance))
+}
+
+func (p *Packet) GetStageLength() float32 {
+	return float32(p.value(ChannelStageLength))
+}
+
+func (p *Packet) GetStageTime() float32 {
+	return float32(p.value(ChannelStageTime))
+}
+
+func (p *Packet) GetLap() int {
+	return int(p.value(ChannelLap))
+}
+
+func (p *Packet) GetLapTime() float32 {
+	return float32(p.value(ChannelLapTime))
+}
+
+func (p *Packet) GetLastLapTime() float32 {
+	return float32(p.value(ChannelLastLapTime))
+}
+
+func (p *Packet) GetBestLapTime() float32 {
+	return float32(p.value(ChannelBestLapTime))
+}
+
+func (p *Packet) GetPosition() int {
+	return int(p.value(ChannelPosition))
+}
+
+func (p *Packet) GetFuel() float32 {
+	return float32(p.value(ChannelFuel))
+}
+
+func (p *Packet) GetFuelCapacity() float32 {
+	return float32(p.value(ChannelFuelCapacity))
+}
+
+func (p *Packet) GetTyreTemps() (t [4]float32) {
+	for i, c := range ChannelTyreTemps {
+		t[i] = float32(p.value(c))
+	}
+	return t
+}
+
+func (p *Packet) GetBrakeTemps() (t [4]float32) {
+	for i, c := range ChannelBrakeTemps {
+		t[i] = float32(p.value(c))
+	}
+	return t
+}
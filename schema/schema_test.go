@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+  "name": "Homebrew Sim",
+  "port": 20800,
+  "packets": [{
+    "id": "car",
+    "match": [{"offset": 0, "type": "u8", "value": 2}],
+    "fields": [
+      {"offset": 4, "type": "f32", "channel": "rpm"},
+      {"offset": 8, "type": "u8", "channel": "gear", "bias": -1},
+      {"offset": 10, "type": "u16", "endian": "big", "scale": 0.1, "channel": "speed"},
+      {"offset": 12, "type": "i16", "channel": "tyre_temp_rr"},
+      {"offset": 14, "type": "u16", "channel": "boost"}
+    ]
+  }, {
+    "id": "session",
+    "size": 32,
+    "match": [{"offset": 0, "type": "u8", "value": 3}],
+    "fields": [
+      {"offset": 8, "type": "f64", "channel": "stage_distance"},
+      {"offset": 16, "type": "f64", "channel": "stage_length"},
+      {"offset": 24, "type": "u32", "scale": 0.001, "channel": "stage_time"},
+      {"offset": 28, "type": "f32", "channel": "max_rpm"}
+    ]
+  }]
+}`
+
+func TestDecode(t *testing.T) {
+	p, err := Load(strings.NewReader(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Size() != 32 || p.Name() != "Homebrew Sim" || p.Port() != 20800 {
+		t.Fatalf("Size=%d Name=%q Port=%d", p.Size(), p.Name(), p.Port())
+	}
+
+	car := make([]byte, 16)
+	car[0] = 2
+	binary.LittleEndian.PutUint32(car[4:], math.Float32bits(6000))
+	car[8] = 0 // reverse
+	binary.BigEndian.PutUint16(car[10:], 200)
+	binary.LittleEndian.PutUint16(car[12:], uint16(0xffff-9)) // -10
+	binary.LittleEndian.PutUint16(car[14:], 150)
+	p.Decode(car)
+
+	sess := make([]byte, 32)
+	sess[0] = 3
+	binary.LittleEndian.PutUint64(sess[8:], math.Float64bits(2500))
+	binary.LittleEndian.PutUint64(sess[16:], math.Float64bits(10000))
+	binary.LittleEndian.PutUint32(sess[24:], 90500)
+	binary.LittleEndian.PutUint32(sess[28:], math.Float32bits(8000))
+	p.Decode(sess)
+
+	if p.ID != "session" {
+		t.Errorf("ID = %q", p.ID)
+	}
+	if p.GetGear() != -1 || p.GetSpeed() != 44 || p.GetRevLightPercent() != 75 {
+		t.Errorf("Gear=%d Speed=%d Rev=%d", p.GetGear(), p.GetSpeed(), p.GetRevLightPercent())
+	}
+	if p.GetStageProgress() != 0.25 || p.GetStageTime() != 90.5 {
+		t.Errorf("Progress=%f Time=%f", p.GetStageProgress(), p.GetStageTime())
+	}
+	if tt := p.GetTyreTemps(); tt[3] != -10 {
+		t.Errorf("Tyres = %v", tt)
+	}
+	if v, ok := p.Value("boost"); !ok || v != 150 {
+		t.Errorf("boost = %f, %t", v, ok)
+	}
+	if _, ok := p.Value(ChannelFuel); ok {
+		t.Error("fuel isn't in the schema")
+	}
+
+	// Unmatched and short datagrams are ignored
+	car[0] = 9
+	p.Decode(car)
+	sess[0] = 2
+	p.Decode(sess[:15])
+	if p.ID != "session" {
+		t.Errorf("ID = %q", p.ID)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, s := range []string{
+		`{"packets": []}`,
+		`{"endian": "middle", "packets": [{"fields": []}]}`,
+		`{"packets": [{"fields": [{"offset": 0, "type": "f16", "channel": "rpm"}]}]}`,
+		`{"packets": [{"fields": [{"offset": 0, "type": "f32"}]}]}`,
+		`{"packets": [{"size": 2, "fields": [{"offset": 0, "type": "f32", "channel": "rpm"}]}]}`,
+	} {
+		if _, err := Load(strings.NewReader(s)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"sync"
@@ -31,6 +32,19 @@ func init() {
 type webSockPackSender struct {
 	*WebSockWriter
 	Buf []byte
+
+	// Names quoted for JSON, which are only quoted again when they change
+	stage, car         string
+	stageJSON, carJSON []byte
+}
+
+// quote s as a JSON string, reusing the last quoting while s is unchanged
+func quote(s string, last *string, buf *[]byte) []byte {
+	if *buf == nil || s != *last {
+		*buf, _ = json.Marshal(s)
+		*last = s
+	}
+	return *buf
 }
 
 // SendPack is about 6 times faster than json.Marshaler
@@ -40,10 +54,84 @@ func (ws *webSockPackSender) SendPack(d hid.TelemetryPack) {
 	ws.Buf = strconv.AppendInt(ws.Buf, int64(d.GetGear()), 10) // Avoid allocs!
 	ws.Buf = append(ws.Buf, `,"Speed":`...)
 	ws.Buf = strconv.AppendInt(ws.Buf, int64(d.GetSpeed()), 10) // Avoid allocs!
+	if p, ok := d.(hid.PositionPack); ok && hid.Reports(d, hid.CapPosition) {
+		ws.Buf = append(ws.Buf, `,"Position":`...)
+		ws.Buf = strconv.AppendInt(ws.Buf, int64(p.GetPosition()), 10)
+	}
+	if s, ok := d.(hid.StandingsPack); ok && hid.Reports(d, hid.CapStandings) {
+		ws.Buf = append(ws.Buf, `,"Cars":`...)
+		ws.Buf = strconv.AppendInt(ws.Buf, int64(s.GetCarCount()), 10)
+		ws.Buf = append(ws.Buf, `,"Standings":[`...)
+		for i, st := range s.GetStandings() {
+			if i > 0 {
+				ws.Buf = append(ws.Buf, ',')
+			}
+			ws.Buf = appendStanding(ws.Buf, &st)
+		}
+		ws.Buf = append(ws.Buf, ']')
+	}
+	if sp, ok := d.(hid.SplitPack); ok && hid.Reports(d, hid.CapSplits) {
+		if splits := sp.GetSplits(); len(splits) > 0 {
+			ws.Buf = append(ws.Buf, `,"Splits":[`...)
+			for i, t := range splits {
+				if i > 0 {
+					ws.Buf = append(ws.Buf, ',')
+				}
+				ws.Buf = strconv.AppendFloat(ws.Buf, float64(t), 'f', 3, 32)
+			}
+			ws.Buf = append(ws.Buf, ']')
+		}
+	}
+	if n, ok := d.(hid.NamePack); ok && hid.Reports(d, hid.CapName) {
+		if stage := n.GetStageName(); stage != "" {
+			ws.Buf = append(ws.Buf, `,"Stage":`...)
+			ws.Buf = append(ws.Buf, quote(stage, &ws.stage, &ws.stageJSON)...)
+		}
+		if car := n.GetCarName(); car != "" {
+			ws.Buf = append(ws.Buf, `,"Car":`...)
+			ws.Buf = append(ws.Buf, quote(car, &ws.car, &ws.carJSON)...)
+		}
+	}
 	ws.Buf = append(ws.Buf, `}`...)
 	ws.Write(ws.Buf)
 }
 
+// appendStanding as a JSON object for the dash's leaderboard
+func appendStanding(b []byte, s *hid.Standing) []byte {
+	b = append(b, `{"Position":`...)
+	b = strconv.AppendInt(b, int64(s.Position), 10)
+	b = append(b, `,"Number":`...)
+	b = strconv.AppendInt(b, int64(s.RaceNumber), 10)
+	b = append(b, `,"Driver":`...)
+	b = appendJSONString(b, s.Driver)
+	b = append(b, `,"Laps":`...)
+	b = strconv.AppendInt(b, int64(s.Laps), 10)
+	b = append(b, `,"Gap":`...)
+	b = strconv.AppendFloat(b, float64(s.GapToLeader), 'f', 3, 32)
+	b = append(b, `,"Interval":`...)
+	b = strconv.AppendFloat(b, float64(s.GapAhead), 'f', 3, 32)
+	b = append(b, `,"InPit":`...)
+	b = strconv.AppendBool(b, s.InPit)
+	return append(b, '}')
+}
+
+// appendJSONString quotes s for JSON without allocating, unlike json.Marshal
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', c)
+		case c < 0x20:
+			b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			b = append(b, c)
+		}
+	}
+	return append(b, '"')
+}
+
 // WebSockWriter provides a thread safe mechanism for performing synchronous
 // writes to multiple websockets.  Clients which disconnect are removed from the
 // pool automatically.
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jake-dog/opensimdash/hid"
+)
+
+type standingsPack struct {
+	standings []hid.Standing
+}
+
+func (p *standingsPack) GetGear() int                 { return 3 }
+func (p *standingsPack) GetRevLightPercent() int      { return 0 }
+func (p *standingsPack) GetSpeed() int                { return 90 }
+func (p *standingsPack) GetPosition() int             { return 2 }
+func (p *standingsPack) GetStandings() []hid.Standing { return p.standings }
+func (p *standingsPack) GetCarCount() int             { return len(p.standings) }
+
+func TestWebSockStandings(t *testing.T) {
+	ws := &webSockPackSender{WebSockWriter: &WebSockWriter{}}
+	ws.SendPack(&standingsPack{standings: []hid.Standing{
+		{Position: 1, RaceNumber: 7, Driver: `A. "Quick" Driver`, Laps: 3},
+		{Position: 2, RaceNumber: 12, Driver: "B.\tDriver\\", Laps: 3, GapToLeader: 1.5, InPit: true},
+	}})
+
+	var d struct {
+		Cars      int
+		Standings []struct {
+			Position, Number, Laps int
+			Driver                 string
+			Gap, Interval          float64
+			InPit                  bool
+		}
+	}
+	if err := json.Unmarshal(ws.Buf, &d); err != nil {
+		t.Fatalf("%v: %s", err, ws.Buf)
+	}
+	if d.Cars != 2 || len(d.Standings) != 2 {
+		t.Fatalf("decoded %+v", d)
+	}
+	if s := d.Standings[0]; s.Driver != `A. "Quick" Driver` || s.Number != 7 {
+		t.Errorf("leader %+v", s)
+	}
+	if s := d.Standings[1]; s.Driver != "B.\tDriver\\" || s.Gap != 1.5 || !s.InPit {
+		t.Errorf("second %+v", s)
+	}
+}
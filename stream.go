@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Stream is a telemetry source which reads datagrams from a byte stream such as
+// stdin, a file or a named pipe.  Datagrams are either fixed size, or each is
+// prefixed with its length as a big endian uint16, the same framing relays use
+// with Ingest.  Like Telemetry, each Read returns a single datagram.
+type Stream struct {
+	r    *bufio.Reader
+	c    io.Closer
+	size int
+
+	// reopen is called at the end of the stream, so that a FIFO can wait for
+	// its next writer
+	reopen func() (io.ReadCloser, error)
+}
+
+// NewStream reads datagrams of size bytes from r, or length prefixed datagrams
+// if size is zero.
+func NewStream(r io.ReadCloser, size int) *Stream {
+	return &Stream{r: bufio.NewReader(r), c: r, size: size}
+}
+
+// OpenStream opens a stream source, which is one of:
+//
+//	stdin       standard input
+//	file:PATH   a file, ending at its end
+//	fifo:PATH   a named pipe, which is reopened whenever its writer hangs up
+func OpenStream(source string, size int) (*Stream, error) {
+	switch {
+	case source == "stdin" || source == "-":
+		return NewStream(ioutil.NopCloser(os.Stdin), size), nil
+	case strings.HasPrefix(source, "file:"):
+		f, err := os.Open(strings.TrimPrefix(source, "file:"))
+		if err != nil {
+			return nil, err
+		}
+		return NewStream(f, size), nil
+	case strings.HasPrefix(source, "fifo:"):
+		path := strings.TrimPrefix(source, "fifo:")
+		open := func() (io.ReadCloser, error) { return os.Open(path) }
+		f, err := open()
+		if err != nil {
+			return nil, err
+		}
+		s := NewStream(f, size)
+		s.reopen = open
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown stream source %q", source)
+}
+
+// ParseFraming parses "length" or "fixed", which uses def, or "fixed:SIZE"
+// into the size NewStream expects.
+func ParseFraming(framing string, def int) (int, error) {
+	switch {
+	case framing == "length":
+		return 0, nil
+	case framing == "fixed":
+		return def, nil
+	case strings.HasPrefix(framing, "fixed:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(framing, "fixed:"))
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid framing %q", framing)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("unknown framing %q", framing)
+}
+
+// Read the next datagram.  As for UDP, datagrams longer than b are truncated.
+// io.EOF is returned at the end of the stream, except for a FIFO which waits
+// for the next writer instead.
+func (s *Stream) Read(b []byte) (int, error) {
+	for {
+		n, err := s.read(b)
+		if (err != io.EOF && err != io.ErrUnexpectedEOF) || s.reopen == nil {
+			return n, err
+		}
+		s.c.Close()
+		r, err := s.reopen()
+		if err != nil {
+			return 0, err
+		}
+		s.r.Reset(r)
+		s.c = r
+	}
+}
+
+func (s *Stream) read(b []byte) (int, error) {
+	size := s.size
+	if size == 0 {
+		var hdr [2]byte
+		if _, err := io.ReadFull(s.r, hdr[:]); err != nil {
+			return 0, err
+		}
+		size = int(binary.BigEndian.Uint16(hdr[:]))
+	}
+
+	n := size
+	if n > len(b) {
+		n = len(b)
+	}
+	if _, err := io.ReadFull(s.r, b[:n]); err != nil {
+		return 0, err
+	}
+	if _, err := s.r.Discard(size - n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// DecodePacket from the next datagram, using the optional buffer.  The same
+// buffer rules apply as for Telemetry.DecodePacket.
+func (s *Stream) DecodePacket(d Decodable, buf []byte) error {
+	return decodePacket(s, d, buf)
+}
+
+// Close the stream
+func (s *Stream) Close() error {
+	return s.c.Close()
+}
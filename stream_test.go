@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamLengthPrefixed(t *testing.T) {
+	var buf bytes.Buffer
+	for _, d := range []string{"one", "", "three"} {
+		writeFrame(&buf, []byte(d))
+	}
+	writeFrame(&buf, bytes.Repeat([]byte("x"), 10))
+
+	s := NewStream(ioutil.NopCloser(&buf), 0)
+	b := make([]byte, 5)
+	for _, want := range []string{"one", "", "three", "xxxxx"} {
+		n, err := s.Read(b)
+		if err != nil || string(b[:n]) != want {
+			t.Errorf("Read = %q, %v, want %q", b[:n], err, want)
+		}
+	}
+	if _, err := s.Read(b); err != io.EOF {
+		t.Errorf("Read at end = %v", err)
+	}
+}
+
+func TestStreamFixedSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "opensimdash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture")
+	if err := ioutil.WriteFile(path, []byte("aaaabbbbcc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := ParseFraming("fixed:4", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenStream("file:"+path, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	b := make([]byte, 8)
+	for _, want := range []string{"aaaa", "bbbb"} {
+		n, err := s.Read(b)
+		if err != nil || string(b[:n]) != want {
+			t.Errorf("Read = %q, %v, want %q", b[:n], err, want)
+		}
+	}
+	if _, err := s.Read(b); err != io.ErrUnexpectedEOF {
+		t.Errorf("Read partial datagram = %v", err)
+	}
+}
+
+func TestParseFraming(t *testing.T) {
+	for _, tc := range []struct {
+		framing string
+		size    int
+		ok      bool
+	}{
+		{"length", 0, true},
+		{"fixed", 264, true},
+		{"fixed:92", 92, true},
+		{"fixed:0", 0, false},
+		{"lines", 0, false},
+	} {
+		size, err := ParseFraming(tc.framing, 264)
+		if (err == nil) != tc.ok || size != tc.size {
+			t.Errorf("ParseFraming(%q) = %d, %v", tc.framing, size, err)
+		}
+	}
+}
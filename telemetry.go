@@ -2,7 +2,10 @@ package main
 
 import (
 	"encoding/binary"
+	"io"
 	"net"
+
+	"github.com/jake-dog/opensimdash/hid"
 )
 
 // Decodable interface is a high performance interface for parsing binary
@@ -13,6 +16,19 @@ type Decodable interface {
 	Size() int
 }
 
+// Source of telemetry datagrams, such as Telemetry or Ingest.  Each Read
+// returns a single datagram, which can be decoded with decodePacket.
+type Source interface {
+	Read(b []byte) (int, error)
+	Close() error
+}
+
+// Pack is a datagram decoded from a Source, which is sent to devices
+type Pack interface {
+	Decodable
+	hid.TelemetryPack
+}
+
 // Telemetry wraps net.UDPConn providing extra methods for parsing UDP telemetry
 type Telemetry struct {
 	*net.UDPConn
@@ -38,16 +54,23 @@ func NewTelemetry(address string) (*Telemetry, error) {
 // DecodePacket from client's UDP stream using optional buffer.  If provided
 // buffer is nil, then a byte array will be allocated to read data which will
 // result in unnecessary memory allocations.  In all cases it is preferred that
-// a buffer is provided to avoid memory allocations.
+// a buffer is provided to avoid memory allocations.  Only the bytes of the
+// datagram are passed to Decode, so decoders can tell variants apart by length.
 func (c *Telemetry) DecodePacket(d Decodable, buf []byte) error {
+	return decodePacket(c, d, buf)
+}
+
+// decodePacket reads a single datagram from r and decodes it
+func decodePacket(r io.Reader, d Decodable, buf []byte) error {
 	b := buf
 	if b == nil {
 		b = make([]byte, d.Size())
 	}
-	if _, err := c.Read(b); err != nil {
+	n, err := r.Read(b)
+	if err != nil {
 		return err
 	}
-	d.Decode(b)
+	d.Decode(b[:n])
 	return nil
 }
 
@@ -1,7 +1,10 @@
+//go:build windows
+// +build windows
+
 package main
 
 import (
-	"sync"
+	"fmt"
 	"syscall"
 	"unsafe"
 )
@@ -27,12 +30,6 @@ const (
 	DBT_DEVICEREMOVECOMPLETE = 0x8004
 )
 
-const (
-	// Used only for clients listening for USB device events
-	addUSBDevice = iota
-	removeUSBDevice
-)
-
 var (
 	user32                      = syscall.NewLazyDLL("user32.dll")
 	kernel32                    = syscall.NewLazyDLL("kernel32.dll")
@@ -45,47 +42,6 @@ var (
 	pRegisterDeviceNotification = user32.NewProc("RegisterDeviceNotificationW")
 )
 
-// Keep track of who is publishing
-type publisher struct {
-	mu          sync.Mutex
-	subscribers []UsbDeviceNotifier
-}
-
-var pub = &publisher{}
-
-func (p *publisher) addSubscriber(sub UsbDeviceNotifier) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	p.subscribers = append(p.subscribers, sub)
-}
-
-func (p *publisher) notify(method int, lParam uintptr) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	for _, sub := range p.subscribers {
-		switch method {
-		case addUSBDevice:
-			sub.Add(lParam)
-		case removeUSBDevice:
-			sub.Remove(lParam)
-		}
-	}
-}
-
-// AddSubscriber to the list of USB device notification subscribers.
-func AddSubscriber(sub UsbDeviceNotifier) {
-	pub.addSubscriber(sub)
-}
-
-// UsbDeviceNotifier is an interface for a resource to be notified of USB adds
-// and removals
-type UsbDeviceNotifier interface {
-	Add(uintptr)    // Called on DBT_DEVICEARRIVAL
-	Remove(uintptr) // Called on DBT_DEVICEREMOVECOMPLETE
-}
-
 // https://www.lifewire.com/device-class-guids-for-most-common-types-of-hardware-2619208
 // 745A17A0-74D3-11D0-B6FE-00A0C90F57DA
 var HID_DEVICE_CLASS = GUID{
@@ -172,7 +128,9 @@ func WndProc(hWnd syscall.Handle, msg uint32, wParam, lParam uintptr) uintptr {
 	}
 }
 
-func init() {
+// nativeHotplug publishes WM_DEVICECHANGE messages, calling fallback if the
+// message window can't be created or registered.
+func nativeHotplug(fallback func(error)) {
 	// TODO clean this up a bit
 	// The whole thing needs to be run in a single scope/closure otherwise golang
 	// will GC all the structs and the message window will not work.
@@ -195,7 +153,7 @@ func init() {
 		wc.Size = uint32(unsafe.Sizeof(wc))
 		a, _, err := pRegisterClassEx.Call(uintptr(unsafe.Pointer(&wc)))
 		if a == 0 {
-			logger.Printf("RegisterClassEx failed: %v", err)
+			fallback(fmt.Errorf("RegisterClassEx failed: %v", err))
 			return
 		}
 
@@ -217,7 +175,7 @@ func init() {
 			uintptr(0))                            //lpParam
 
 		if ret == 0 {
-			logger.Printf("CreateWindowEx failed: %v", err)
+			fallback(fmt.Errorf("CreateWindowEx failed: %v", err))
 			return
 		}
 		hWnd := syscall.Handle(ret)
@@ -233,7 +191,7 @@ func init() {
 		notificationFilter.szName = 0
 		ret, _, err = pRegisterDeviceNotification.Call(uintptr(hWnd), uintptr(unsafe.Pointer(&notificationFilter)), DEVICE_NOTIFY_ALL_INTERFACE_CLASSES)
 		if ret == 0 {
-			logger.Printf("RegisterDeviceNotification failed: %v", err)
+			fallback(fmt.Errorf("RegisterDeviceNotification failed: %v", err))
 			return
 		}
 